@@ -20,11 +20,12 @@ const (
 )
 
 var (
-	helpFlag     = flag.Bool("h", false, "Print help message")
-	helpLongFlag = flag.Bool("help", false, "Print help message")
-	versionFlag  = flag.Bool("v", false, "Print version information")
-	historyFlag  = flag.Bool("r", false, "Print reading history")
-	dumpFlag     = flag.Bool("d", false, "Dump EPUB content")
+	helpFlag      = flag.Bool("h", false, "Print help message")
+	helpLongFlag  = flag.Bool("help", false, "Print help message")
+	versionFlag   = flag.Bool("v", false, "Print version information")
+	historyFlag   = flag.Bool("r", false, "Print reading history")
+	dumpFlag      = flag.Bool("d", false, "Dump EPUB content")
+	renditionFlag = flag.String("rendition", "", "Select rendition by number, label or language")
 )
 
 func main() {
@@ -93,27 +94,43 @@ func main() {
 
 	// Check if we should dump the EPUB content
 	if *dumpFlag {
-		dumpEpub(filePath)
+		dumpEpub(filePath, *renditionFlag)
 		os.Exit(0)
 	}
 
+	// Get the reading state
+	state, ok := cfg.GetState(filePath)
+
+	// The rendition from the command line wins over the saved one
+	rendition := *renditionFlag
+	if rendition == "" {
+		rendition = state.Rendition
+	}
+
 	// Read the EPUB file
-	book, err := epub.NewEpub(filePath)
+	book, err := epub.NewEpubWithRendition(filePath, rendition)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error opening EPUB file: %v\n", err)
 		os.Exit(1)
 	}
 	defer book.Close()
 
-	// Get the reading state
-	state, ok := cfg.GetState(filePath)
+	// The saved position belongs to another rendition
+	if ok && state.Rendition != "" && state.Rendition != book.Renditions[book.Rendition].FullPath {
+		state.Index = 0
+		state.Pos = 0
+		state.Pctg = 0
+		state.Position = 0
+	}
+
 	if !ok {
 		// No state, start from the beginning
 		state = config.State{
-			Index: 0,
-			Width: 80,
-			Pos:   0,
-			Pctg:  0,
+			Index:     0,
+			Width:     80,
+			Pos:       0,
+			Pctg:      0,
+			Hyphenate: true,
 		}
 
 		// Only set and save state if it's a new file
@@ -128,6 +145,11 @@ func main() {
 	reader := reader.NewReader(book, cfg, filePath)
 
 	reader.UI.SetColorScheme(state.ColorScheme)
+	reader.FirstOpen = !ok
+	reader.Ruby = state.Ruby
+	reader.Justify = state.Justify
+	reader.Hyphenate = state.Hyphenate
+	reader.InlineImages = state.Images
 
-	reader.Run(state.Index, state.Width, state.Pos, state.Pctg)
+	reader.Run(state.Index, state.Width, state.Position, state.Pctg)
 }
@@ -79,7 +79,7 @@ func getOrderedHistoryFiles(cfg *config.Config) []string {
 
 // printHelp prints the help message
 func printHelp() {
-	fmt.Println(`
+	fmt.Print(`
 Usages:
     goread             read last epub
     goread EPUBFILE    read EPUBFILE
@@ -90,12 +90,20 @@ Usages:
 Options:
     -r              print reading history
     -d              dump epub
+    -rendition R    read rendition R (number, label or language)
+                    of a multiple-rendition epub
     -h, --help      print short, long help
 
+Environment:
+    GOREAD_IMAGES   protocol the images in the text are drawn with:
+                    kitty, sixel, iterm2 or blocks (detected when unset)
+
 Key Bindings:
     Help             : ?
     Quit             : q
     ToC              : t
+    Landmarks        : L
+    Go to print page : p
     Next chapter     : n
     Prev chapter     : N
     Search           : /
@@ -109,7 +117,17 @@ Key Bindings:
     Increase width   : +
     Decrease width   : -
     Metadata         : m
+    Footnotes        : F
+    Follow link      : f
+    Jump back        : C-o
+    Jump forward     : C-i
+    Renditions       : R
+    Cover            : v
     Switch colorsch  : c
+    Ruby display     : r
+    Justify          : J
+    Hyphenation      : H
+    Inline images    : i
 
 Press Esc or Enter to close
 `)
@@ -143,16 +161,19 @@ func printHistory(cfg *config.Config) {
 }
 
 // dumpEpub dumps the EPUB content
-func dumpEpub(filePath string) {
+func dumpEpub(filePath string, rendition string) {
 	// Open the EPUB file
-	book, err := epub.NewEpub(filePath)
+	book, err := epub.NewEpubWithRendition(filePath, rendition)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error opening EPUB file: %v\n", err)
 		os.Exit(1)
 	}
 	defer book.Close()
+	// The lines are kept whole, the text is wrapped by what reads it
+	book.Width = parser.NoWrap
 
 	// Dump the content
+	written := false
 	for i := range book.TOC.Slice {
 		content, err := book.GetChapterContents(i)
 		if err != nil {
@@ -160,14 +181,15 @@ func dumpEpub(filePath string) {
 			continue
 		}
 
-		// Parse the HTML content
-		text, err := parser.DumpHTML(content.Text)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing HTML: %v\n", err)
+		// Print the text without its styles, the chapters are separated by a blank line
+		text := parser.DumpText(content.Plain, content.TextLines)
+		if text == "" {
 			continue
 		}
-
-		// Print the text
-		fmt.Print(text)
+		if written {
+			fmt.Println()
+		}
+		fmt.Println(text)
+		written = true
 	}
 }
@@ -5,17 +5,24 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/ray-d-song/goread/pkg/parser"
 	"github.com/ray-d-song/goread/pkg/ui"
 )
 
 // State represents the reading state of a file
 type State struct {
-	Index       int            `json:"index"`
-	Width       int            `json:"width"`
-	ColorScheme ui.ColorScheme `json:"color_scheme"`
-	Pos         int            `json:"pos"`
-	Pctg        float64        `json:"pctg"`
-	LastRead    bool           `json:"lastread"`
+	Index       int             `json:"index"`
+	Width       int             `json:"width"`
+	ColorScheme ui.ColorScheme  `json:"color_scheme"`
+	Pos         int             `json:"pos"`
+	Pctg        float64         `json:"pctg"`
+	Position    int             `json:"position,omitempty"` // Position in the text of the line at the top, see parser.Rendered
+	LastRead    bool            `json:"lastread"`
+	Rendition   string          `json:"rendition,omitempty"` // rootfile path of the selected rendition
+	Ruby        parser.RubyMode `json:"ruby,omitempty"`      // How the ruby annotations are shown
+	Justify     bool            `json:"justify,omitempty"`   // Justify the left-aligned paragraphs
+	Hyphenate   bool            `json:"hyphenate,omitempty"` // Hyphenate the words of the languages with a dictionary
+	Images      bool            `json:"images,omitempty"`    // Draw the images in the text
 }
 
 // Config represents the configuration of the application
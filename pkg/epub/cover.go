@@ -0,0 +1,179 @@
+package epub
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/ray-d-song/goread/pkg/utils"
+	"golang.org/x/net/html"
+)
+
+// maxCoverPageText is the length of text a page may hold and still count as a cover page
+const maxCoverPageText = 200
+
+// resolveHref resolves an href found in the file base to a path in the archive
+func resolveHref(base string, href string) string {
+	href, _ = splitPathAndFragment(href)
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return strings.TrimPrefix(path.Join(path.Dir(base), href), "./")
+}
+
+// findCover looks for the cover image of the book
+// In order: the EPUB 3.0 cover-image property, the EPUB 2.0 <meta name="cover">,
+// the cover reference of the guide and an image-only first spine page
+func (e *Epub) findCover(pkg *Package) {
+	e.Cover = ""
+	e.CoverMediaType = ""
+
+	setCover := func(item ManifestItem, source string) {
+		e.Cover = resolveHref(e.RootFile, item.Href)
+		e.CoverMediaType = item.MediaType
+		utils.DebugLog("[INFO:findCover] Found cover in %s: %s", source, e.Cover)
+	}
+
+	for _, item := range pkg.Manifest {
+		if hasProperty(item.Properties, "cover-image") {
+			setCover(item, "manifest properties")
+			return
+		}
+	}
+
+	// <meta name="cover" content="..."/> refers to a manifest id, some books use the href instead
+	for _, meta := range pkg.Metadata.Items {
+		if meta.XMLName.Local != "meta" || attrValue(meta.Attrs, "name") != "cover" {
+			continue
+		}
+		content := attrValue(meta.Attrs, "content")
+		for _, item := range pkg.Manifest {
+			if (item.ID == content || item.Href == content) && strings.HasPrefix(item.MediaType, "image/") {
+				setCover(item, "cover meta")
+				return
+			}
+		}
+	}
+
+	for _, ref := range pkg.Guide {
+		if !strings.EqualFold(ref.Type, "cover") {
+			continue
+		}
+		if e.setCoverFromPage(pkg, resolveHref(e.RootFile, ref.Href), false) {
+			utils.DebugLog("[INFO:findCover] Found cover in guide: %s", e.Cover)
+			return
+		}
+	}
+
+	// The first page of the spine is often a page showing only the cover image
+	manifestItems := make(map[string]ManifestItem)
+	for _, item := range pkg.Manifest {
+		manifestItems[item.ID] = item
+	}
+	if len(pkg.Spine.Items) > 0 {
+		if item, ok := manifestItems[pkg.Spine.Items[0].IDRef]; ok {
+			if e.setCoverFromPage(pkg, resolveHref(e.RootFile, item.Href), true) {
+				utils.DebugLog("[INFO:findCover] Found cover in first spine page: %s", e.Cover)
+				return
+			}
+		}
+	}
+
+	utils.DebugLog("[INFO:findCover] No cover found")
+}
+
+// setCoverFromPage sets the cover to the first image of the page,
+// or to the page itself if it is an image
+// With imageOnly, pages holding more than a few words are rejected
+func (e *Epub) setCoverFromPage(pkg *Package, pagePath string, imageOnly bool) bool {
+	if mediaType := e.mediaType(pkg, pagePath); strings.HasPrefix(mediaType, "image/") {
+		e.Cover = pagePath
+		e.CoverMediaType = mediaType
+		return true
+	}
+
+	pageFile, err := e.openFile(pagePath)
+	if err != nil {
+		utils.DebugLog("[ERROR:setCoverFromPage] Error opening page: %v", err)
+		return false
+	}
+	defer pageFile.Close()
+
+	src, textLength := findPageImage(pageFile)
+	if src == "" || (imageOnly && textLength > maxCoverPageText) {
+		return false
+	}
+
+	e.Cover = resolveHref(pagePath, src)
+	e.CoverMediaType = e.mediaType(pkg, e.Cover)
+	return true
+}
+
+// findPageImage returns the source of the first image of a page (<img> or SVG <image>)
+// and the length of the text of the page
+func findPageImage(r io.Reader) (string, int) {
+	tokenizer := html.NewTokenizer(r)
+	src := ""
+	textLength := 0
+	inBody := false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return src, textLength
+		case html.TextToken:
+			if inBody {
+				textLength += len(strings.TrimSpace(string(tokenizer.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "body":
+				inBody = true
+			case "img", "image":
+				if src != "" {
+					continue
+				}
+				for _, attr := range token.Attr {
+					// <img src>, <image href> and <image xlink:href>
+					if attr.Key == "src" || attr.Key == "href" || attr.Key == "xlink:href" {
+						src = attr.Val
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// mediaType returns the media type of a file, from the manifest or from its extension
+func (e *Epub) mediaType(pkg *Package, name string) string {
+	for _, item := range pkg.Manifest {
+		if resolveHref(e.RootFile, item.Href) == name {
+			return item.MediaType
+		}
+	}
+	return mime.TypeByExtension(path.Ext(name))
+}
+
+// HasCover checks if a cover image was found
+func (e *Epub) HasCover() bool {
+	return e.Cover != ""
+}
+
+// GetCover returns the data of the cover image
+func (e *Epub) GetCover() ([]byte, error) {
+	if e.Cover == "" {
+		return nil, fmt.Errorf("no cover found")
+	}
+
+	coverFile, err := e.openFile(e.Cover)
+	if err != nil {
+		return nil, err
+	}
+	defer coverFile.Close()
+
+	return io.ReadAll(coverFile)
+}
@@ -0,0 +1,102 @@
+package epub
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestFindCover(t *testing.T) {
+	images := `<item id="a" href="images/a.jpg" media-type="image/jpeg"/>
+<item id="b" href="images/b.png" media-type="image/png"/>
+<item id="c" href="images/c.gif" media-type="image/gif"/>
+<item id="cover" href="text/cover.xhtml" media-type="application/xhtml+xml"/>
+<item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>`
+	files := map[string]string{
+		"OEBPS/images/a.jpg": "jpeg",
+		"OEBPS/images/b.png": "png",
+		"OEBPS/images/c.gif": "gif",
+		"OEBPS/images/d.png": "d",
+		"OEBPS/text/cover.xhtml": xhtml(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+<image xlink:href="../images/c.gif"/></svg>`),
+		"OEBPS/ch1.xhtml": xhtml(`<p><img src="images/b.png" alt="Map"/></p><p>` + strings.Repeat("Call me Ishmael. ", 20) + `</p>`),
+	}
+
+	tests := []struct {
+		name      string
+		metadata  string
+		manifest  string
+		spine     string
+		guide     string
+		cover     string
+		mediaType string
+	}{
+		{
+			name:      "cover-image property before the cover meta",
+			metadata:  `<meta name="cover" content="a"/>`,
+			manifest:  `<item id="d" href="images/d.png" media-type="image/png" properties="cover-image"/>`,
+			cover:     "OEBPS/images/d.png",
+			mediaType: "image/png",
+		},
+		{
+			name:      "cover meta with a manifest id",
+			metadata:  `<meta name="cover" content="a"/>`,
+			guide:     `<reference type="cover" href="text/cover.xhtml"/>`,
+			cover:     "OEBPS/images/a.jpg",
+			mediaType: "image/jpeg",
+		},
+		{
+			name:      "cover meta with an href",
+			metadata:  `<meta name="cover" content="images/a.jpg"/>`,
+			cover:     "OEBPS/images/a.jpg",
+			mediaType: "image/jpeg",
+		},
+		{
+			name:      "cover meta of a page is skipped for the guide",
+			metadata:  `<meta name="cover" content="cover"/>`,
+			guide:     `<reference type="Cover" href="images/b.png"/>`,
+			cover:     "OEBPS/images/b.png",
+			mediaType: "image/png",
+		},
+		{
+			name:      "guide page",
+			guide:     `<reference type="text" href="ch1.xhtml"/><reference type="cover" href="ch1.xhtml"/>`,
+			spine:     `<itemref idref="cover"/>`,
+			cover:     "OEBPS/images/b.png",
+			mediaType: "image/png",
+		},
+		{
+			name:      "image-only first spine page",
+			spine:     `<itemref idref="cover"/>`,
+			cover:     "OEBPS/images/c.gif",
+			mediaType: "image/gif",
+		},
+		{
+			name:  "first spine page with text",
+			spine: `<itemref idref="ch1"/><itemref idref="cover"/>`,
+		},
+	}
+	for _, tt := range tests {
+		bookFiles := maps.Clone(files)
+		bookFiles["OEBPS/content.opf"] = opf("2.0", `<metadata>`+tt.metadata+`</metadata>
+<manifest>`+images+tt.manifest+`</manifest>
+<spine>`+tt.spine+`<itemref idref="ch1"/></spine><guide>`+tt.guide+`</guide>`)
+		book := openEpub(t, bookFiles)
+
+		if book.Cover != tt.cover || book.CoverMediaType != tt.mediaType {
+			t.Errorf("%s: cover = %q (%q), want %q (%q)", tt.name, book.Cover, book.CoverMediaType, tt.cover, tt.mediaType)
+		}
+		if book.HasCover() != (tt.cover != "") {
+			t.Errorf("%s: HasCover() = %v, want %v", tt.name, book.HasCover(), tt.cover != "")
+		}
+		if tt.cover == "" {
+			continue
+		}
+		data, err := book.GetCover()
+		if err != nil {
+			t.Errorf("%s: GetCover() error = %v", tt.name, err)
+		} else if string(data) != files[tt.cover] {
+			t.Errorf("%s: GetCover() = %q, want %q", tt.name, data, files[tt.cover])
+		}
+	}
+}
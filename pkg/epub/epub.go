@@ -5,6 +5,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"maps"
 	"path/filepath"
 	"strings"
 
@@ -31,6 +32,9 @@ type TOCValue struct {
 	Level    int
 	IsDir    bool
 	IsShadow bool
+	// IsNonLinear marks auxiliary content (spine linear="no") like answer keys,
+	// skipped when paging through chapters but still reachable from the TOC or links
+	IsNonLinear bool
 }
 
 // Epub represents an EPUB book
@@ -40,21 +44,49 @@ type Epub struct {
 	File     *zip.ReadCloser
 	RootFile string
 	RootDir  string
-	Version  string
-	TOC      *utils.DList[TOCValue]
-}
 
-// Metadata represents EPUB metadata
-type Metadata struct {
-	Title       string
-	Creator     string
-	Publisher   string
-	Language    string
-	Identifier  string
-	Date        string
-	Description string
-	Rights      string
-	OtherMeta   [][]string
+	// Renditions are the rootfiles listed in container.xml,
+	// Rendition is the index of the one being read
+	Renditions []RootFile
+	Rendition  int
+	Version    string
+	TOC        *utils.DList[TOCValue]
+
+	// PageProgressionDirection is the reading direction of the spine (ltr, rtl or empty)
+	PageProgressionDirection string
+
+	// Landmarks and PageList come from the EPUB 3.0 navigation document,
+	// with the NCX pageList and the EPUB 2.0 guide as fallbacks
+	Landmarks []Landmark
+	PageList  []PageTarget
+
+	// Width is the width of the text area the chapters are laid out for
+	Width int
+	// CodeColors are the colors of the highlighted code of the color scheme
+	CodeColors parser.CodeColors
+	// Ruby is how the ruby annotations are shown
+	Ruby parser.RubyMode
+	// Justify justifies the left-aligned paragraphs, Hyphenate hyphenates the words of
+	// the languages with a dictionary
+	Justify   bool
+	Hyphenate bool
+	// ImageSize gives the size the images are drawn at in the text by archive path,
+	// the images are only shown as their markers without it
+	ImageSize func(path string) parser.ImageSize
+	// Language is the first language of the book (dc:language), for the text without a lang attribute
+	Language string
+
+	// stylesheets are the stylesheets read, by archive path
+	stylesheets map[string]string
+	// parsed is the chapter file parsed last, for the chapters of the same file and the
+	// chapter read after a jump
+	parsed *parsedFile
+	// bookImages are the images of the book, once asked for
+	bookImages []BookImage
+
+	// Cover is the archive path of the cover image, empty if the book has none
+	Cover          string
+	CoverMediaType string
 }
 
 // Container represents the container.xml file
@@ -64,24 +96,37 @@ type Container struct {
 }
 
 // RootFile represents a rootfile in container.xml
+// Multiple-rendition EPUBs describe each rendition with the rendition:* attributes
 type RootFile struct {
-	FullPath  string `xml:"full-path,attr"`
-	MediaType string `xml:"media-type,attr"`
+	FullPath   string `xml:"full-path,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Layout     string `xml:"http://www.idpf.org/2013/rendition layout,attr"`
+	Language   string `xml:"http://www.idpf.org/2013/rendition language,attr"`
+	Media      string `xml:"http://www.idpf.org/2013/rendition media,attr"`
+	AccessMode string `xml:"http://www.idpf.org/2013/rendition accessMode,attr"`
+	Label      string `xml:"http://www.idpf.org/2013/rendition label,attr"`
 }
 
 // Package represents the package element in the OPF file
 type Package struct {
 	XMLName  xml.Name       `xml:"package"`
 	Version  string         `xml:"version,attr"`
-	Metadata []MetadataItem `xml:"metadata>*"`
+	Metadata Metadatas      `xml:"metadata"`
 	Manifest []ManifestItem `xml:"manifest>item"`
-	Spine    []SpineItem    `xml:"spine>itemref"`
+	Spine    Spine          `xml:"spine"`
+	Guide    []GuideItem    `xml:"guide>reference"`
+}
+
+// Metadatas represents the metadata element in the OPF file
+type Metadatas struct {
+	Items []MetadataItem `xml:",any"`
 }
 
 // MetadataItem represents a metadata item in the OPF file
 type MetadataItem struct {
 	XMLName xml.Name
-	Content string `xml:",chardata"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",chardata"`
 }
 
 // ManifestItem represents an item in the manifest
@@ -92,15 +137,30 @@ type ManifestItem struct {
 	Properties string `xml:"properties,attr"`
 }
 
+// Spine represents the spine in the OPF file
+type Spine struct {
+	PageProgressionDirection string      `xml:"page-progression-direction,attr"`
+	Items                    []SpineItem `xml:"itemref"`
+}
+
 // SpineItem represents an itemref in the spine
 type SpineItem struct {
-	IDRef string `xml:"idref,attr"`
+	IDRef  string `xml:"idref,attr"`
+	Linear string `xml:"linear,attr"`
+}
+
+// GuideItem represents a reference in the EPUB 2.0 guide
+type GuideItem struct {
+	Type  string `xml:"type,attr"`
+	Title string `xml:"title,attr"`
+	Href  string `xml:"href,attr"`
 }
 
 // NCX represents the NCX file for EPUB 2.0
 type NCX struct {
-	XMLName   xml.Name   `xml:"ncx"`
-	NavPoints []NavPoint `xml:"navMap>navPoint"`
+	XMLName     xml.Name        `xml:"ncx"`
+	NavPoints   []NavPoint      `xml:"navMap>navPoint"`
+	PageTargets []NCXPageTarget `xml:"pageList>pageTarget"`
 }
 
 // NavPoint represents a navigation point in the NCX
@@ -113,6 +173,15 @@ type NavPoint struct {
 	NavPoints []NavPoint `xml:"navPoint"`
 }
 
+// NCXPageTarget represents a page target in the NCX pageList
+type NCXPageTarget struct {
+	ID       string   `xml:"id,attr"`
+	Type     string   `xml:"type,attr"`
+	Value    string   `xml:"value,attr"`
+	NavLabel NavLabel `xml:"navLabel"`
+	Content  Content  `xml:"content"`
+}
+
 // NavLabel represents a navigation label
 type NavLabel struct {
 	Text string `xml:"text"`
@@ -123,21 +192,15 @@ type Content struct {
 	Src string `xml:"src,attr"`
 }
 
-// Nav represents the navigation document for EPUB 3.0
-type Nav struct {
-	XMLName  xml.Name  `xml:"html"`
-	NavLinks []NavLink `xml:"body>nav>ol>li>a"`
-}
-
-// NavLink represents a navigation link
-type NavLink struct {
-	XMLName xml.Name `xml:"a"`
-	Href    string   `xml:"href,attr"`
-	Text    string   `xml:",chardata"`
-}
-
 // NewEpub creates a new Epub instance
 func NewEpub(filePath string) (*Epub, error) {
+	return NewEpubWithRendition(filePath, "")
+}
+
+// NewEpubWithRendition creates a new Epub instance reading the given rendition
+// rendition is a 1-based number, a rootfile path, a label or a language,
+// if empty the default rendition is chosen (see selectRendition)
+func NewEpubWithRendition(filePath string, rendition string) (*Epub, error) {
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
 		return nil, err
@@ -154,7 +217,7 @@ func NewEpub(filePath string) (*Epub, error) {
 	}
 
 	// Parse container.xml to find the rootfile
-	err = epub.parseContainer()
+	err = epub.parseContainer(rendition)
 	if err != nil {
 		return nil, err
 	}
@@ -175,7 +238,7 @@ func NewEpub(filePath string) (*Epub, error) {
 }
 
 // parseContainer parses the container.xml file to find the rootfile
-func (e *Epub) parseContainer() error {
+func (e *Epub) parseContainer(rendition string) error {
 	var container Container
 
 	containerFile, err := e.File.Open("META-INF/container.xml")
@@ -194,7 +257,27 @@ func (e *Epub) parseContainer() error {
 		return fmt.Errorf("no rootfile found in container.xml")
 	}
 
-	e.RootFile = container.RootFiles[0].FullPath
+	// Only package documents can be read, skip other renditions like PDF
+	e.Renditions = nil
+	for _, rootFile := range container.RootFiles {
+		if rootFile.MediaType == "" || rootFile.MediaType == "application/oebps-package+xml" {
+			e.Renditions = append(e.Renditions, rootFile)
+		}
+	}
+	if len(e.Renditions) == 0 {
+		e.Renditions = container.RootFiles
+	}
+
+	e.Rendition = e.selectRendition(rendition)
+	utils.DebugLog("[INFO:parseContainer] Using rendition %d of %d: %s", e.Rendition+1, len(e.Renditions), e.Renditions[e.Rendition].FullPath)
+	e.setRootFile(e.Renditions[e.Rendition].FullPath)
+
+	return nil
+}
+
+// setRootFile sets the rootfile and its directory
+func (e *Epub) setRootFile(rootFile string) {
+	e.RootFile = rootFile
 	e.RootDir = filepath.Dir(e.RootFile)
 	if e.RootDir != "" {
 		e.RootDir += "/"
@@ -210,12 +293,14 @@ func (e *Epub) parseContainer() error {
 	}
 
 	// if OEBPS directory exists but current RootFile is not in OEBPS
-	if hasOEBPS && !strings.HasPrefix(e.RootFile, "OEBPS/") {
+	// Renditions usually live in their own directories, so with several of them
+	// only missing rootfiles are looked up in OEBPS
+	if hasOEBPS && !strings.HasPrefix(e.RootFile, "OEBPS/") && (len(e.Renditions) <= 1 || !e.hasFile(e.RootFile)) {
 		// try to find the same file in OEBPS
 		oebpsRootFile := "OEBPS/" + filepath.Base(e.RootFile)
 		for _, file := range e.File.File {
 			if file.Name == oebpsRootFile {
-				utils.DebugLog("[INFO:parseContainer] Found rootfile in OEBPS directory: %s", oebpsRootFile)
+				utils.DebugLog("[INFO:setRootFile] Found rootfile in OEBPS directory: %s", oebpsRootFile)
 				e.RootFile = oebpsRootFile
 				e.RootDir = filepath.Dir(e.RootFile)
 				if e.RootDir != "" {
@@ -225,8 +310,16 @@ func (e *Epub) parseContainer() error {
 			}
 		}
 	}
+}
 
-	return nil
+// hasFile checks if the archive contains the file
+func (e *Epub) hasFile(name string) bool {
+	for _, file := range e.File.File {
+		if file.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 // parseRootFile parses the rootfile to get the TOC and spine
@@ -265,9 +358,9 @@ func (e *Epub) parseRootFile() error {
 	}
 
 	// If no NCX file found and it's EPUB 3.0, try to find the navigation document
-	if !tocFound && e.Version == "3.0" {
+	if !tocFound && strings.HasPrefix(e.Version, "3") {
 		for _, item := range pkg.Manifest {
-			if item.Properties == "nav" {
+			if hasProperty(item.Properties, "nav") {
 				// Use the correct path for the TOC file
 				if e.RootDir != "" {
 					e.TOCPath = e.RootDir + item.Href
@@ -302,16 +395,44 @@ func (e *Epub) initialize() error {
 	// Create a map of manifest items
 	manifestItems := make(map[string]ManifestItem)
 	for _, item := range pkg.Manifest {
-		if item.MediaType != "application/x-dtbncx+xml" && item.Properties != "nav" {
+		if item.MediaType != "application/x-dtbncx+xml" && !hasProperty(item.Properties, "nav") {
 			manifestItems[item.ID] = item
 		}
 	}
 
 	// Try to get chapter information from TOC
-	if err := e.generateTOC(pkg.Spine, manifestItems); err != nil {
+	if err := e.generateTOC(pkg.Spine.Items, manifestItems); err != nil {
 		return err
 	}
 
+	e.PageProgressionDirection = pkg.Spine.PageProgressionDirection
+	e.bookImages = nil
+	for _, item := range pkg.Metadata.Items {
+		if item.XMLName.Local == "language" {
+			e.Language = strings.TrimSpace(item.Content)
+			break
+		}
+	}
+
+	// Mark the chapters of non-linear spine items
+	nonLinearPaths := make(map[string]bool)
+	for _, spineItem := range pkg.Spine.Items {
+		if item, ok := manifestItems[spineItem.IDRef]; ok && spineItem.Linear == "no" {
+			path, _ := splitPathAndFragment(item.Href)
+			nonLinearPaths[filepath.Clean(path)] = true
+		}
+	}
+	for i := range e.TOC.Slice {
+		if nonLinearPaths[filepath.Clean(e.TOC.Slice[i].Path)] {
+			e.TOC.Slice[i].IsNonLinear = true
+		}
+	}
+
+	// Landmarks and page list are optional, errors are only logged
+	e.generateNavigation(&pkg)
+
+	e.findCover(&pkg)
+
 	return nil
 }
 
@@ -368,10 +489,11 @@ func (e *Epub) generateTOC(spine []SpineItem, manifestItems map[string]ManifestI
 			if err != nil {
 				utils.DebugLog("[ERROR:GenerateTOC] Error decoding NCX: %v", err)
 			} else {
-				// Process all nav points recursively to build TOC
+				// Process all nav points recursively to build TOC,
+				// the top-level entries have no parent like the ones of the navigation document
 				var prev *utils.DItem[TOCValue]
 				for i := range ncx.NavPoints {
-					prev = processNestedNavPoints(ncx.NavPoints[i], e.TOC, prev, 0, uuid.New().String())
+					prev = processNestedNavPoints(ncx.NavPoints[i], e.TOC, prev, 0, "")
 				}
 
 				// Count NCX nodes including nested ones
@@ -379,34 +501,21 @@ func (e *Epub) generateTOC(spine []SpineItem, manifestItems map[string]ManifestI
 			}
 		} else {
 			// Parse as navigation document (EPUB 3.0 style)
-			var nav Nav
-			decoder := xml.NewDecoder(tocFile)
-			err = decoder.Decode(&nav)
+			var nav *Nav
+			nav, err = parseNav(tocFile)
 			if err != nil {
 				utils.DebugLog("[ERROR:GenerateTOC] Error decoding Nav: %v", err)
-			} else {
-				utils.DebugLog("[INFO:GenerateTOC] Number of navLinks: %d", len(nav.NavLinks))
-
-				// Process nav links
+			} else if tocNav := nav.TOC(); tocNav != nil {
+				// Process all nav items recursively to build TOC
 				var prev *utils.DItem[TOCValue]
-				for _, link := range nav.NavLinks {
-					path, fragment := splitPathAndFragment(link.Href)
-					newItem := TOCValue{
-						ID:       uuid.New().String(),
-						Title:    link.Text,
-						Path:     path,
-						Fragment: fragment,
-						Level:    0, // For now we don't handle nested nav links in EPUB 3.0
-						IsDir:    false,
-						ParentID: "",
-						IsShadow: false,
-					}
-					newNode := e.TOC.Add(newItem, prev)
-					prev = newNode
+				for i := range tocNav.Items {
+					prev = processNestedNavItems(tocNav.Items[i], e.TOC, prev, 0, "")
 				}
 
-				// Count nav nodes
-				tocNodeCount = len(nav.NavLinks)
+				// Count nav nodes including nested ones
+				tocNodeCount = countNavItems(tocNav.Items)
+			} else {
+				utils.DebugLog("[WARN:GenerateTOC] No toc nav found in navigation document")
 			}
 		}
 	}
@@ -434,12 +543,10 @@ func (e *Epub) generateTOC(spine []SpineItem, manifestItems map[string]ManifestI
 				_ = decoder.Decode(&ncx)
 				collectNavPointPaths(&ncx.NavPoints, tocPaths)
 			} else {
-				var nav Nav
-				decoder := xml.NewDecoder(tocFile)
-				_ = decoder.Decode(&nav)
-				for _, link := range nav.NavLinks {
-					path, _ := splitPathAndFragment(link.Href)
-					tocPaths[path] = true
+				if nav, navErr := parseNav(tocFile); navErr == nil {
+					if tocNav := nav.TOC(); tocNav != nil {
+						collectNavItemPaths(tocNav.Items, tocPaths)
+					}
 				}
 			}
 		}
@@ -588,6 +695,226 @@ func splitPathAndFragment(path string) (string, string) {
 	return parts[0], parts[1]
 }
 
+// openFile opens a file in the EPUB archive
+// Paths in the TOC are relative to the OPF file, so files are also looked up
+// relative to the RootDir and in the OEBPS directory
+func (e *Epub) openFile(name string) (io.ReadCloser, error) {
+	name = strings.TrimPrefix(name, "./")
+
+	file, err := e.File.Open(name)
+	if err == nil {
+		return file, nil
+	}
+
+	// The OPF directory comes first, multiple-rendition books have one per rendition
+	if e.RootDir != "" && !strings.HasPrefix(name, e.RootDir) {
+		rootDirPath := e.RootDir + strings.TrimPrefix(name, "OEBPS/")
+		utils.DebugLog("[INFO:openFile] Trying to find file relative to OPF directory: %s", rootDirPath)
+		if rootDirFile, rootDirErr := e.File.Open(rootDirPath); rootDirErr == nil {
+			return rootDirFile, nil
+		}
+	}
+
+	if !strings.HasPrefix(name, "OEBPS/") {
+		oebpsPath := "OEBPS/" + name
+		utils.DebugLog("[INFO:openFile] Trying to find file in OEBPS directory: %s", oebpsPath)
+		if oebpsFile, oebpsErr := e.File.Open(oebpsPath); oebpsErr == nil {
+			return oebpsFile, nil
+		}
+	}
+
+	return nil, err
+}
+
+// hasProperty checks if a space separated manifest properties list contains the property
+func hasProperty(properties string, property string) bool {
+	for _, p := range strings.Fields(properties) {
+		if p == property {
+			return true
+		}
+	}
+	return false
+}
+
+// FindChapterIndex returns the index of the TOC entry showing the given file
+// An entry with the same fragment is preferred, otherwise the first entry of the file is returned
+func (e *Epub) FindChapterIndex(path string, fragment string) (int, error) {
+	path = filepath.Clean(strings.TrimPrefix(path, "./"))
+
+	index := -1
+	for i, toc := range e.TOC.Slice {
+		if filepath.Clean(strings.TrimPrefix(toc.Path, "./")) != path {
+			continue
+		}
+		if toc.Fragment == fragment {
+			return i, nil
+		}
+		if index == -1 {
+			index = i
+		}
+	}
+
+	// Paths may be written relative to different directories, compare the file names
+	if index == -1 {
+		for i, toc := range e.TOC.Slice {
+			if filepath.Base(toc.Path) == filepath.Base(path) {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("no chapter found for %s", path)
+	}
+
+	return index, nil
+}
+
+// ResolveLink resolves a link found in a chapter to a path relative to the OPF directory
+// and a fragment, links to the same file only have a fragment
+func (e *Epub) ResolveLink(index int, href string) (string, string) {
+	linkPath, fragment := splitPathAndFragment(href)
+	chapterPath := strings.TrimPrefix(e.TOC.Slice[index].Path, "./")
+	if linkPath == "" {
+		return chapterPath, fragment
+	}
+	return resolveHref(chapterPath, linkPath), fragment
+}
+
+// FindAnchor returns the chapter showing the element with the given id and the line it lands on
+// A file can be split among several chapters by fragments, the file is parsed once and the chapter
+// holding the line of the anchor is picked, starting with the one the fragment belongs to
+func (e *Epub) FindAnchor(path string, fragment string) (int, int, error) {
+	index, err := e.FindChapterIndex(path, fragment)
+	if err != nil || fragment == "" {
+		return index, 0, err
+	}
+
+	chapterPath := strings.TrimPrefix(e.TOC.Slice[index].Path, "./")
+	file, err := e.parseFile(chapterPath)
+	if err != nil {
+		utils.DebugLog("[WARN:FindAnchor] Error parsing %s: %v", chapterPath, err)
+		return index, 0, nil
+	}
+	anchors := file.parser.GetAnchors()
+	line, ok := anchors[fragment]
+	if !ok {
+		utils.DebugLog("[WARN:FindAnchor] Anchor %s not found in %s", fragment, path)
+		return index, 0, nil
+	}
+
+	candidates := []int{index}
+	for i, toc := range e.TOC.Slice {
+		if i != index && filepath.Clean(strings.TrimPrefix(toc.Path, "./")) == filepath.Clean(chapterPath) {
+			candidates = append(candidates, i)
+		}
+	}
+	for _, i := range candidates {
+		start, end, ok := e.chapterLines(i, anchors, len(file.parser.GetLines()))
+		if ok && line >= start && line < end {
+			return i, line - start, nil
+		}
+	}
+
+	utils.DebugLog("[WARN:FindAnchor] No chapter of %s holds anchor %s", path, fragment)
+	return index, 0, nil
+}
+
+// chapterLines returns the lines of its file a chapter spans, from its anchor to the anchor of
+// the next chapter of the same file; ok is false when its anchor isn't in the lines
+func (e *Epub) chapterLines(index int, anchors map[string]int, count int) (start int, end int, ok bool) {
+	tocValue := e.TOC.Slice[index]
+	start, end = 0, count
+	if tocValue.Fragment != "" {
+		line, found := anchors[tocValue.Fragment]
+		if !found {
+			return 0, 0, false
+		}
+		start = line
+	}
+	if index < e.TOC.Len()-1 {
+		next := e.TOC.Slice[index+1]
+		if next.Path == tocValue.Path && next.Fragment != "" {
+			if line, found := anchors[next.Fragment]; found && line > start {
+				end = line
+			}
+		}
+	}
+	return start, end, true
+}
+
+// parsedFile is a chapter file parsed whole with the settings of the book at the time
+type parsedFile struct {
+	path     string
+	content  string
+	parser   *parser.HTMLParser
+	settings layoutSettings
+}
+
+// layoutSettings are the settings of the book a chapter file is laid out with
+type layoutSettings struct {
+	width      int
+	codeColors parser.CodeColors
+	ruby       parser.RubyMode
+	justify    bool
+	hyphenate  bool
+	images     bool
+	language   string
+}
+
+// layoutSettings returns the settings the chapter files are laid out with now
+func (e *Epub) layoutSettings() layoutSettings {
+	return layoutSettings{
+		width:      e.Width,
+		codeColors: e.CodeColors,
+		ruby:       e.Ruby,
+		justify:    e.Justify,
+		hyphenate:  e.Hyphenate,
+		images:     e.ImageSize != nil,
+		language:   e.Language,
+	}
+}
+
+// equal checks if two chapter files laid out with the settings are the same
+func (s layoutSettings) equal(other layoutSettings) bool {
+	return s.width == other.width && maps.Equal(s.codeColors, other.codeColors) && s.ruby == other.ruby &&
+		s.justify == other.justify && s.hyphenate == other.hyphenate && s.images == other.images &&
+		s.language == other.language
+}
+
+// parseFile reads a chapter file and lays it out whole, the file parsed last is kept for
+// the chapters split from it and the chapter read after a jump not to parse it again
+func (e *Epub) parseFile(chapterPath string) (*parsedFile, error) {
+	settings := e.layoutSettings()
+	if file := e.parsed; file != nil && file.path == chapterPath && file.settings.equal(settings) {
+		return file, nil
+	}
+
+	// try to open the chapter file, also looking in the OEBPS and OPF directories
+	chapterFile, err := e.openFile(chapterPath)
+	if err != nil {
+		return nil, err
+	}
+	defer chapterFile.Close()
+
+	content, err := io.ReadAll(chapterFile)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlParser := parser.NewHTMLParser()
+	htmlParser.SetWidth(e.Width)
+	htmlParser.SetCodeColors(e.CodeColors)
+	htmlParser.SetRubyMode(e.Ruby)
+	htmlParser.SetLanguage(e.Language)
+	htmlParser.SetJustify(e.Justify)
+	htmlParser.SetHyphenation(e.Hyphenate)
+	e.setImageSize(htmlParser, chapterPath)
+	htmlParser.SetStylesheetLoader(e.stylesheetLoader(chapterPath))
+	if err := htmlParser.Parse(string(content), "", ""); err != nil {
+		return nil, err
+	}
+	e.parsed = &parsedFile{path: chapterPath, content: string(content), parser: htmlParser, settings: settings}
+	return e.parsed, nil
+}
+
 func (e *Epub) GetChapterIndex(id string) (int, error) {
 	for i, toc := range e.TOC.Slice {
 		if toc.ID == id {
@@ -599,10 +926,25 @@ func (e *Epub) GetChapterIndex(id string) (int, error) {
 
 // GetChapterContents returns the content of a chapter
 // include text lines and images
+// Lines are the lines of Text, styled with tview tags, Plain are the same lines
+// without styles. Anchors maps the id (or name) of the elements of the chapter
+// to the line they land on. Bidi holds the lines written in visual order for
+// right-to-left text, Plain keeps them in logical order. TextLines tell where the text
+// of the chapter is in Plain, for searching it. Positions is the position
+// in the text of each line, which stays the same when the width changes. Boxes are
+// the places of the images drawn over the lines
 type ChapterContent struct {
-	Lines  []string
-	Text   string
-	Images []string
+	Lines     []string
+	Text      string
+	Plain     []string
+	TextLines []parser.TextLine
+	Bidi      map[int]parser.BidiLine
+	Positions []int
+	Boxes     []parser.ImageBox
+	Images    []parser.Image
+	NoteRefs  []parser.NoteRef
+	Links     []parser.Link
+	Anchors   map[string]int
 }
 
 func (e *Epub) GetChapterContents(index int) (*ChapterContent, error) {
@@ -621,83 +963,119 @@ func (e *Epub) GetChapterContents(index int) (*ChapterContent, error) {
 		chapterPath = chapterPath[2:]
 	}
 
-	// try to open the chapter file
-	chapterFile, err := e.File.Open(chapterPath)
+	// The whole file is parsed and the lines between the anchors of this chapter
+	// and the next one are kept, so elements cut by the anchors stay intact
+	file, err := e.parseFile(chapterPath)
 	if err != nil {
-		// if failed to open the chapter file, try to find it in OEBPS directory
-		if !strings.HasPrefix(chapterPath, "OEBPS/") {
-			oebpsPath := "OEBPS/" + chapterPath
-			utils.DebugLog("[INFO:GetChapterContents] Trying to find chapter in OEBPS directory: %s", oebpsPath)
+		return nil, err
+	}
+	htmlParser := file.parser
+	anchors := htmlParser.GetAnchors()
+	lines := htmlParser.GetLines()
+	plain := htmlParser.GetPlainLines()
+
+	start, end, ok := e.chapterLines(index, anchors, len(lines))
+	if !ok {
+		// Fall back to slicing the HTML between the anchors
+		utils.DebugLog("[WARN:GetChapterContents] Anchor %s not found, slicing the HTML", tocValue.Fragment)
+		return e.getChapterContentsBetweenAnchors(file.content, tocValue, nextTocValue)
+	}
 
-			// check if the file exists in OEBPS directory
-			oebpsFile, oebpsErr := e.File.Open(oebpsPath)
-			if oebpsErr == nil {
-				utils.DebugLog("[INFO:GetChapterContents] Found chapter in OEBPS directory")
-				chapterFile = oebpsFile
-				err = nil
-			} else {
-				// Try to find the file relative to the RootDir (OPF file's directory)
-				if e.RootDir != "" {
-					rootDirPath := e.RootDir + chapterPath
-					utils.DebugLog("[INFO:GetChapterContents] Trying to find chapter relative to OPF directory: %s", rootDirPath)
-
-					rootDirFile, rootDirErr := e.File.Open(rootDirPath)
-					if rootDirErr == nil {
-						utils.DebugLog("[INFO:GetChapterContents] Found chapter relative to OPF directory")
-						chapterFile = rootDirFile
-						err = nil
-					} else {
-						return nil, err // if not found in RootDir, return the original error
-					}
-				} else {
-					return nil, err // if not found in OEBPS directory, return the original error
-				}
-			}
-		} else {
-			// Try to find the file relative to the RootDir (OPF file's directory)
-			if e.RootDir != "" && !strings.HasPrefix(chapterPath, e.RootDir) {
-				rootDirPath := e.RootDir + strings.TrimPrefix(chapterPath, "OEBPS/")
-				utils.DebugLog("[INFO:GetChapterContents] Trying to find chapter relative to OPF directory: %s", rootDirPath)
-
-				rootDirFile, rootDirErr := e.File.Open(rootDirPath)
-				if rootDirErr == nil {
-					utils.DebugLog("[INFO:GetChapterContents] Found chapter relative to OPF directory")
-					chapterFile = rootDirFile
-					err = nil
-				} else {
-					return nil, err // if not found in RootDir, return the original error
-				}
-			} else {
-				return nil, err
-			}
+	// Anchors are relative to the first line of the chapter
+	chapterAnchors := make(map[string]int)
+	for id, line := range anchors {
+		if line >= start && line < end {
+			chapterAnchors[id] = line - start
+		}
+	}
+	bidi := make(map[int]parser.BidiLine)
+	for line, b := range htmlParser.GetBidiLines() {
+		if line >= start && line < end {
+			bidi[line-start] = b
 		}
 	}
-	defer chapterFile.Close()
 
-	content, err := io.ReadAll(chapterFile)
-	if err != nil {
-		return nil, err
+	// Positions are counted from the start of the chapter
+	positions := make([]int, end-start)
+	for i, pos := range htmlParser.GetPositions()[start:end] {
+		positions[i] = pos - htmlParser.GetPositions()[start]
 	}
+	var boxes []parser.ImageBox
+	for _, box := range htmlParser.GetImageBoxes() {
+		if box.Line >= start && box.Line < end {
+			box.Line -= start
+			boxes = append(boxes, box)
+		}
+	}
+
+	return &ChapterContent{
+		Lines:     lines[start:end],
+		Text:      strings.Join(lines[start:end], "\n"),
+		Plain:     plain[start:end],
+		TextLines: htmlParser.GetTextLines()[start:end],
+		Bidi:      bidi,
+		Positions: positions,
+		Boxes:     boxes,
+		Images:    htmlParser.GetImages(),
+		NoteRefs:  htmlParser.GetNoteRefs(),
+		Links:     htmlParser.GetLinks(),
+		Anchors:   chapterAnchors,
+	}, nil
+}
 
+// getChapterContentsBetweenAnchors parses only the HTML between the anchors of the chapter
+// and the next one, used when the anchor can't be found in the parsed file
+func (e *Epub) getChapterContentsBetweenAnchors(content string, tocValue TOCValue, nextTocValue TOCValue) (*ChapterContent, error) {
 	parser := parser.NewHTMLParser()
-	// automatically get the next chapter's fragment
+	parser.SetWidth(e.Width)
+	parser.SetCodeColors(e.CodeColors)
+	parser.SetRubyMode(e.Ruby)
+	parser.SetLanguage(e.Language)
+	parser.SetJustify(e.Justify)
+	parser.SetHyphenation(e.Hyphenate)
+	e.setImageSize(parser, strings.TrimPrefix(tocValue.Path, "./"))
+	parser.SetStylesheetLoader(e.stylesheetLoader(strings.TrimPrefix(tocValue.Path, "./")))
 	if tocValue.Path == nextTocValue.Path {
-		if err := parser.Parse(string(content), tocValue.Fragment, nextTocValue.Fragment); err != nil {
+		if err := parser.Parse(content, tocValue.Fragment, nextTocValue.Fragment); err != nil {
 			return nil, err
 		}
 	} else {
-		if err := parser.Parse(string(content), tocValue.Fragment, ""); err != nil {
+		if err := parser.Parse(content, tocValue.Fragment, ""); err != nil {
 			return nil, err
 		}
 	}
 
 	return &ChapterContent{
-		Lines:  parser.GetLines(),
-		Text:   strings.Join(parser.GetLines(), "\n"),
-		Images: parser.GetImages(),
+		Lines:     parser.GetLines(),
+		Text:      strings.Join(parser.GetLines(), "\n"),
+		Plain:     parser.GetPlainLines(),
+		TextLines: parser.GetTextLines(),
+		Bidi:      parser.GetBidiLines(),
+		Positions: parser.GetPositions(),
+		Boxes:     parser.GetImageBoxes(),
+		Images:    parser.GetImages(),
+		NoteRefs:  parser.GetNoteRefs(),
+		Links:     parser.GetLinks(),
+		Anchors:   parser.GetAnchors(),
 	}, nil
 }
 
+// setImageSize gives the parser of a chapter the size of its images, their sources
+// are relative to the chapter
+func (e *Epub) setImageSize(p *parser.HTMLParser, chapterPath string) {
+	if e.ImageSize == nil {
+		return
+	}
+	p.SetImageSize(func(src string) parser.ImageSize {
+		return e.ImageSize(ImagePath(chapterPath, src))
+	})
+}
+
+// IsRTL checks if the pages of the book progress from right to left
+func (e *Epub) IsRTL() bool {
+	return e.PageProgressionDirection == "rtl"
+}
+
 // Close closes the EPUB file
 func (e *Epub) Close() error {
 	return e.File.Close()
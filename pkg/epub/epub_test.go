@@ -0,0 +1,358 @@
+package epub
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const container = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+// writeEpub writes a book holding the files to a temporary directory and returns its path,
+// the books without a META-INF/container.xml get one pointing to OEBPS/content.opf
+func writeEpub(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "book.epub")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	if _, ok := files["META-INF/container.xml"]; !ok {
+		files["META-INF/container.xml"] = container
+	}
+	for name, content := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// openEpub writes a book holding the files and opens it
+func openEpub(t *testing.T, files map[string]string) *Epub {
+	t.Helper()
+	book, err := NewEpub(writeEpub(t, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { book.Close() })
+	return book
+}
+
+// opf returns a package document of the version holding the metadata, manifest, spine and guide
+func opf(version string, body string) string {
+	return `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="` + version + `">` + body + `</package>`
+}
+
+// xhtml returns a chapter file with the body
+func xhtml(body string) string {
+	return `<?xml version="1.0"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><body>` + body + `</body></html>`
+}
+
+func TestTOCTree(t *testing.T) {
+	nav := xhtml(`<nav epub:type="toc"><ol>
+<li><a href="ch1.xhtml">One</a></li>
+<li><span>Part <em>Two</em></span><ol>
+  <li><a href="ch2.xhtml#s1">Section 1</a></li>
+  <li><a href="ch2.xhtml#s2">Section 2</a></li>
+</ol></li>
+</ol></nav>`)
+	ncx := `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1"><navMap>
+<navPoint id="n1"><navLabel><text>One</text></navLabel><content src="ch1.xhtml"/></navPoint>
+<navPoint id="n2"><navLabel><text>Part Two</text></navLabel><content src="ch2.xhtml#s1"/>
+  <navPoint id="n3"><navLabel><text>Section 1</text></navLabel><content src="ch2.xhtml#s1"/></navPoint>
+  <navPoint id="n4"><navLabel><text>Section 2</text></navLabel><content src="ch2.xhtml#s2"/></navPoint>
+</navPoint>
+</navMap></ncx>`
+	chapters := `<item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+<item id="ch2" href="ch2.xhtml" media-type="application/xhtml+xml"/>`
+	spine := `<itemref idref="ch1"/><itemref idref="ch2"/>`
+
+	// The entries of the fixtures without a parent have -1
+	type entry struct {
+		title    string
+		path     string
+		fragment string
+		level    int
+		isDir    bool
+		isShadow bool
+		parent   int
+	}
+	tree := []entry{
+		{title: "One", path: "ch1.xhtml", parent: -1},
+		{title: "Part Two", path: "ch2.xhtml", fragment: "s1", isDir: true, parent: -1},
+		{title: "Section 1", path: "ch2.xhtml", fragment: "s1", level: 1, parent: 1},
+		{title: "Section 2", path: "ch2.xhtml", fragment: "s2", level: 1, parent: 1},
+	}
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []entry
+	}{
+		{
+			name: "navigation document",
+			files: map[string]string{
+				"OEBPS/content.opf": opf("3.0", `<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`+chapters+`</manifest>
+<spine>`+spine+`</spine>`),
+				"OEBPS/nav.xhtml": nav,
+			},
+			want: tree,
+		},
+		{
+			name: "NCX",
+			files: map[string]string{
+				"OEBPS/content.opf": opf("2.0", `<manifest>
+<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>`+chapters+`</manifest>
+<spine toc="ncx">`+spine+`</spine>`),
+				"OEBPS/toc.ncx": ncx,
+			},
+			want: tree,
+		},
+		{
+			name: "spine files missing from the NCX",
+			files: map[string]string{
+				"OEBPS/content.opf": opf("2.0", `<manifest>
+<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>`+chapters+`</manifest>
+<spine toc="ncx">`+spine+`</spine>`),
+				"OEBPS/toc.ncx": `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1"><navMap>
+<navPoint id="n1"><navLabel><text>One</text></navLabel><content src="ch1.xhtml"/></navPoint>
+</navMap></ncx>`,
+			},
+			want: []entry{
+				{title: "One", path: "ch1.xhtml", parent: -1},
+				{title: "ch2", path: "ch2.xhtml", isShadow: true, parent: -1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt.files["OEBPS/ch1.xhtml"] = xhtml(`<p>One</p>`)
+		tt.files["OEBPS/ch2.xhtml"] = xhtml(`<h1 id="s1">Section 1</h1><h1 id="s2">Section 2</h1>`)
+		book := openEpub(t, tt.files)
+
+		toc := book.TOC.Slice
+		if len(toc) != len(tt.want) {
+			t.Errorf("%s: %d entries, want %d", tt.name, len(toc), len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			got := entry{
+				title:    toc[i].Title,
+				path:     toc[i].Path,
+				fragment: toc[i].Fragment,
+				level:    toc[i].Level,
+				isDir:    toc[i].IsDir,
+				isShadow: toc[i].IsShadow,
+				parent:   -1,
+			}
+			for j := range toc {
+				if toc[i].ParentID != "" && toc[j].ID == toc[i].ParentID {
+					got.parent = j
+				}
+			}
+			if toc[i].ParentID != "" && got.parent == -1 {
+				t.Errorf("%s: entry %d has an unknown parent %q", tt.name, i, toc[i].ParentID)
+			}
+			if got != want {
+				t.Errorf("%s: entry %d = %+v, want %+v", tt.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestSpine(t *testing.T) {
+	manifest := `<manifest>
+<item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+<item id="answers" href="text/answers.xhtml" media-type="application/xhtml+xml"/>
+<item id="ch2" href="ch2.xhtml" media-type="application/xhtml+xml"/>
+</manifest>`
+	tests := []struct {
+		spine     string
+		nonLinear []bool
+		rtl       bool
+	}{
+		{
+			spine:     `<spine><itemref idref="ch1"/><itemref idref="answers"/><itemref idref="ch2"/></spine>`,
+			nonLinear: []bool{false, false, false},
+		},
+		{
+			spine:     `<spine><itemref idref="ch1"/><itemref idref="answers" linear="no"/><itemref idref="ch2" linear="yes"/></spine>`,
+			nonLinear: []bool{false, true, false},
+		},
+		{
+			spine:     `<spine page-progression-direction="rtl"><itemref idref="ch1" linear="no"/><itemref idref="answers"/><itemref idref="ch2"/></spine>`,
+			nonLinear: []bool{true, false, false},
+			rtl:       true,
+		},
+		{
+			spine:     `<spine page-progression-direction="ltr"><itemref idref="ch1"/><itemref idref="answers"/><itemref idref="ch2"/></spine>`,
+			nonLinear: []bool{false, false, false},
+		},
+	}
+	for _, tt := range tests {
+		book := openEpub(t, map[string]string{
+			"OEBPS/content.opf":        opf("3.0", manifest+tt.spine),
+			"OEBPS/ch1.xhtml":          xhtml(`<p>One</p>`),
+			"OEBPS/text/answers.xhtml": xhtml(`<p>Answers</p>`),
+			"OEBPS/ch2.xhtml":          xhtml(`<p>Two</p>`),
+		})
+
+		var nonLinear []bool
+		for _, toc := range book.TOC.Slice {
+			nonLinear = append(nonLinear, toc.IsNonLinear)
+		}
+		if !reflect.DeepEqual(nonLinear, tt.nonLinear) {
+			t.Errorf("%s: IsNonLinear = %v, want %v", tt.spine, nonLinear, tt.nonLinear)
+		}
+		if got := book.IsRTL(); got != tt.rtl {
+			t.Errorf("%s: IsRTL() = %v, want %v", tt.spine, got, tt.rtl)
+		}
+	}
+}
+
+func TestFollowLinks(t *testing.T) {
+	book := openEpub(t, map[string]string{
+		"OEBPS/content.opf": opf("3.0", `<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="ch1" href="text/ch1.xhtml" media-type="application/xhtml+xml"/>
+<item id="ch2" href="text/ch2.xhtml" media-type="application/xhtml+xml"/>
+<item id="a" href="appendix/a.xhtml" media-type="application/xhtml+xml"/>
+</manifest>
+<spine><itemref idref="ch1"/><itemref idref="ch2"/><itemref idref="a"/></spine>`),
+		"OEBPS/nav.xhtml": xhtml(`<nav epub:type="toc"><ol>
+<li><a href="text/ch1.xhtml">One</a></li>
+<li><a href="text/ch2.xhtml">Two</a><ol><li><a href="text/ch2.xhtml#sec2">Two.Two</a></li></ol></li>
+<li><a href="appendix/a.xhtml">Appendix</a></li>
+</ol></nav>`),
+		"OEBPS/text/ch1.xhtml": xhtml(`<p id="top">See <a href="ch2.xhtml#sec2">section 2</a>,
+<a href="https://example.com/">the site</a> or <a href="mailto:a@example.com">write</a>.</p>`),
+		"OEBPS/text/ch2.xhtml":   xhtml(`<h1 id="sec1">One</h1><h1 id="sec2">Two</h1>`),
+		"OEBPS/appendix/a.xhtml": xhtml(`<p id="x">Appendix</p>`),
+	})
+	book.Width = 40
+
+	// Only the links into the book are kept
+	content, err := book.GetChapterContents(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content.Links) != 1 || content.Links[0].Href != "ch2.xhtml#sec2" {
+		t.Errorf("Links = %+v, want the link to ch2.xhtml#sec2", content.Links)
+	}
+
+	tests := []struct {
+		index    int
+		href     string
+		path     string
+		fragment string
+		chapter  int
+	}{
+		{index: 0, href: "ch2.xhtml#sec2", path: "text/ch2.xhtml", fragment: "sec2", chapter: 2},
+		{index: 0, href: "ch2.xhtml", path: "text/ch2.xhtml", chapter: 1},
+		{index: 0, href: "#top", path: "text/ch1.xhtml", fragment: "top", chapter: 0},
+		{index: 2, href: "#sec1", path: "text/ch2.xhtml", fragment: "sec1", chapter: 1},
+		{index: 1, href: "../appendix/a.xhtml#x", path: "appendix/a.xhtml", fragment: "x", chapter: 3},
+		{index: 0, href: "./ch2.xhtml#sec2", path: "text/ch2.xhtml", fragment: "sec2", chapter: 2},
+		{index: 3, href: "../ch1.xhtml", path: "ch1.xhtml", chapter: 0}, // Found by the file name
+		{index: 0, href: "missing.xhtml", path: "text/missing.xhtml", chapter: -1},
+	}
+	for _, tt := range tests {
+		path, fragment := book.ResolveLink(tt.index, tt.href)
+		if path != tt.path || fragment != tt.fragment {
+			t.Errorf("ResolveLink(%d, %q) = %q, %q, want %q, %q", tt.index, tt.href, path, fragment, tt.path, tt.fragment)
+		}
+		chapter, err := book.FindChapterIndex(path, fragment)
+		if chapter != tt.chapter || (err != nil) != (tt.chapter == -1) {
+			t.Errorf("FindChapterIndex(%q, %q) = %d, %v, want %d", path, fragment, chapter, err, tt.chapter)
+		}
+	}
+}
+
+func TestChaptersSplitByAnchors(t *testing.T) {
+	book := openEpub(t, map[string]string{
+		"OEBPS/content.opf": opf("2.0", `<manifest>
+<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+<item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/>
+</manifest>
+<spine toc="ncx"><itemref idref="ch"/></spine>`),
+		"OEBPS/toc.ncx": `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1"><navMap>
+<navPoint id="n1"><navLabel><text>Start</text></navLabel><content src="ch.xhtml"/></navPoint>
+<navPoint id="n2"><navLabel><text>B</text></navLabel><content src="ch.xhtml#b"/></navPoint>
+<navPoint id="n3"><navLabel><text>C</text></navLabel><content src="ch.xhtml#c"/></navPoint>
+</navMap></ncx>`,
+		"OEBPS/ch.xhtml": xhtml(`<p>Intro</p>
+<h2 id="a">A</h2><p>a1</p><p id="a2">a2</p>
+<div><h2 id="b">B</h2><p>b1 <span id="b1">b1b</span></p></div>
+<h2 id="c">C</h2><p>c1 <a href="#a2">back</a></p>`),
+	})
+	book.Width = 40
+
+	tests := []struct {
+		chapter int
+		words   []string
+		anchors []string
+	}{
+		{chapter: 0, words: []string{"Intro", "A", "a1", "a2"}, anchors: []string{"a", "a2"}},
+		{chapter: 1, words: []string{"B", "b1", "b1b"}, anchors: []string{"b", "b1"}},
+		{chapter: 2, words: []string{"C", "c1", "back[→1]"}, anchors: []string{"c"}},
+	}
+	anchors := make(map[string][2]int) // Chapter and line of each anchor
+	for _, tt := range tests {
+		content, err := book.GetChapterContents(tt.chapter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if words := strings.Fields(strings.Join(content.Plain, " ")); !reflect.DeepEqual(words, tt.words) {
+			t.Errorf("chapter %d: words = %q, want %q", tt.chapter, words, tt.words)
+		}
+		var ids []string
+		for id, line := range content.Anchors {
+			ids = append(ids, id)
+			anchors[id] = [2]int{tt.chapter, line}
+		}
+		sort.Strings(ids)
+		if !reflect.DeepEqual(ids, tt.anchors) {
+			t.Errorf("chapter %d: anchors = %q, want %q", tt.chapter, ids, tt.anchors)
+		}
+		if len(content.Positions) != len(content.Lines) || content.Positions[0] != 0 {
+			t.Errorf("chapter %d: positions %v don't start at 0 for %d lines", tt.chapter, content.Positions, len(content.Lines))
+		}
+	}
+
+	for _, id := range []string{"a", "a2", "b", "b1", "c"} {
+		chapter, line, err := book.FindAnchor("ch.xhtml", id)
+		if err != nil || [2]int{chapter, line} != anchors[id] {
+			t.Errorf("FindAnchor(ch.xhtml, %q) = %d, %d, %v, want %d, %d", id, chapter, line, err, anchors[id][0], anchors[id][1])
+		}
+	}
+	for _, fragment := range []string{"", "missing"} {
+		chapter, line, err := book.FindAnchor("ch.xhtml", fragment)
+		if err != nil || chapter != 0 || line != 0 {
+			t.Errorf("FindAnchor(ch.xhtml, %q) = %d, %d, %v, want 0, 0", fragment, chapter, line, err)
+		}
+	}
+}
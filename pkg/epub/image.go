@@ -0,0 +1,85 @@
+package epub
+
+import (
+	"io"
+	"strings"
+
+	"github.com/ray-d-song/goread/pkg/parser"
+	"github.com/ray-d-song/goread/pkg/utils"
+)
+
+// BookImage is an image of the book
+type BookImage struct {
+	Path    string       // Archive path of the image
+	Chapter int          // Index of the chapter of its file
+	Index   int          // Index of the image in the images of its file
+	Image   parser.Image // Source and text describing the image
+}
+
+// ImagePath returns the archive path of an image from its source in a chapter
+func ImagePath(chapterPath string, src string) string {
+	return resolveHref(strings.TrimPrefix(chapterPath, "./"), src)
+}
+
+// ReadImage reads an image of the archive
+func (e *Epub) ReadImage(path string) ([]byte, error) {
+	file, err := e.openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// GetBookImages returns the images of the book in reading order, the file of each chapter is read once
+// The images are found once per book
+func (e *Epub) GetBookImages() []BookImage {
+	if e.bookImages != nil {
+		return e.bookImages
+	}
+	e.bookImages = []BookImage{}
+	// The chapter of a file is its last entry without a fragment (a part holding
+	// the chapter may come before it), or its first entry
+	chapters := make(map[string]int)
+	var paths []string
+	for index, tocValue := range e.TOC.Slice {
+		chapterPath := strings.TrimPrefix(tocValue.Path, "./")
+		if _, seen := chapters[chapterPath]; !seen {
+			paths = append(paths, chapterPath)
+			chapters[chapterPath] = index
+		} else if tocValue.Fragment == "" {
+			chapters[chapterPath] = index
+		}
+	}
+
+	for _, chapterPath := range paths {
+		index := chapters[chapterPath]
+
+		file, err := e.openFile(chapterPath)
+		if err != nil {
+			utils.DebugLog("[WARN:GetBookImages] Can't open chapter %s: %v", chapterPath, err)
+			continue
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			continue
+		}
+
+		htmlParser := parser.NewHTMLParser()
+		htmlParser.SetStylesheetLoader(e.stylesheetLoader(chapterPath))
+		if err := htmlParser.Parse(string(content), "", ""); err != nil {
+			utils.DebugLog("[WARN:GetBookImages] Can't parse chapter %s: %v", chapterPath, err)
+			continue
+		}
+		for i, image := range htmlParser.GetImages() {
+			e.bookImages = append(e.bookImages, BookImage{
+				Path:    ImagePath(chapterPath, image.Src),
+				Chapter: index,
+				Index:   i,
+				Image:   image,
+			})
+		}
+	}
+	return e.bookImages
+}
@@ -1,6 +1,150 @@
 package epub
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metadata represents EPUB metadata
+type Metadata struct {
+	Titles       []Title
+	Creators     []Contributor
+	Contributors []Contributor
+	Identifiers  []Identifier
+	Subjects     []string
+	Series       []Series
+	Publisher    string
+	Language     string
+	Date         string
+	Modified     string
+	Description  string
+	Rights       string
+	OtherMeta    [][]string
+}
+
+// Title represents a dc:title, Type is main, subtitle, short, collection, edition or expanded
+type Title struct {
+	Value  string
+	Type   string
+	FileAs string
+	seq    int // display-seq, 0 if not set
+}
+
+// Contributor represents a dc:creator or dc:contributor
+// Roles are MARC relator codes (aut, edt, trl, ...)
+type Contributor struct {
+	Name   string
+	FileAs string
+	Roles  []string
+	seq    int // display-seq, 0 if not set
+}
+
+// Identifier represents a dc:identifier with its scheme (ISBN, UUID, DOI, ...)
+type Identifier struct {
+	Value  string
+	Scheme string
+}
+
+// Series represents a collection the book belongs to
+// Position is the index of the book in the series, Type is series or set
+type Series struct {
+	Name     string
+	Type     string
+	Position string
+}
+
+// refinement represents an EPUB 3.0 <meta refines="#id" property="..."> entry
+type refinement struct {
+	Property string
+	Scheme   string
+	Value    string
+}
+
+// relatorNames maps the common MARC relator codes to readable names
+var relatorNames = map[string]string{
+	"aut": "Author",
+	"edt": "Editor",
+	"trl": "Translator",
+	"ill": "Illustrator",
+	"nrt": "Narrator",
+	"aui": "Author of introduction",
+	"aft": "Author of afterword",
+	"ann": "Annotator",
+	"art": "Artist",
+	"cov": "Cover designer",
+	"ctb": "Contributor",
+	"com": "Compiler",
+	"pht": "Photographer",
+	"pbl": "Publisher",
+	"bkp": "Book producer",
+	"dsr": "Designer",
+}
+
+// RoleName returns the readable name of a MARC relator code
+func RoleName(role string) string {
+	if name, ok := relatorNames[strings.ToLower(role)]; ok {
+		return name
+	}
+	return role
+}
+
+// MainTitle returns the main title of the book
+func (m *Metadata) MainTitle() string {
+	for _, title := range m.Titles {
+		if title.Type == "" || title.Type == "main" {
+			return title.Value
+		}
+	}
+	if len(m.Titles) > 0 {
+		return m.Titles[0].Value
+	}
+	return ""
+}
+
+// seqLess orders by display-seq, entries without one (0) keep their document order after the others
+func seqLess(i int, j int) bool {
+	if i == 0 || j == 0 {
+		return i != 0 && j == 0
+	}
+	return i < j
+}
+
+// attrValue returns the value of the attribute with the given local name
+// The namespace is ignored, so opf:role and role are the same
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, attr := range attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// identifierScheme guesses the scheme of an identifier from its value
+func identifierScheme(value string) string {
+	lower := strings.ToLower(value)
+	switch {
+	case strings.HasPrefix(lower, "urn:isbn:"), strings.HasPrefix(lower, "isbn:"):
+		return "ISBN"
+	case strings.HasPrefix(lower, "urn:uuid:"), strings.HasPrefix(lower, "uuid:"):
+		return "UUID"
+	case strings.HasPrefix(lower, "urn:doi:"), strings.HasPrefix(lower, "doi:"):
+		return "DOI"
+	}
+	return ""
+}
+
+// onixIdentifierTypes maps the ONIX codelist 5 codes used by identifier-type refinements
+var onixIdentifierTypes = map[string]string{
+	"01": "Proprietary",
+	"02": "ISBN-10",
+	"03": "GTIN-13",
+	"06": "DOI",
+	"15": "ISBN-13",
+	"22": "URN",
+}
 
 // GetMetadata returns the metadata of the EPUB
 func (e *Epub) GetMetadata() (*Metadata, error) {
@@ -18,32 +162,170 @@ func (e *Epub) GetMetadata() (*Metadata, error) {
 		return nil, err
 	}
 
+	// First collect the EPUB 3.0 refinements, they can appear before or after the element they refine
+	refines := make(map[string][]refinement)
+	for _, item := range pkg.Metadata.Items {
+		if item.XMLName.Local != "meta" {
+			continue
+		}
+		if target := attrValue(item.Attrs, "refines"); target != "" {
+			id := strings.TrimPrefix(target, "#")
+			refines[id] = append(refines[id], refinement{
+				Property: attrValue(item.Attrs, "property"),
+				Scheme:   attrValue(item.Attrs, "scheme"),
+				Value:    strings.TrimSpace(item.Content),
+			})
+		}
+	}
+
 	metadata := &Metadata{}
+	var languages []string
+	calibreSeries := Series{Type: "series"}
 
-	for _, item := range pkg.Metadata {
+	for _, item := range pkg.Metadata.Items {
 		tagName := item.XMLName.Local
+		content := strings.TrimSpace(item.Content)
+		itemRefines := refines[attrValue(item.Attrs, "id")]
 
 		switch tagName {
 		case "title":
-			metadata.Title = item.Content
-		case "creator":
-			metadata.Creator = item.Content
+			title := Title{
+				Value:  content,
+				FileAs: attrValue(item.Attrs, "file-as"),
+			}
+			for _, ref := range itemRefines {
+				switch ref.Property {
+				case "title-type":
+					title.Type = ref.Value
+				case "file-as":
+					title.FileAs = ref.Value
+				case "display-seq":
+					if seq, err := strconv.Atoi(ref.Value); err == nil {
+						title.seq = seq
+					}
+				}
+			}
+			metadata.Titles = append(metadata.Titles, title)
+		case "creator", "contributor":
+			contributor := Contributor{
+				Name:   content,
+				FileAs: attrValue(item.Attrs, "file-as"),
+			}
+			if role := attrValue(item.Attrs, "role"); role != "" {
+				contributor.Roles = append(contributor.Roles, role)
+			}
+			for _, ref := range itemRefines {
+				switch ref.Property {
+				case "role":
+					contributor.Roles = append(contributor.Roles, ref.Value)
+				case "file-as":
+					contributor.FileAs = ref.Value
+				case "display-seq":
+					if seq, err := strconv.Atoi(ref.Value); err == nil {
+						contributor.seq = seq
+					}
+				}
+			}
+			if tagName == "creator" {
+				metadata.Creators = append(metadata.Creators, contributor)
+			} else {
+				metadata.Contributors = append(metadata.Contributors, contributor)
+			}
+		case "identifier":
+			identifier := Identifier{
+				Value:  content,
+				Scheme: attrValue(item.Attrs, "scheme"),
+			}
+			for _, ref := range itemRefines {
+				if ref.Property == "identifier-type" {
+					if name, ok := onixIdentifierTypes[ref.Value]; ok && strings.HasPrefix(ref.Scheme, "onix:") {
+						identifier.Scheme = name
+					} else {
+						identifier.Scheme = ref.Value
+					}
+				}
+			}
+			if identifier.Scheme == "" {
+				identifier.Scheme = identifierScheme(content)
+			}
+			metadata.Identifiers = append(metadata.Identifiers, identifier)
+		case "subject":
+			metadata.Subjects = append(metadata.Subjects, content)
 		case "publisher":
-			metadata.Publisher = item.Content
+			metadata.Publisher = content
 		case "language":
-			metadata.Language = item.Content
-		case "identifier":
-			metadata.Identifier = item.Content
+			languages = append(languages, content)
 		case "date":
-			metadata.Date = item.Content
+			metadata.Date = content
 		case "description":
-			metadata.Description = item.Content
+			metadata.Description = content
 		case "rights":
-			metadata.Rights = item.Content
+			metadata.Rights = content
+		case "meta":
+			// Refinements have been applied to the elements they refine
+			if attrValue(item.Attrs, "refines") != "" {
+				continue
+			}
+
+			// EPUB 3.0: <meta property="...">value</meta>
+			if property := attrValue(item.Attrs, "property"); property != "" {
+				switch property {
+				case "dcterms:modified":
+					metadata.Modified = content
+				case "belongs-to-collection":
+					series := Series{Name: content}
+					for _, ref := range itemRefines {
+						switch ref.Property {
+						case "collection-type":
+							series.Type = ref.Value
+						case "group-position":
+							series.Position = ref.Value
+						}
+					}
+					metadata.Series = append(metadata.Series, series)
+				default:
+					metadata.OtherMeta = append(metadata.OtherMeta, []string{property, content})
+				}
+				continue
+			}
+
+			// EPUB 2.0: <meta name="..." content="..."/>
+			name := attrValue(item.Attrs, "name")
+			value := attrValue(item.Attrs, "content")
+			switch name {
+			case "calibre:series":
+				calibreSeries.Name = value
+			case "calibre:series_index":
+				calibreSeries.Position = value
+			case "":
+			default:
+				metadata.OtherMeta = append(metadata.OtherMeta, []string{name, value})
+			}
 		default:
-			metadata.OtherMeta = append(metadata.OtherMeta, []string{tagName, item.Content})
+			metadata.OtherMeta = append(metadata.OtherMeta, []string{tagName, content})
 		}
 	}
 
+	metadata.Language = strings.Join(languages, ", ")
+	if calibreSeries.Name != "" {
+		metadata.Series = append(metadata.Series, calibreSeries)
+	}
+
+	// Main titles first, then in display order
+	sort.SliceStable(metadata.Titles, func(i, j int) bool {
+		iMain := metadata.Titles[i].Type == "" || metadata.Titles[i].Type == "main"
+		jMain := metadata.Titles[j].Type == "" || metadata.Titles[j].Type == "main"
+		if iMain != jMain {
+			return iMain
+		}
+		return seqLess(metadata.Titles[i].seq, metadata.Titles[j].seq)
+	})
+	sort.SliceStable(metadata.Creators, func(i, j int) bool {
+		return seqLess(metadata.Creators[i].seq, metadata.Creators[j].seq)
+	})
+	sort.SliceStable(metadata.Contributors, func(i, j int) bool {
+		return seqLess(metadata.Contributors[i].seq, metadata.Contributors[j].seq)
+	})
+
 	return metadata, nil
 }
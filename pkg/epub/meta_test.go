@@ -0,0 +1,200 @@
+package epub
+
+import (
+	"reflect"
+	"testing"
+)
+
+// readMetadata opens a book with the metadata and returns what GetMetadata makes of it
+func readMetadata(t *testing.T, version string, metadata string) *Metadata {
+	t.Helper()
+	book := openEpub(t, map[string]string{
+		"OEBPS/content.opf": opf(version, `<metadata xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:opf="http://www.idpf.org/2007/opf">`+metadata+`</metadata>
+<manifest><item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/></manifest>
+<spine><itemref idref="ch1"/></spine>`),
+		"OEBPS/ch1.xhtml": xhtml(`<p>One</p>`),
+	})
+	m, err := book.GetMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMetadataTitles(t *testing.T) {
+	tests := []struct {
+		metadata string
+		want     []Title
+		main     string
+	}{
+		{
+			metadata: `<dc:title>Moby-Dick</dc:title>`,
+			want:     []Title{{Value: "Moby-Dick"}},
+			main:     "Moby-Dick",
+		},
+		{
+			metadata: `<dc:title id="sub">Or, the Whale</dc:title>
+<meta refines="#sub" property="title-type">subtitle</meta>
+<meta refines="#sub" property="display-seq">2</meta>
+<dc:title id="t">Moby-Dick</dc:title>
+<meta refines="#t" property="title-type">main</meta>
+<meta refines="#t" property="display-seq">1</meta>
+<meta refines="#t" property="file-as">Moby Dick</meta>`,
+			want: []Title{
+				{Value: "Moby-Dick", Type: "main", FileAs: "Moby Dick", seq: 1},
+				{Value: "Or, the Whale", Type: "subtitle", seq: 2},
+			},
+			main: "Moby-Dick",
+		},
+		{
+			metadata: `<meta refines="#c" property="title-type">collection</meta>
+<dc:title id="c">Great Novels</dc:title>
+<dc:title id="e">Second Edition</dc:title>
+<meta refines="#e" property="title-type">edition</meta>`,
+			want: []Title{
+				{Value: "Great Novels", Type: "collection"},
+				{Value: "Second Edition", Type: "edition"},
+			},
+			main: "Great Novels", // No main title, the first one stands in
+		},
+	}
+	for _, tt := range tests {
+		m := readMetadata(t, "3.0", tt.metadata)
+		if !reflect.DeepEqual(m.Titles, tt.want) {
+			t.Errorf("%s: Titles = %+v, want %+v", tt.metadata, m.Titles, tt.want)
+		}
+		if got := m.MainTitle(); got != tt.main {
+			t.Errorf("%s: MainTitle() = %q, want %q", tt.metadata, got, tt.main)
+		}
+	}
+}
+
+func TestMetadataContributors(t *testing.T) {
+	tests := []struct {
+		version      string
+		metadata     string
+		creators     []Contributor
+		contributors []Contributor
+	}{
+		{
+			version: "2.0",
+			metadata: `<dc:creator opf:role="aut" opf:file-as="Melville, Herman">Herman Melville</dc:creator>
+<dc:contributor opf:role="ill">Rockwell Kent</dc:contributor>`,
+			creators:     []Contributor{{Name: "Herman Melville", FileAs: "Melville, Herman", Roles: []string{"aut"}}},
+			contributors: []Contributor{{Name: "Rockwell Kent", Roles: []string{"ill"}}},
+		},
+		{
+			version: "3.0",
+			metadata: `<dc:creator id="b">Jane Roe</dc:creator>
+<meta refines="#b" property="role" scheme="marc:relators">aut</meta>
+<meta refines="#b" property="display-seq">2</meta>
+<dc:creator id="a">John Doe</dc:creator>
+<meta refines="#a" property="role" scheme="marc:relators">aut</meta>
+<meta refines="#a" property="role" scheme="marc:relators">ill</meta>
+<meta refines="#a" property="file-as">Doe, John</meta>
+<meta refines="#a" property="display-seq">1</meta>
+<dc:creator>Anonymous</dc:creator>
+<dc:contributor id="t">Ann Smith</dc:contributor>
+<meta refines="#t" property="role" scheme="marc:relators">trl</meta>`,
+			creators: []Contributor{
+				{Name: "John Doe", FileAs: "Doe, John", Roles: []string{"aut", "ill"}, seq: 1},
+				{Name: "Jane Roe", Roles: []string{"aut"}, seq: 2},
+				{Name: "Anonymous"},
+			},
+			contributors: []Contributor{{Name: "Ann Smith", Roles: []string{"trl"}}},
+		},
+	}
+	for _, tt := range tests {
+		m := readMetadata(t, tt.version, tt.metadata)
+		if !reflect.DeepEqual(m.Creators, tt.creators) {
+			t.Errorf("%s: Creators = %+v, want %+v", tt.metadata, m.Creators, tt.creators)
+		}
+		if !reflect.DeepEqual(m.Contributors, tt.contributors) {
+			t.Errorf("%s: Contributors = %+v, want %+v", tt.metadata, m.Contributors, tt.contributors)
+		}
+	}
+}
+
+func TestMetadataIdentifiers(t *testing.T) {
+	tests := []struct {
+		metadata string
+		want     Identifier
+	}{
+		{metadata: `<dc:identifier>urn:isbn:9780142437247</dc:identifier>`,
+			want: Identifier{Value: "urn:isbn:9780142437247", Scheme: "ISBN"}},
+		{metadata: `<dc:identifier>urn:uuid:0f3ef0b1-7a3b-4d5c-9e1f-2a4b6c8d0e1f</dc:identifier>`,
+			want: Identifier{Value: "urn:uuid:0f3ef0b1-7a3b-4d5c-9e1f-2a4b6c8d0e1f", Scheme: "UUID"}},
+		{metadata: `<dc:identifier opf:scheme="ISBN">0142437247</dc:identifier>`,
+			want: Identifier{Value: "0142437247", Scheme: "ISBN"}},
+		{metadata: `<dc:identifier id="i">9780142437247</dc:identifier>
+<meta refines="#i" property="identifier-type" scheme="onix:codelist5">15</meta>`,
+			want: Identifier{Value: "9780142437247", Scheme: "ISBN-13"}},
+		{metadata: `<dc:identifier id="i">10.1000/182</dc:identifier>
+<meta refines="#i" property="identifier-type">DOI</meta>`,
+			want: Identifier{Value: "10.1000/182", Scheme: "DOI"}},
+		{metadata: `<dc:identifier>mobydick-2003</dc:identifier>`,
+			want: Identifier{Value: "mobydick-2003"}},
+	}
+	for _, tt := range tests {
+		m := readMetadata(t, "3.0", tt.metadata)
+		if len(m.Identifiers) != 1 || m.Identifiers[0] != tt.want {
+			t.Errorf("%s: Identifiers = %+v, want [%+v]", tt.metadata, m.Identifiers, tt.want)
+		}
+	}
+}
+
+func TestMetadataSeries(t *testing.T) {
+	tests := []struct {
+		metadata string
+		series   []Series
+		modified string
+		other    [][]string
+	}{
+		{
+			metadata: `<meta property="belongs-to-collection" id="s">The Expanse</meta>
+<meta refines="#s" property="collection-type">series</meta>
+<meta refines="#s" property="group-position">2</meta>
+<meta property="dcterms:modified">2024-01-02T03:04:05Z</meta>
+<meta property="schema:accessMode">textual</meta>`,
+			series:   []Series{{Name: "The Expanse", Type: "series", Position: "2"}},
+			modified: "2024-01-02T03:04:05Z",
+			other:    [][]string{{"schema:accessMode", "textual"}},
+		},
+		{
+			metadata: `<meta name="calibre:series_index" content="3"/>
+<meta name="calibre:series" content="Discworld"/>
+<meta name="cover" content="cover-image"/>`,
+			series: []Series{{Name: "Discworld", Type: "series", Position: "3"}},
+			other:  [][]string{{"cover", "cover-image"}},
+		},
+	}
+	for _, tt := range tests {
+		m := readMetadata(t, "3.0", tt.metadata)
+		if !reflect.DeepEqual(m.Series, tt.series) {
+			t.Errorf("%s: Series = %+v, want %+v", tt.metadata, m.Series, tt.series)
+		}
+		if m.Modified != tt.modified {
+			t.Errorf("%s: Modified = %q, want %q", tt.metadata, m.Modified, tt.modified)
+		}
+		if !reflect.DeepEqual(m.OtherMeta, tt.other) {
+			t.Errorf("%s: OtherMeta = %q, want %q", tt.metadata, m.OtherMeta, tt.other)
+		}
+	}
+}
+
+func TestRoleName(t *testing.T) {
+	tests := []struct {
+		role string
+		want string
+	}{
+		{role: "aut", want: "Author"},
+		{role: "TRL", want: "Translator"},
+		{role: "xyz", want: "xyz"},
+	}
+	for _, tt := range tests {
+		if got := RoleName(tt.role); got != tt.want {
+			t.Errorf("RoleName(%q) = %q, want %q", tt.role, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package epub
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ray-d-song/goread/pkg/utils"
+)
+
+// Nav represents the navigation document for EPUB 3.0
+// A navigation document may hold several <nav> elements (toc, landmarks, page-list, ...)
+type Nav struct {
+	Navs []NavElement
+}
+
+// NavElement represents a <nav> element in the navigation document
+type NavElement struct {
+	XMLName xml.Name   `xml:"nav"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Items   []NavItem  `xml:"ol>li"`
+}
+
+// NavItem represents a list item in a nav list
+// An item is either a link or a span heading, optionally followed by a nested list
+type NavItem struct {
+	Link  *NavLink  `xml:"a"`
+	Span  *NavLink  `xml:"span"`
+	Items []NavItem `xml:"ol>li"`
+}
+
+// NavLink represents a navigation link or a span heading
+type NavLink struct {
+	Href string
+	Type string // epub:type of the link, used by landmarks (cover, bodymatter, ...)
+	Text string
+}
+
+// Landmark represents a structural part of the book (cover, bodymatter, bibliography, ...)
+type Landmark struct {
+	Type     string
+	Title    string
+	Path     string
+	Fragment string
+}
+
+// PageTarget represents a page break of the print edition
+type PageTarget struct {
+	Label    string
+	Path     string
+	Fragment string
+}
+
+// UnmarshalXML collects the href and the whole text of the element,
+// including text wrapped in inline children like <span> or <em>
+func (l *NavLink) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "href":
+			l.Href = attr.Value
+		case "type":
+			l.Type = attr.Value
+		}
+	}
+
+	var text strings.Builder
+	for depth := 1; depth > 0; {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			text.Write(t)
+		}
+	}
+	l.Text = strings.Join(strings.Fields(text.String()), " ")
+	return nil
+}
+
+// HasType checks if the nav element is of the given epub:type (toc, landmarks, page-list)
+// The ARIA role (doc-toc, doc-pagelist) is accepted as well
+func (n *NavElement) HasType(navType string) bool {
+	for _, attr := range n.Attrs {
+		switch attr.Name.Local {
+		case "type":
+			for _, t := range strings.Fields(attr.Value) {
+				if t == navType {
+					return true
+				}
+			}
+		case "role":
+			if attr.Value == "doc-"+strings.ReplaceAll(navType, "-", "") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TOC returns the nav element holding the table of contents
+// It prefers nav[epub:type="toc"] and falls back to the first nav
+// which is neither landmarks nor page-list
+func (n *Nav) TOC() *NavElement {
+	for i := range n.Navs {
+		if n.Navs[i].HasType("toc") {
+			return &n.Navs[i]
+		}
+	}
+	for i := range n.Navs {
+		if !n.Navs[i].HasType("landmarks") && !n.Navs[i].HasType("page-list") && len(n.Navs[i].Items) > 0 {
+			return &n.Navs[i]
+		}
+	}
+	return nil
+}
+
+// Title returns the text of the link or the span heading
+func (item *NavItem) Title() string {
+	if item.Link != nil {
+		return item.Link.Text
+	}
+	if item.Span != nil {
+		return item.Span.Text
+	}
+	return ""
+}
+
+// Href returns the target of the item
+// Span headings have no target, so the first target found among the children is used
+func (item *NavItem) Href() string {
+	if item.Link != nil && item.Link.Href != "" {
+		return item.Link.Href
+	}
+	for i := range item.Items {
+		if href := item.Items[i].Href(); href != "" {
+			return href
+		}
+	}
+	return ""
+}
+
+// parseNav parses a navigation document and collects all its <nav> elements
+// The <nav> elements can be nested anywhere in the body (e.g. inside <section>)
+func parseNav(r io.Reader) (*Nav, error) {
+	decoder := xml.NewDecoder(r)
+	// Navigation documents are XHTML, be lenient with HTML entities and unclosed tags
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	nav := &Nav{}
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "nav" {
+			continue
+		}
+
+		var navElement NavElement
+		if err := decoder.DecodeElement(&navElement, &start); err != nil {
+			return nil, err
+		}
+		nav.Navs = append(nav.Navs, navElement)
+	}
+
+	utils.DebugLog("[INFO:parseNav] Number of nav elements: %d", len(nav.Navs))
+	return nav, nil
+}
+
+// countNavItems counts the total number of items in a nav list, including nested ones
+func countNavItems(items []NavItem) int {
+	count := len(items)
+	for _, item := range items {
+		if len(item.Items) > 0 {
+			count += countNavItems(item.Items)
+		}
+	}
+	return count
+}
+
+// collectNavItemPaths recursively collects paths from nav items
+func collectNavItemPaths(items []NavItem, paths map[string]bool) {
+	for _, item := range items {
+		if href := item.Href(); href != "" {
+			path, _ := splitPathAndFragment(href)
+			paths[path] = true
+		}
+
+		// Process children recursively
+		if len(item.Items) > 0 {
+			collectNavItemPaths(item.Items, paths)
+		}
+	}
+}
+
+// processNestedNavItems adds a nav item and its children to the TOC list,
+// the EPUB 3.0 counterpart of processNestedNavPoints
+func processNestedNavItems(item NavItem, list *utils.DList[TOCValue], prev *utils.DItem[TOCValue], level int, parentID string) *utils.DItem[TOCValue] {
+	path, fragment := splitPathAndFragment(item.Href())
+	newItem := TOCValue{
+		ID:       uuid.New().String(),
+		Title:    item.Title(),
+		Path:     path,
+		Fragment: fragment,
+		Level:    level,
+		IsDir:    len(item.Items) > 0,
+		ParentID: parentID,
+		IsShadow: false,
+	}
+
+	newNode := list.Add(newItem, prev)
+
+	// Recursively process child items
+	for i := range item.Items {
+		newNode = processNestedNavItems(item.Items[i], list, newNode, level+1, newItem.ID)
+	}
+
+	return newNode
+}
+
+// flattenNavItems returns the links of a nav list in document order
+func flattenNavItems(items []NavItem) []NavLink {
+	var links []NavLink
+	for _, item := range items {
+		if item.Link != nil && item.Link.Href != "" {
+			links = append(links, *item.Link)
+		}
+		links = append(links, flattenNavItems(item.Items)...)
+	}
+	return links
+}
+
+// generateNavigation collects the landmarks and the print page list of the book
+// EPUB 3.0 navigation documents are preferred, the NCX pageList and the
+// EPUB 2.0 guide are used when the navigation document does not provide them
+func (e *Epub) generateNavigation(pkg *Package) {
+	e.Landmarks = nil
+	e.PageList = nil
+
+	for _, item := range pkg.Manifest {
+		if !hasProperty(item.Properties, "nav") {
+			continue
+		}
+
+		navFile, err := e.openFile(e.RootDir + item.Href)
+		if err != nil {
+			utils.DebugLog("[ERROR:generateNavigation] Error opening navigation document: %v", err)
+			break
+		}
+		nav, err := parseNav(navFile)
+		navFile.Close()
+		if err != nil {
+			utils.DebugLog("[ERROR:generateNavigation] Error decoding Nav: %v", err)
+			break
+		}
+
+		for i := range nav.Navs {
+			switch {
+			case nav.Navs[i].HasType("landmarks"):
+				for _, link := range flattenNavItems(nav.Navs[i].Items) {
+					path, fragment := splitPathAndFragment(link.Href)
+					e.Landmarks = append(e.Landmarks, Landmark{
+						Type:     link.Type,
+						Title:    link.Text,
+						Path:     path,
+						Fragment: fragment,
+					})
+				}
+			case nav.Navs[i].HasType("page-list"):
+				for _, link := range flattenNavItems(nav.Navs[i].Items) {
+					path, fragment := splitPathAndFragment(link.Href)
+					e.PageList = append(e.PageList, PageTarget{
+						Label:    link.Text,
+						Path:     path,
+						Fragment: fragment,
+					})
+				}
+			}
+		}
+		break
+	}
+
+	// Fall back to the NCX pageList
+	if len(e.PageList) == 0 {
+		for _, item := range pkg.Manifest {
+			if item.MediaType != "application/x-dtbncx+xml" {
+				continue
+			}
+
+			ncxFile, err := e.openFile(e.RootDir + item.Href)
+			if err != nil {
+				utils.DebugLog("[ERROR:generateNavigation] Error opening NCX: %v", err)
+				break
+			}
+			var ncx NCX
+			err = xml.NewDecoder(ncxFile).Decode(&ncx)
+			ncxFile.Close()
+			if err != nil {
+				utils.DebugLog("[ERROR:generateNavigation] Error decoding NCX: %v", err)
+				break
+			}
+
+			for _, target := range ncx.PageTargets {
+				label := strings.TrimSpace(target.NavLabel.Text)
+				if label == "" {
+					label = target.Value
+				}
+				path, fragment := splitPathAndFragment(target.Content.Src)
+				e.PageList = append(e.PageList, PageTarget{
+					Label:    label,
+					Path:     path,
+					Fragment: fragment,
+				})
+			}
+			break
+		}
+	}
+
+	// Fall back to the EPUB 2.0 guide
+	if len(e.Landmarks) == 0 {
+		for _, ref := range pkg.Guide {
+			path, fragment := splitPathAndFragment(ref.Href)
+			e.Landmarks = append(e.Landmarks, Landmark{
+				Type:     ref.Type,
+				Title:    ref.Title,
+				Path:     path,
+				Fragment: fragment,
+			})
+		}
+	}
+
+	utils.DebugLog("[INFO:generateNavigation] Landmarks: %d, Pages: %d", len(e.Landmarks), len(e.PageList))
+}
@@ -0,0 +1,102 @@
+package epub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNavigation(t *testing.T) {
+	manifest := `<item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>`
+	ncx := `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<navMap><navPoint id="n1"><navLabel><text>One</text></navLabel><content src="ch1.xhtml"/></navPoint></navMap>
+<pageList>
+  <pageTarget id="p1" type="normal" value="1"><navLabel><text>1</text></navLabel><content src="ch1.xhtml#p1"/></pageTarget>
+  <pageTarget id="p2" type="normal" value="2"><navLabel><text></text></navLabel><content src="ch1.xhtml#p2"/></pageTarget>
+</pageList>
+</ncx>`
+	guide := `<guide>
+<reference type="cover" title="Cover" href="ch1.xhtml"/>
+<reference type="text" title="Start" href="ch1.xhtml#start"/>
+</guide>`
+
+	tests := []struct {
+		name      string
+		files     map[string]string
+		landmarks []Landmark
+		pages     []PageTarget
+	}{
+		{
+			name: "navigation document",
+			files: map[string]string{
+				"OEBPS/content.opf": opf("3.0", `<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`+manifest+`</manifest>
+<spine><itemref idref="ch1"/></spine>`+guide),
+				"OEBPS/nav.xhtml": xhtml(`<nav epub:type="toc"><ol><li><a href="ch1.xhtml">One</a></li></ol></nav>
+<section><nav epub:type="landmarks"><ol>
+  <li><a epub:type="cover" href="ch1.xhtml">Cover</a></li>
+  <li><a epub:type="bodymatter" href="ch1.xhtml#start">Start of <em>Content</em></a></li>
+</ol></nav></section>
+<nav role="doc-pagelist"><ol>
+  <li><a href="ch1.xhtml#p1">i</a></li>
+  <li><a href="ch1.xhtml#p2">ii</a></li>
+</ol></nav>`),
+			},
+			landmarks: []Landmark{
+				{Type: "cover", Title: "Cover", Path: "ch1.xhtml"},
+				{Type: "bodymatter", Title: "Start of Content", Path: "ch1.xhtml", Fragment: "start"},
+			},
+			pages: []PageTarget{
+				{Label: "i", Path: "ch1.xhtml", Fragment: "p1"},
+				{Label: "ii", Path: "ch1.xhtml", Fragment: "p2"},
+			},
+		},
+		{
+			name: "NCX page list and guide",
+			files: map[string]string{
+				"OEBPS/content.opf": opf("2.0", `<manifest>
+<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>`+manifest+`</manifest>
+<spine toc="ncx"><itemref idref="ch1"/></spine>`+guide),
+				"OEBPS/toc.ncx": ncx,
+			},
+			landmarks: []Landmark{
+				{Type: "cover", Title: "Cover", Path: "ch1.xhtml"},
+				{Type: "text", Title: "Start", Path: "ch1.xhtml", Fragment: "start"},
+			},
+			pages: []PageTarget{
+				{Label: "1", Path: "ch1.xhtml", Fragment: "p1"},
+				{Label: "2", Path: "ch1.xhtml", Fragment: "p2"}, // The value stands in for the empty label
+			},
+		},
+		{
+			name: "navigation document without a page list",
+			files: map[string]string{
+				"OEBPS/content.opf": opf("3.0", `<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>`+manifest+`</manifest>
+<spine toc="ncx"><itemref idref="ch1"/></spine>`),
+				"OEBPS/nav.xhtml": xhtml(`<nav epub:type="toc"><ol><li><a href="ch1.xhtml">One</a></li></ol></nav>
+<nav epub:type="landmarks"><ol><li><a epub:type="toc" href="nav.xhtml">Contents</a></li></ol></nav>`),
+				"OEBPS/toc.ncx": ncx,
+			},
+			landmarks: []Landmark{
+				{Type: "toc", Title: "Contents", Path: "nav.xhtml"},
+			},
+			pages: []PageTarget{
+				{Label: "1", Path: "ch1.xhtml", Fragment: "p1"},
+				{Label: "2", Path: "ch1.xhtml", Fragment: "p2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt.files["OEBPS/ch1.xhtml"] = xhtml(`<p id="start">One</p><span id="p1"/><p>Two</p><span id="p2"/>`)
+		book := openEpub(t, tt.files)
+
+		if !reflect.DeepEqual(book.Landmarks, tt.landmarks) {
+			t.Errorf("%s: Landmarks = %+v, want %+v", tt.name, book.Landmarks, tt.landmarks)
+		}
+		if !reflect.DeepEqual(book.PageList, tt.pages) {
+			t.Errorf("%s: PageList = %+v, want %+v", tt.name, book.PageList, tt.pages)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package epub
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ray-d-song/goread/pkg/parser"
+	"github.com/ray-d-song/goread/pkg/utils"
+)
+
+// noteMarkerRe matches the markers of links and note references
+var noteMarkerRe = regexp.MustCompile(`\[(→|\^)\d+\]`)
+
+// GetNote returns the text lines of the note a reference of the chapter points to
+// The note (<aside>, <li>, ...) may live in the chapter file or in another spine file
+func (e *Epub) GetNote(index int, href string) ([]string, error) {
+	if index < 0 || index >= e.TOC.Len() {
+		return nil, fmt.Errorf("chapter index out of range")
+	}
+
+	notePath, fragment := e.ResolveLink(index, href)
+	if fragment == "" {
+		return nil, fmt.Errorf("note reference without target: %s", href)
+	}
+	utils.DebugLog("[INFO:GetNote] Reading note %s in %s", fragment, notePath)
+
+	noteFile, err := e.openFile(notePath)
+	if err != nil {
+		return nil, err
+	}
+	defer noteFile.Close()
+
+	content, err := io.ReadAll(noteFile)
+	if err != nil {
+		return nil, err
+	}
+
+	noteHTML, err := parser.ExtractNote(string(content), fragment)
+	if err != nil {
+		return nil, err
+	}
+
+	noteParser := parser.NewHTMLParser()
+	if err := noteParser.Parse(noteHTML, "", ""); err != nil {
+		return nil, err
+	}
+
+	// Markers of links inside the note can't be followed from the popup
+	var lines []string
+	for _, line := range noteParser.GetLines() {
+		lines = append(lines, noteMarkerRe.ReplaceAllString(line, ""))
+	}
+
+	// Drop the blank lines around the note
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("note '%s' is empty", fragment)
+	}
+
+	return lines, nil
+}
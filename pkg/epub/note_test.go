@@ -0,0 +1,50 @@
+package epub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetNote(t *testing.T) {
+	book := openEpub(t, map[string]string{
+		"OEBPS/content.opf": opf("3.0", `<manifest>
+<item id="ch1" href="text/ch1.xhtml" media-type="application/xhtml+xml"/>
+<item id="notes" href="text/notes.xhtml" media-type="application/xhtml+xml" properties="nonlinear"/>
+</manifest>
+<spine><itemref idref="ch1"/><itemref idref="notes" linear="no"/></spine>`),
+		"OEBPS/text/ch1.xhtml": xhtml(`<p>Text<a epub:type="noteref" href="#n1">1</a>
+and more<a epub:type="noteref" href="notes.xhtml#n2">2</a>.</p>
+<aside epub:type="footnote" id="n1"><p>Note one.</p></aside>
+<aside epub:type="footnote" id="empty"><p> </p></aside>`),
+		"OEBPS/text/notes.xhtml": xhtml(`<ol>
+<li id="n2"><p><a epub:type="backlink" href="ch1.xhtml#r2">↩</a> Note two, <a href="ch1.xhtml">see</a> there.</p></li>
+<li><p><a id="n3" href="ch1.xhtml#r3">3.</a> Note three.</p></li>
+</ol>`),
+	})
+
+	tests := []struct {
+		index   int
+		href    string
+		want    []string
+		wantErr bool
+	}{
+		{index: 0, href: "#n1", want: []string{"Note one."}},
+		{index: 0, href: "notes.xhtml#n2", want: []string{"  • Note two, see there."}},
+		{index: 0, href: "notes.xhtml#n3", want: []string{"3. Note three."}},
+		{index: 1, href: "ch1.xhtml#n1", want: []string{"Note one."}},
+		{index: 0, href: "notes.xhtml", wantErr: true},
+		{index: 0, href: "#n4", wantErr: true},
+		{index: 0, href: "#empty", wantErr: true},
+		{index: 2, href: "#n1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := book.GetNote(tt.index, tt.href)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("GetNote(%d, %q) error = %v, want error %v", tt.index, tt.href, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetNote(%d, %q) = %q, want %q", tt.index, tt.href, got, tt.want)
+		}
+	}
+}
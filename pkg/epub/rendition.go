@@ -0,0 +1,104 @@
+package epub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ray-d-song/goread/pkg/utils"
+)
+
+// IsFixedLayout checks if the rendition is pre-paginated (fixed layout)
+func (r RootFile) IsFixedLayout() bool {
+	return r.Layout == "pre-paginated"
+}
+
+// Description returns a short human readable description of the rendition
+func (r RootFile) Description() string {
+	name := r.Label
+	if name == "" {
+		name = r.FullPath
+	}
+
+	var details []string
+	if r.Language != "" {
+		details = append(details, r.Language)
+	}
+	if r.IsFixedLayout() {
+		details = append(details, "fixed layout")
+	} else {
+		details = append(details, "reflowable")
+	}
+	if r.Media != "" {
+		details = append(details, r.Media)
+	}
+	if r.AccessMode != "" {
+		details = append(details, r.AccessMode)
+	}
+
+	return fmt.Sprintf("%s (%s)", name, strings.Join(details, ", "))
+}
+
+// matchLanguage checks if a BCP 47 language tag starts with the given primary language
+func matchLanguage(tag string, language string) bool {
+	tag = strings.ToLower(tag)
+	language = strings.ToLower(language)
+	return tag == language || strings.HasPrefix(tag, language+"-")
+}
+
+// selectRendition returns the index of the rendition to read
+// An explicit choice can be a 1-based number, a rootfile path, a label or a language.
+// Otherwise reflowable renditions are preferred, then the ones in the user's language
+func (e *Epub) selectRendition(rendition string) int {
+	if rendition != "" {
+		if num, err := strconv.Atoi(rendition); err == nil && num > 0 && num <= len(e.Renditions) {
+			return num - 1
+		}
+		for i, r := range e.Renditions {
+			if r.FullPath == rendition || strings.EqualFold(r.Label, rendition) {
+				return i
+			}
+		}
+		for i, r := range e.Renditions {
+			if r.Language != "" && matchLanguage(r.Language, rendition) {
+				return i
+			}
+		}
+		utils.DebugLog("[WARN:selectRendition] No rendition matches %s, using the default one", rendition)
+	}
+
+	userLanguage := utils.GetUserLanguage()
+	best, bestScore := 0, -1
+	for i, r := range e.Renditions {
+		score := 0
+		// Fixed layout renditions are hard to read in a terminal
+		if !r.IsFixedLayout() {
+			score += 2
+		}
+		if userLanguage != "" && matchLanguage(r.Language, userLanguage) {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// SelectRendition switches to another rendition and reloads the TOC
+func (e *Epub) SelectRendition(index int) error {
+	if index < 0 || index >= len(e.Renditions) {
+		return fmt.Errorf("rendition index out of range")
+	}
+
+	e.Rendition = index
+	e.TOCPath = ""
+	// The file parsed last belongs to the chapters of the other rendition
+	e.parsed = nil
+	e.setRootFile(e.Renditions[index].FullPath)
+
+	if err := e.parseRootFile(); err != nil {
+		return err
+	}
+	return e.initialize()
+}
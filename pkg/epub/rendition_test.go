@@ -0,0 +1,116 @@
+package epub
+
+import (
+	"strings"
+	"testing"
+)
+
+// renditionBook holds a fixed layout, an English and a Japanese rendition and a PDF,
+// their chapters have the same name
+func renditionBook() map[string]string {
+	files := map[string]string{
+		"META-INF/container.xml": `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container"
+    xmlns:rendition="http://www.idpf.org/2013/rendition">
+  <rootfiles>
+    <rootfile full-path="fixed/content.opf" media-type="application/oebps-package+xml"
+        rendition:layout="pre-paginated" rendition:language="en" rendition:label="Comic"/>
+    <rootfile full-path="book.pdf" media-type="application/pdf"/>
+    <rootfile full-path="en/content.opf" media-type="application/oebps-package+xml"
+        rendition:language="en-US" rendition:label="English"/>
+    <rootfile full-path="ja/content.opf" media-type="application/oebps-package+xml"
+        rendition:language="ja" rendition:label="日本語"/>
+  </rootfiles>
+</container>`,
+	}
+	for _, dir := range []string{"fixed", "en", "ja"} {
+		files[dir+"/content.opf"] = opf("3.0", `<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+</manifest>
+<spine><itemref idref="ch1"/></spine>`)
+		files[dir+"/nav.xhtml"] = xhtml(`<nav epub:type="toc"><ol><li><a href="ch1.xhtml">Chapter ` + dir + `</a></li></ol></nav>`)
+		files[dir+"/ch1.xhtml"] = xhtml(`<p>Text ` + dir + `</p>`)
+	}
+	return files
+}
+
+// setLanguage sets the locale of the user to the language, none if empty
+func setLanguage(t *testing.T, language string) {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANGUAGE"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("LANG", language)
+}
+
+func TestSelectRendition(t *testing.T) {
+	path := writeEpub(t, renditionBook())
+	tests := []struct {
+		rendition string
+		locale    string
+		want      string
+	}{
+		{rendition: "", locale: "", want: "en/content.opf"},
+		{rendition: "", locale: "ja_JP.UTF-8", want: "ja/content.opf"},
+		{rendition: "", locale: "en_GB.UTF-8", want: "en/content.opf"},
+		{rendition: "1", want: "fixed/content.opf"},
+		{rendition: "3", want: "ja/content.opf"}, // The PDF isn't counted
+		{rendition: "4", want: "en/content.opf"},
+		{rendition: "ja/content.opf", want: "ja/content.opf"},
+		{rendition: "comic", want: "fixed/content.opf"},
+		{rendition: "日本語", want: "ja/content.opf"},
+		{rendition: "ja", want: "ja/content.opf"},
+		{rendition: "en", locale: "ja_JP.UTF-8", want: "fixed/content.opf"},
+		{rendition: "fr", locale: "ja_JP.UTF-8", want: "ja/content.opf"},
+	}
+	for _, tt := range tests {
+		setLanguage(t, tt.locale)
+		book, err := NewEpubWithRendition(path, tt.rendition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if book.RootFile != tt.want {
+			t.Errorf("NewEpubWithRendition(%q) with LANG=%q reads %s, want %s", tt.rendition, tt.locale, book.RootFile, tt.want)
+		}
+		book.Close()
+	}
+}
+
+func TestSwitchRendition(t *testing.T) {
+	setLanguage(t, "")
+	book := openEpub(t, renditionBook())
+	book.Width = 40
+
+	tests := []struct {
+		index   int
+		title   string
+		text    string
+		wantErr bool
+	}{
+		{index: 2, title: "Chapter ja", text: "Text ja"},
+		{index: 0, title: "Chapter fixed", text: "Text fixed"},
+		{index: 3, title: "Chapter fixed", text: "Text fixed", wantErr: true},
+		{index: 1, title: "Chapter en", text: "Text en"},
+	}
+	for _, tt := range tests {
+		// The chapter of the rendition read before is parsed and kept
+		if _, err := book.GetChapterContents(0); err != nil {
+			t.Fatal(err)
+		}
+
+		err := book.SelectRendition(tt.index)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SelectRendition(%d) error = %v, want error %v", tt.index, err, tt.wantErr)
+		}
+		if got := book.TOC.Slice[0].Title; got != tt.title {
+			t.Errorf("SelectRendition(%d): title = %q, want %q", tt.index, got, tt.title)
+		}
+		content, err := book.GetChapterContents(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(strings.Join(content.Plain, "\n")); got != tt.text {
+			t.Errorf("SelectRendition(%d): text = %q, want %q", tt.index, got, tt.text)
+		}
+	}
+}
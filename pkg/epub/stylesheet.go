@@ -0,0 +1,35 @@
+package epub
+
+import (
+	"io"
+
+	"github.com/ray-d-song/goread/pkg/utils"
+)
+
+// stylesheetLoader returns the function reading the stylesheets linked by a chapter file,
+// each stylesheet is read once per book
+func (e *Epub) stylesheetLoader(chapterPath string) func(href string) (string, error) {
+	return func(href string) (string, error) {
+		name := resolveHref(chapterPath, href)
+		if css, ok := e.stylesheets[name]; ok {
+			return css, nil
+		}
+
+		file, err := e.openFile(name)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return "", err
+		}
+
+		utils.DebugLog("[INFO:stylesheetLoader] Loaded stylesheet %s", name)
+		if e.stylesheets == nil {
+			e.stylesheets = make(map[string]string)
+		}
+		e.stylesheets[name] = string(data)
+		return e.stylesheets[name], nil
+	}
+}
@@ -0,0 +1,272 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// BidiLine is a line written in visual order because it holds right-to-left text
+type BidiLine struct {
+	Text  string // Text of the line in logical order, as the plain lines have it
+	Order []int  // Position in Text, in characters, of each character shown from the left
+}
+
+// bidiUnit is a character with its combining marks, or a marker, kept whole when reordering
+type bidiUnit struct {
+	text  string
+	span  int // Index of the span it comes from
+	start int // Position of its first character in the line
+}
+
+// isRTL checks if a character is a right-to-left letter (Hebrew, Arabic...)
+func isRTL(r rune) bool {
+	props, _ := bidi.LookupRune(r)
+	return props.Class() == bidi.R || props.Class() == bidi.AL
+}
+
+// textDirection returns the direction of the first letter of inline elements, left to right without one
+func textDirection(inlines []Inline) Direction {
+	for _, inline := range inlines {
+		if inline.Kind != InlineText && inline.Kind != InlineRuby {
+			continue
+		}
+		for _, r := range inline.Text {
+			props, _ := bidi.LookupRune(r)
+			switch props.Class() {
+			case bidi.L:
+				return DirLTR
+			case bidi.R, bidi.AL:
+				return DirRTL
+			}
+		}
+	}
+	return DirLTR
+}
+
+// hasRTL checks if inline elements hold right-to-left text
+func hasRTL(inlines []Inline) bool {
+	for _, inline := range inlines {
+		if inline.Kind == InlineText && strings.IndexFunc(inline.Text, isRTL) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// visualLine puts the spans of the paragraphs holding right-to-left text in visual order,
+// the other spans (margins, list markers, alignment) stay where they are
+// order is the position in the line of each character shown, nil when the line is unchanged
+func visualLine(l line) (line, []int) {
+	var result line
+	var order []int
+	pos := 0 // Position of the next span in the line, in characters
+	for i := 0; i < len(l); {
+		if l[i].dir == DirAuto {
+			result = append(result, l[i])
+			for range l[i].text {
+				order = append(order, pos)
+				pos++
+			}
+			i++
+			continue
+		}
+		j := i
+		for j < len(l) && l[j].dir == l[i].dir {
+			j++
+		}
+		spans, spanOrder := reorderSpans(l[i:j], l[i].dir, pos)
+		result = append(result, spans...)
+		order = append(order, spanOrder...)
+		pos += len(spanOrder)
+		i = j
+	}
+
+	for i, p := range order {
+		if p != i {
+			return result, order
+		}
+	}
+	if result.text() != l.text() {
+		// Mirrored brackets
+		return result, order
+	}
+	return l, nil
+}
+
+// reorderSpans puts spans in visual order for the direction of their paragraph,
+// start is the position of the first one in the line
+func reorderSpans(spans line, dir Direction, start int) (line, []int) {
+	var units []bidiUnit
+	var classes strings.Builder // A character per unit, to classify it
+	pos := start
+	for i, s := range spans {
+		if s.marker {
+			units = append(units, bidiUnit{text: s.text, span: i, start: pos})
+			classes.WriteRune('\uFFFC')
+			pos += utf8.RuneCountInString(s.text)
+			continue
+		}
+		for _, r := range s.text {
+			if n := len(units); n > 0 && units[n-1].span == i && unicode.Is(unicode.Mn, r) {
+				// Combining marks stay after their character
+				units[n-1].text += string(r)
+			} else {
+				units = append(units, bidiUnit{text: string(r), span: i, start: pos})
+				classes.WriteRune(r)
+			}
+			pos++
+		}
+	}
+	if len(units) == 0 {
+		return nil, nil
+	}
+
+	levels := bidiLevels(classes.String(), dir)
+	visual := make([]int, len(units))
+	maxLevel := 0
+	for i := range visual {
+		visual[i] = i
+		maxLevel = max(maxLevel, levels[i])
+	}
+	// Each run of a level or higher is reversed, from the highest level down
+	for level := maxLevel; level > 0; level-- {
+		for i := 0; i < len(visual); {
+			if levels[visual[i]] < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(visual) && levels[visual[j]] >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				visual[a], visual[b] = visual[b], visual[a]
+			}
+			i = j
+		}
+	}
+
+	var result line
+	var order []int
+	last := -1 // Span of the unit written last
+	for _, u := range visual {
+		unit := units[u]
+		text := unit.text
+		if levels[u]%2 == 1 && !spans[unit.span].marker {
+			// Brackets are mirrored in right-to-left text
+			r, size := utf8.DecodeRuneInString(text)
+			text = bidi.ReverseString(string(r)) + text[size:]
+		}
+		if unit.span == last && !spans[unit.span].marker {
+			result[len(result)-1].text += text
+		} else {
+			s := spans[unit.span]
+			s.text = text
+			result = append(result, s)
+		}
+		last = unit.span
+		for i := range utf8.RuneCountInString(unit.text) {
+			order = append(order, unit.start+i)
+		}
+	}
+	return result, order
+}
+
+// bidiLevels returns the embedding level of each character of a text, even levels are
+// left to right and odd levels right to left
+// The runs of the bidi algorithm only tell their direction: left-to-right runs are put
+// one level above right-to-left ones when they're embedded in them, like numbers in Arabic text
+func bidiLevels(text string, dir Direction) []int {
+	var p bidi.Paragraph
+	offset := 0
+	var err error
+	if dir == DirRTL {
+		_, err = p.SetString(text, bidi.DefaultDirection(bidi.RightToLeft))
+	} else {
+		// A left-to-right mark keeps the paragraph from taking the direction of its first letter
+		_, err = p.SetString("\u200e"+text, bidi.DefaultDirection(bidi.LeftToRight))
+		offset = 1
+	}
+	levels := make([]int, utf8.RuneCountInString(text))
+	if err != nil {
+		return levels
+	}
+	ordering, err := p.Order()
+	if err != nil {
+		return levels
+	}
+
+	runes := []rune(text)
+	n := ordering.NumRuns()
+	for i := range n {
+		run := ordering.Run(i)
+		start, end := run.Pos()
+		start, end = max(start-offset, 0), min(end-offset+1, len(levels))
+		level := 0
+		switch {
+		case run.Direction() == bidi.RightToLeft:
+			level = 1
+		case dir == DirRTL:
+			level = 2
+		case i > 0 && i < n-1 && !hasStrongLTR(runes[start:end]):
+			// Numbers between right-to-left runs
+			level = 2
+		}
+		for j := start; j < end; j++ {
+			levels[j] = level
+		}
+	}
+	return levels
+}
+
+// hasStrongLTR checks if characters hold a left-to-right letter
+func hasStrongLTR(runes []rune) bool {
+	for _, r := range runes {
+		if props, _ := bidi.LookupRune(r); props.Class() == bidi.L {
+			return true
+		}
+	}
+	return false
+}
+
+// visualRanges returns the byte ranges of a line shown in visual order holding a byte range of
+// its text in logical order, a range of the text may be cut in several ones by the reordering
+func visualRanges(shown string, b BidiLine, start int, end int) [][]int {
+	starts := make([]int, 0, len(b.Order)+1) // Byte position of each character shown
+	for i := range shown {
+		starts = append(starts, i)
+	}
+	starts = append(starts, len(shown))
+	if len(starts) != len(b.Order)+1 || end > len(b.Text) {
+		return nil
+	}
+	visual := make([]int, len(b.Order)) // Position shown of each character of the text
+	for v, p := range b.Order {
+		if p < 0 || p >= len(visual) {
+			return nil
+		}
+		visual[p] = v
+	}
+
+	first := utf8.RuneCountInString(b.Text[:start])
+	last := first + utf8.RuneCountInString(b.Text[start:end])
+	var positions []int
+	for p := first; p < last; p++ {
+		positions = append(positions, visual[p])
+	}
+	sort.Ints(positions)
+	var ranges [][]int
+	for i := 0; i < len(positions); {
+		j := i + 1
+		for j < len(positions) && positions[j] == positions[j-1]+1 {
+			j++
+		}
+		ranges = append(ranges, []int{starts[positions[i]], starts[positions[j-1]+1]})
+		i = j
+	}
+	return ranges
+}
@@ -1,218 +1,313 @@
 package parser
 
 import (
-	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-// formatCodeLine formats a code line with syntax highlighting
-func formatCodeLine(line string, indent string) string {
-	if line == "" {
-		return ""
-	}
-
-	// Apply syntax highlighting
-	highlightedLine := applyCodeHighlighting(line)
-
-	// Handle line wrapping
-	var result []string
-	lines := strings.Split(highlightedLine, "\n")
-
-	for _, l := range lines {
-		result = append(result, indent+l)
-	}
+// TokenKind is the kind of a token of highlighted code
+type TokenKind int
+
+const (
+	TokenPlain    TokenKind = iota
+	TokenKeyword            // Keywords and preprocessor directives
+	TokenType               // Built-in types
+	TokenConstant           // true, nil, None...
+	TokenString             // String and character literals
+	TokenNumber             // Number literals
+	TokenComment            // Comments
+	TokenFunction           // Called functions, macros and shell commands
+	TokenName               // Keys of JSON and YAML, shell variables, decorators and annotations
+)
 
-	return strings.Join(result, "\n")
-}
+// CodeColors are the colors of the kinds of tokens (#rrggbb or a color name),
+// the kinds without a color keep the color of the text
+type CodeColors map[TokenKind]string
 
-// applyCodeHighlighting applies syntax highlighting based on code type
-func applyCodeHighlighting(code string) string {
-	// Use universal highlighting for all other code blocks
-	return highlightUniversal(code)
+// token is a piece of code of a single kind
+type token struct {
+	text string
+	kind TokenKind
 }
 
-// highlightUniversal adds highlighting for common programming language constructs
-func highlightUniversal(code string) string {
-	// Use a simpler approach to avoid tview color code issues
-
-	// Split the code into tokens (words, symbols, etc.)
-	tokens := tokenizeCode(code)
-
-	// Classify and color each token
-	var result strings.Builder
-	for _, token := range tokens {
-		result.WriteString(colorizeToken(token))
+// highlightCode lays out a code block as lines of tokens, with their tabs expanded,
+// code in an unknown language isn't highlighted
+func highlightCode(code string, language string) []line {
+	var tokens []token
+	if lang := lookupLanguage(language); lang != nil {
+		tokens = lexCode(code, lang)
+	} else {
+		tokens = []token{{text: code}}
 	}
 
-	return result.String()
+	lines := []line{nil}
+	for _, t := range tokens {
+		for i, part := range strings.Split(t.text, "\n") {
+			if i > 0 {
+				lines = append(lines, nil)
+			}
+			if part != "" {
+				lines[len(lines)-1] = append(lines[len(lines)-1], span{text: part, token: t.kind})
+			}
+		}
+	}
+	for i := range lines {
+		lines[i] = expandTabs(lines[i])
+	}
+	return lines
 }
 
-// tokenizeCode splits code into tokens for highlighting
-func tokenizeCode(code string) []string {
-	// Define a regex pattern to match different code elements
-	pattern := regexp.MustCompile(`("[^"]*")|('[^']*')|(\` + "`" + `[^` + "`" + `]*` + "`" + `)|(//.*)|(#.*)|(--.*)|([\d.]+)|([a-zA-Z_]\w*)|(\S)|\s+`)
-
-	matches := pattern.FindAllStringIndex(code, -1)
-	var tokens []string
-
-	for _, match := range matches {
-		start, end := match[0], match[1]
-		tokens = append(tokens, code[start:end])
+// lexCode splits code into tokens with the rules of a language
+func lexCode(code string, lang *language) []token {
+	var tokens []token
+	add := func(text string, kind TokenKind) {
+		// Runs of plain text are kept together
+		if n := len(tokens); n > 0 && tokens[n-1].kind == kind && kind == TokenPlain {
+			tokens[n-1].text += text
+			return
+		}
+		tokens = append(tokens, token{text: text, kind: kind})
 	}
 
+	lineStart := true
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		r, size := utf8.DecodeRuneInString(rest)
+
+		if unicode.IsSpace(r) {
+			end := i + size
+			for end < len(code) {
+				r, size := utf8.DecodeRuneInString(code[end:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				end += size
+			}
+			space := code[i:end]
+			if strings.Contains(space, "\n") {
+				lineStart = true
+			}
+			add(space, TokenPlain)
+			i = end
+			continue
+		}
+		atLineStart := lineStart
+		lineStart = false
+
+		// Preprocessor directives take the whole line
+		if lang.preprocessor && atLineStart && r == '#' {
+			end := lineEnd(code, i)
+			add(code[i:end], TokenKeyword)
+			i = end
+			continue
+		}
+
+		if end := matchComment(code, i, lang); end > i {
+			add(code[i:end], TokenComment)
+			i = end
+			continue
+		}
+
+		if end := matchString(code, i, lang); end > i {
+			kind := TokenString
+			if lang.keys && followedByColon(code, end, false) {
+				kind = TokenName
+			}
+			add(code[i:end], kind)
+			i = end
+			continue
+		}
+
+		if isDigit(r) || (r == '.' && i+1 < len(code) && isDigit(rune(code[i+1]))) {
+			end := matchNumber(code, i)
+			add(code[i:end], TokenNumber)
+			i = end
+			continue
+		}
+
+		if strings.ContainsRune(lang.namePrefixes, r) {
+			if end := matchName(code, i+size, lang); end > i+size {
+				add(code[i:end], TokenName)
+				i = end
+				continue
+			}
+		}
+
+		if isIdentStart(r) {
+			end := matchIdent(code, i, lang)
+			word := code[i:end]
+			add(word, classifyWord(code, word, end, lang))
+			i = end
+			continue
+		}
+
+		add(code[i:i+size], TokenPlain)
+		i += size
+	}
 	return tokens
 }
 
-// colorizeToken applies color to a token based on its type
-func colorizeToken(token string) string {
-	// Check for strings (double quotes, single quotes, backticks)
-	if (strings.HasPrefix(token, "\"") && strings.HasSuffix(token, "\"")) ||
-		(strings.HasPrefix(token, "'") && strings.HasSuffix(token, "'")) ||
-		(strings.HasPrefix(token, "`") && strings.HasSuffix(token, "`")) {
-		return "[#FFFF00]" + token + "[-]"
+// classifyWord returns the kind of an identifier ending at end
+func classifyWord(code string, word string, end int, lang *language) TokenKind {
+	if lang.keys && followedByColon(code, end, true) {
+		return TokenName
 	}
-
-	// Check for comments
-	if strings.HasPrefix(token, "//") || strings.HasPrefix(token, "#") || strings.HasPrefix(token, "--") {
-		return "[#00FF00]" + token + "[-]"
+	key := word
+	if lang.ignoreCase {
+		key = strings.ToLower(word)
 	}
-
-	// Check for numbers
-	if regexp.MustCompile(`^\d+(\.\d+)?$`).MatchString(token) {
-		return "[#FF8800]" + token + "[-]"
+	switch {
+	case lang.keywords[key]:
+		return TokenKeyword
+	case lang.types[key]:
+		return TokenType
+	case lang.constants[key]:
+		return TokenConstant
+	case lang.functions[key]:
+		return TokenFunction
 	}
-
-	// Check for SQL keywords (case insensitive)
-	if isSQLKeyword(token) {
-		return "[#FF00AA]" + token + "[-]"
+	if end < len(code) && (code[end] == '(' || (lang.macros && strings.HasPrefix(code[end:], "!") && !strings.HasPrefix(code[end:], "!="))) {
+		return TokenFunction
 	}
+	return TokenPlain
+}
 
-	// Check for keywords
-	if isDataType(token) {
-		return "[#00FFFF]" + token + "[-]"
+// matchComment returns the end of the comment starting at i, i when there's none
+func matchComment(code string, i int, lang *language) int {
+	rest := code[i:]
+	for _, prefix := range lang.lineComments {
+		if strings.HasPrefix(rest, prefix) {
+			// A # inside a word (shell $#, URLs) doesn't start a comment
+			if prefix == "#" && i > 0 && !unicode.IsSpace(rune(code[i-1])) {
+				continue
+			}
+			return lineEnd(code, i)
+		}
 	}
+	for _, delims := range lang.blockComments {
+		if strings.HasPrefix(rest, delims[0]) {
+			end := strings.Index(rest[len(delims[0]):], delims[1])
+			if end < 0 {
+				return len(code)
+			}
+			return i + len(delims[0]) + end + len(delims[1])
+		}
+	}
+	return i
+}
 
-	if isControlFlow(token) {
-		return "[#FF00FF]" + token + "[-]"
+// matchString returns the end of the string literal starting at i, i when there's none
+// Unterminated strings end with the line unless they can span lines
+func matchString(code string, i int, lang *language) int {
+	rest := code[i:]
+	for _, q := range lang.quotes {
+		if !strings.HasPrefix(rest, q.delim) {
+			continue
+		}
+		for j := len(q.delim); j < len(rest); j++ {
+			switch {
+			case rest[j] == '\\' && !q.raw:
+				j++
+			case rest[j] == '\n' && !q.multiline:
+				return i + j
+			case strings.HasPrefix(rest[j:], q.delim):
+				return i + j + len(q.delim)
+			}
+		}
+		return len(code)
 	}
+	return i
+}
 
-	if isOtherKeyword(token) {
-		return "[#0088FF]" + token + "[-]"
+// matchNumber returns the end of the number literal starting at i
+func matchNumber(code string, i int) int {
+	end := i
+	for end < len(code) {
+		c := code[end]
+		switch {
+		case isDigit(rune(c)) || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			end++
+			// Exponents: 1e-5
+			if (c == 'e' || c == 'E') && end+1 < len(code) && (code[end] == '-' || code[end] == '+') && isDigit(rune(code[end+1])) {
+				end++
+			}
+		case c == '.' && end+1 < len(code) && isDigit(rune(code[end+1])):
+			end++
+		default:
+			return end
+		}
 	}
+	return end
+}
 
-	// Return the token as is if it doesn't match any category
-	return token
+// matchName returns the end of the name after a prefix ($, @) at i, i when there's none
+func matchName(code string, i int, lang *language) int {
+	if i >= len(code) {
+		return i
+	}
+	switch {
+	case code[i] == '{':
+		// Shell ${...}
+		if end := strings.IndexByte(code[i:], '}'); end >= 0 && !strings.Contains(code[i:i+end], "\n") {
+			return i + end + 1
+		}
+	case strings.ContainsRune("@*#?$!0123456789", rune(code[i])) && strings.ContainsRune(lang.namePrefixes, '$'):
+		// Shell special parameters
+		return i + 1
+	default:
+		r, _ := utf8.DecodeRuneInString(code[i:])
+		if isIdentStart(r) {
+			end := matchIdent(code, i, lang)
+			// Qualified decorators: @functools.wraps
+			for end+1 < len(code) && code[end] == '.' && isIdentStart(rune(code[end+1])) {
+				end = matchIdent(code, end+1, lang)
+			}
+			return end
+		}
+	}
+	return i
 }
 
-// isDataType checks if a token is a data type keyword
-func isDataType(token string) bool {
-	dataTypes := map[string]bool{
-		"int": true, "float": true, "double": true, "char": true, "string": true,
-		"bool": true, "boolean": true, "byte": true, "long": true, "short": true,
-		"void": true, "var": true, "let": true, "const": true, "auto": true,
-		"static": true, "final": true, "unsigned": true, "signed": true, "uint": true,
-		"int8": true, "int16": true, "int32": true, "int64": true, "uint8": true,
-		"uint16": true, "uint32": true, "uint64": true, "float32": true, "float64": true,
-		"object": true, "array": true, "map": true, "set": true, "list": true,
-		"vector": true, "dict": true, "tuple": true, "struct": true, "class": true,
-		"interface": true, "enum": true, "union": true, "type": true,
-	}
-
-	return dataTypes[token]
+// matchIdent returns the end of the identifier starting at i
+func matchIdent(code string, i int, lang *language) int {
+	end := i
+	for end < len(code) {
+		r, size := utf8.DecodeRuneInString(code[end:])
+		if !isIdentStart(r) && !isDigit(r) && !strings.ContainsRune(lang.identChars, r) {
+			break
+		}
+		end += size
+	}
+	return end
 }
 
-// isControlFlow checks if a token is a control flow keyword
-func isControlFlow(token string) bool {
-	controlFlow := map[string]bool{
-		"if": true, "else": true, "elif": true, "switch": true, "case": true,
-		"default": true, "for": true, "while": true, "do": true, "foreach": true,
-		"in": true, "of": true, "break": true, "continue": true, "return": true,
-		"yield": true, "goto": true, "try": true, "catch": true, "except": true,
-		"finally": true, "throw": true, "throws": true, "raise": true,
+// followedByColon checks if a colon follows i, after optional spaces
+// In strict mode the colon must be followed by a space or the end of the line, as YAML keys are
+func followedByColon(code string, i int, strict bool) bool {
+	for i < len(code) && (code[i] == ' ' || code[i] == '\t') {
+		i++
 	}
+	if i >= len(code) || code[i] != ':' {
+		return false
+	}
+	return !strict || i+1 >= len(code) || code[i+1] == ' ' || code[i+1] == '\n'
+}
 
-	return controlFlow[token]
+// lineEnd returns the index of the end of the line i is on
+func lineEnd(code string, i int) int {
+	if end := strings.IndexByte(code[i:], '\n'); end >= 0 {
+		return i + end
+	}
+	return len(code)
 }
 
-// isOtherKeyword checks if a token is another common keyword
-func isOtherKeyword(token string) bool {
-	otherKeywords := map[string]bool{
-		"function": true, "func": true, "def": true, "fn": true, "method": true,
-		"import": true, "include": true, "require": true, "from": true, "export": true,
-		"package": true, "namespace": true, "module": true, "using": true, "extends": true,
-		"implements": true, "override": true, "virtual": true, "abstract": true,
-		"public": true, "private": true, "protected": true, "internal": true,
-		"async": true, "await": true, "new": true, "delete": true, "this": true,
-		"self": true, "super": true, "base": true, "null": true, "nil": true,
-		"None": true, "true": true, "false": true, "True": true, "False": true,
-		"and": true, "or": true, "not": true, "instanceof": true, "typeof": true,
-		"sizeof": true, "lambda": true,
-	}
-
-	return otherKeywords[token]
+// isDigit checks if a rune is an ASCII digit
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
 }
 
-// isSQLKeyword checks if a token is an SQL keyword (case insensitive)
-func isSQLKeyword(token string) bool {
-	// Convert token to uppercase for case-insensitive comparison
-	upperToken := strings.ToUpper(token)
-
-	sqlKeywords := map[string]bool{
-		// SQL commands
-		"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true, "CREATE": true,
-		"ALTER": true, "DROP": true, "TRUNCATE": true, "GRANT": true, "REVOKE": true,
-		"COMMIT": true, "ROLLBACK": true, "SAVEPOINT": true, "SET": true,
-
-		// SQL clauses
-		"FROM": true, "WHERE": true, "GROUP": true, "HAVING": true, "ORDER": true,
-		"BY": true, "LIMIT": true, "OFFSET": true, "JOIN": true, "INNER": true,
-		"OUTER": true, "LEFT": true, "RIGHT": true, "FULL": true, "ON": true,
-		"AS": true, "UNION": true, "ALL": true, "INTO": true, "VALUES": true,
-		"DISTINCT": true, "CASE": true, "WHEN": true, "THEN": true, "ELSE": true,
-		"END": true, "WITH": true, "RECURSIVE": true,
-
-		// SQL functions
-		"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true,
-		"COALESCE": true, "NULLIF": true, "CAST": true, "CONVERT": true,
-		"CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true,
-		"EXTRACT": true, "SUBSTRING": true, "CONCAT": true, "TRIM": true,
-		"UPPER": true, "LOWER": true, "LENGTH": true, "ROUND": true,
-
-		// SQL data types
-		"INT": true, "INTEGER": true, "SMALLINT": true, "BIGINT": true,
-		"DECIMAL": true, "NUMERIC": true, "FLOAT": true, "REAL": true,
-		"DOUBLE": true, "PRECISION": true, "CHAR": true, "VARCHAR": true,
-		"TEXT": true, "DATE": true, "TIME": true, "TIMESTAMP": true,
-		"BOOLEAN": true, "BLOB": true, "CLOB": true, "BINARY": true,
-
-		// SQL constraints
-		"PRIMARY": true, "KEY": true, "FOREIGN": true, "UNIQUE": true,
-		"NOT": true, "NULL": true, "CHECK": true, "DEFAULT": true,
-		"AUTO_INCREMENT": true, "IDENTITY": true, "REFERENCES": true,
-		"CASCADE": true, "RESTRICT": true, "NO": true, "ACTION": true,
-
-		// SQL operators
-		"AND": true, "OR": true, "IN": true, "BETWEEN": true,
-		"LIKE": true, "IS": true, "EXISTS": true, "ANY": true, "SOME": true,
-		"INTERSECT": true, "EXCEPT": true, "MINUS": true,
-
-		// Transaction control
-		"BEGIN": true, "TRANSACTION": true, "ISOLATION": true, "LEVEL": true, "READ": true,
-		"WRITE": true, "UNCOMMITTED": true, "COMMITTED": true, "REPEATABLE": true,
-		"SERIALIZABLE": true,
-
-		// Database objects
-		"TABLE": true, "VIEW": true, "INDEX": true, "SEQUENCE": true,
-		"TRIGGER": true, "PROCEDURE": true, "FUNCTION": true, "SCHEMA": true,
-		"DATABASE": true, "COLUMN": true, "CONSTRAINT": true,
-
-		// Other common SQL keywords
-		"IF": true, "WHILE": true, "LOOP": true,
-		"FOR": true, "RETURN": true, "DECLARE": true, "EXCEPTION": true,
-		"RAISE": true, "HANDLER": true, "CONDITION": true, "SIGNAL": true,
-		"RESIGNAL": true, "CALL": true, "EXECUTE": true, "PREPARE": true,
-		"DEALLOCATE": true, "ELSEIF": true,
-	}
-
-	return sqlKeywords[upperToken]
+// isIdentStart checks if a rune can start an identifier
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
 }
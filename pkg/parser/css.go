@@ -0,0 +1,335 @@
+package parser
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ray-d-song/goread/pkg/utils"
+	"golang.org/x/net/html"
+)
+
+// cssCommentRe matches the comments of a stylesheet
+var cssCommentRe = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+// cssProperties are the properties the parser applies, the others are dropped
+var cssProperties = map[string]bool{
+	"display": true, "text-align": true, "white-space": true,
+	"font-weight": true, "font-style": true, "margin-left": true, "direction": true,
+}
+
+// cssRule is a selector of a stylesheet rule with its declarations
+type cssRule struct {
+	selector     []cssCompound // Compound selectors, the element itself last
+	specificity  int
+	declarations map[string]string
+	important    map[string]bool
+}
+
+// cssCompound is a compound selector (p.note#first) and how it relates to the one before it
+type cssCompound struct {
+	tag     string // Empty or * for any element
+	id      string
+	classes []string
+	child   bool // The element is a child of the one matching the previous compound, not any descendant
+}
+
+// stylesheet is the set of rules of the stylesheets of a document
+type stylesheet struct {
+	rules []cssRule
+}
+
+// add parses CSS text and adds its rules, at-rules and unsupported selectors are skipped
+func (s *stylesheet) add(css string) {
+	css = cssCommentRe.ReplaceAllString(css, "")
+	for css != "" {
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			return
+		}
+		prelude := strings.TrimSpace(css[:open])
+		end := matchingBrace(css, open)
+		body := css[open+1 : end]
+		if end < len(css) {
+			end++
+		}
+		css = css[end:]
+
+		// Statements without a block (@import, @charset) end at a semicolon
+		for strings.HasPrefix(prelude, "@") && strings.Contains(prelude, ";") {
+			prelude = strings.TrimSpace(prelude[strings.IndexByte(prelude, ';')+1:])
+		}
+		if prelude == "" || strings.HasPrefix(prelude, "@") {
+			continue
+		}
+
+		declarations, important := parseDeclarations(body)
+		if len(declarations) == 0 {
+			continue
+		}
+		for _, text := range strings.Split(prelude, ",") {
+			selector, specificity, ok := parseSelector(text)
+			if !ok {
+				continue
+			}
+			s.rules = append(s.rules, cssRule{
+				selector:     selector,
+				specificity:  specificity,
+				declarations: declarations,
+				important:    important,
+			})
+		}
+	}
+}
+
+// matchingBrace returns the index of the brace closing the one at open, the end of the text when missing
+func matchingBrace(css string, open int) int {
+	depth := 0
+	for i := open; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(css)
+}
+
+// parseDeclarations parses the declarations of a rule or a style attribute,
+// only the properties the parser applies are kept
+func parseDeclarations(text string) (map[string]string, map[string]bool) {
+	declarations := make(map[string]string)
+	important := make(map[string]bool)
+	for _, declaration := range strings.Split(text, ";") {
+		name, value, ok := strings.Cut(declaration, ":")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.ToLower(strings.TrimSpace(value))
+		if strings.HasSuffix(value, "!important") {
+			value = strings.TrimSpace(strings.TrimSuffix(value, "!important"))
+			important[name] = true
+		}
+		if name == "margin" {
+			// margin: top [right [bottom [left]]]
+			if left, ok := marginLeft(value); ok {
+				declarations["margin-left"] = left
+				important["margin-left"] = important[name]
+			}
+			continue
+		}
+		if cssProperties[name] && value != "" {
+			declarations[name] = value
+		}
+	}
+	return declarations, important
+}
+
+// marginLeft returns the left margin of the margin shorthand
+func marginLeft(value string) (string, bool) {
+	values := strings.Fields(value)
+	switch len(values) {
+	case 1:
+		// margin: all
+		return values[0], true
+	case 2, 3:
+		// margin: vertical horizontal, margin: top horizontal bottom
+		return values[1], true
+	case 4:
+		// margin: top right bottom left
+		return values[3], true
+	}
+	return "", false
+}
+
+// parseSelector parses a selector made of compound selectors joined by descendant
+// and child combinators, ok is false for the selectors the parser doesn't support
+func parseSelector(text string) (selector []cssCompound, specificity int, ok bool) {
+	text = strings.ReplaceAll(text, ">", " > ")
+	child := false
+	for _, part := range strings.Fields(text) {
+		if part == ">" {
+			if len(selector) == 0 || child {
+				return nil, 0, false
+			}
+			child = true
+			continue
+		}
+		if strings.ContainsAny(part, ":[+~()") {
+			// Pseudo-classes, attributes and sibling combinators
+			return nil, 0, false
+		}
+		compound := cssCompound{child: child}
+		child = false
+		for i, piece := range splitCompound(part) {
+			switch {
+			case strings.HasPrefix(piece, "#"):
+				compound.id = piece[1:]
+				specificity += 100
+			case strings.HasPrefix(piece, "."):
+				compound.classes = append(compound.classes, piece[1:])
+				specificity += 10
+			case i == 0:
+				compound.tag = strings.ToLower(piece)
+				if piece != "*" {
+					specificity++
+				}
+			}
+		}
+		selector = append(selector, compound)
+	}
+	if len(selector) == 0 || child {
+		return nil, 0, false
+	}
+	return selector, specificity, true
+}
+
+// splitCompound splits a compound selector before each . and #
+func splitCompound(part string) []string {
+	var pieces []string
+	start := 0
+	for i := 1; i < len(part); i++ {
+		if part[i] == '.' || part[i] == '#' {
+			pieces = append(pieces, part[start:i])
+			start = i
+		}
+	}
+	return append(pieces, part[start:])
+}
+
+// matchCompound checks if an element matches a compound selector
+func matchCompound(n *html.Node, c cssCompound) bool {
+	if c.tag != "" && c.tag != "*" && c.tag != n.Data {
+		return false
+	}
+	if c.id != "" && attrValue(n, "id") != c.id {
+		return false
+	}
+	classes := strings.Fields(attrValue(n, "class"))
+	for _, class := range c.classes {
+		found := false
+		for _, name := range classes {
+			if name == class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSelector checks if an element matches the compound selectors up to the i-th one
+func matchSelector(n *html.Node, selector []cssCompound, i int) bool {
+	if !matchCompound(n, selector[i]) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	for parent := n.Parent; parent != nil && parent.Type == html.ElementNode; parent = parent.Parent {
+		if matchSelector(parent, selector, i-1) {
+			return true
+		}
+		if selector[i].child {
+			return false
+		}
+	}
+	return false
+}
+
+// elementStyle returns the declarations applying to an element, by property,
+// from the stylesheets in the order of the cascade and from its style attribute
+func (s *stylesheet) elementStyle(n *html.Node) map[string]string {
+	var matched []cssRule
+	for _, rule := range s.rules {
+		if matchSelector(n, rule.selector, len(rule.selector)-1) {
+			matched = append(matched, rule)
+		}
+	}
+	// Rules of the same specificity apply in their order
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].specificity < matched[j].specificity
+	})
+
+	style := make(map[string]string)
+	important := make(map[string]bool)
+	for _, rule := range matched {
+		for name, value := range rule.declarations {
+			if !important[name] || rule.important[name] {
+				style[name] = value
+				important[name] = important[name] || rule.important[name]
+			}
+		}
+	}
+	inline, _ := parseDeclarations(attrValue(n, "style"))
+	for name, value := range inline {
+		if !important[name] {
+			style[name] = value
+		}
+	}
+	return style
+}
+
+// cssIndent converts a length to a number of cells, a cell being half an em
+// Percentages and unknown units give no indentation
+func cssIndent(value string) int {
+	units := []struct {
+		suffix string
+		cells  float64
+	}{
+		{"rem", 2}, {"em", 2}, {"ex", 1}, {"ch", 1}, {"px", 1.0 / 8}, {"pt", 1.0 / 6}, {"pc", 2}, {"in", 12}, {"cm", 4.7}, {"mm", 0.47},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
+			if err != nil || n <= 0 {
+				return 0
+			}
+			return int(n*unit.cells + 0.5)
+		}
+	}
+	return 0
+}
+
+// loadStylesheets adds the stylesheets of an HTML document in their order,
+// the linked ones are read with the loader
+func (p *HTMLParser) loadStylesheets(n *html.Node) {
+	if n.Type == html.ElementNode {
+		switch {
+		case n.Data == "style":
+			p.styles.add(nodeText(n))
+		case n.Data == "link" && p.loader != nil && isStylesheetLink(n):
+			css, err := p.loader(attrValue(n, "href"))
+			if err != nil {
+				utils.DebugLog("[WARN:loadStylesheets] Failed to load stylesheet %s: %v", attrValue(n, "href"), err)
+			} else {
+				p.styles.add(css)
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.loadStylesheets(c)
+	}
+}
+
+// isStylesheetLink checks if a <link> links a stylesheet
+func isStylesheetLink(n *html.Node) bool {
+	if attrValue(n, "href") == "" {
+		return false
+	}
+	for _, rel := range strings.Fields(strings.ToLower(attrValue(n, "rel"))) {
+		if rel == "stylesheet" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStylesheets(t *testing.T) {
+	// The lines are 30 cells wide
+	center, right := strings.Repeat(" ", 13), strings.Repeat(" ", 27)
+	tests := []struct {
+		name string
+		css  string
+		body string
+		want []string
+	}{
+		{
+			name: "later rule wins",
+			css:  "p { text-align: center } p { text-align: right }",
+			body: "<p>One</p>",
+			want: []string{right + "One"},
+		},
+		{
+			name: "more specific rule wins over a later one",
+			css:  "p.epigraph { text-align: center } p { text-align: left }",
+			body: `<p class="epigraph">One</p><p>Two</p>`,
+			want: []string{center + "One", "Two"},
+		},
+		{
+			name: "id wins over classes",
+			css:  "#a { font-weight: bold } .x.y { font-weight: normal }",
+			body: `<p id="a" class="x y">One</p>`,
+			want: []string{"[::b]One[::B]"},
+		},
+		{
+			name: "important wins over specificity",
+			css:  "#a { font-weight: bold } p { font-weight: normal !important }",
+			body: `<p id="a">One</p>`,
+			want: []string{"One"},
+		},
+		{
+			name: "style attribute wins over the stylesheet",
+			css:  "p { text-align: right }",
+			body: `<p style="text-align: center">One</p>`,
+			want: []string{center + "One"},
+		},
+		{
+			name: "important wins over the style attribute",
+			css:  "p { text-align: right !important }",
+			body: `<p style="text-align: center">One</p>`,
+			want: []string{right + "One"},
+		},
+		{
+			name: "white-space is inherited",
+			css:  ".poem { white-space: pre }",
+			body: "<div class=\"poem\"><p>Roses  are\n  red</p></div>",
+			want: []string{"Roses  are", "  red"},
+		},
+		{
+			name: "white-space is reset by a descendant",
+			css:  ".poem { white-space: pre } .poem p { white-space: normal }",
+			body: "<div class=\"poem\"><p>Roses  are\n  red</p></div>",
+			want: []string{"Roses are red"},
+		},
+		{
+			name: "text-align is inherited by the blocks",
+			css:  "blockquote { text-align: right; margin-left: 0 }",
+			body: "<blockquote><p>One</p></blockquote>",
+			want: []string{right + "One"},
+		},
+		{
+			name: "display none hides the element",
+			css:  ".sr-only { display: none } .hidden-alt { display: none }",
+			body: `<p>One<span class="sr-only"> (footnote)</span></p><div class="hidden-alt"><p>Two</p></div>`,
+			want: []string{"One"},
+		},
+		{
+			name: "display block and inline",
+			css:  "span.line { display: block } p.run { display: inline }",
+			body: `<p><span class="line">One</span><span class="line">Two</span></p><p class="run">Three</p><p class="run">Four</p>`,
+			want: []string{"One", "Two", "ThreeFour"},
+		},
+		{
+			name: "margin-left indents up to a third of the width",
+			css:  ".in { margin-left: 2em } .more { margin: 0 0 0 3ch } .wide { margin-left: 20em }",
+			body: `<p class="in">One</p><div class="in"><p class="more">Two</p></div><p class="wide">Three</p>`,
+			want: []string{"    One", "       Two", "          Three"},
+		},
+		{
+			name: "child combinator",
+			css:  "div > p { font-style: italic }",
+			body: `<div><p>One</p><section><p>Two</p></section></div>`,
+			want: []string{"[::i]One[::I]", "Two"},
+		},
+		{
+			name: "at-rules, comments and unsupported selectors are skipped",
+			css:  "@media print { p { display: none } } /* p { display: none } */ a:hover, p { font-weight: bold }",
+			body: "<p>One</p>",
+			want: []string{"[::b]One[::B]"},
+		},
+		{
+			name: "linked stylesheet",
+			body: `<p class="linked">One</p>`,
+			want: []string{right + "[::b]One[::B]"},
+		},
+		{
+			name: "style element after the linked stylesheet wins",
+			css:  ".linked { font-weight: normal }",
+			body: `<p class="linked">One</p>`,
+			want: []string{right + "One"},
+		},
+	}
+	for _, tt := range tests {
+		p := NewHTMLParser()
+		p.SetWidth(30)
+		p.SetStylesheetLoader(func(href string) (string, error) {
+			if href != "book.css" {
+				return "", fmt.Errorf("no stylesheet %s", href)
+			}
+			return ".linked { text-align: right; font-weight: bold }", nil
+		})
+		doc := `<html><head><link rel="stylesheet" href="book.css"/><style>` + tt.css + "</style></head><body>" + tt.body + "</body></html>"
+		if err := p.Parse(doc, "", ""); err != nil {
+			t.Fatal(err)
+		}
+		got := p.GetLines()
+		for i := range got {
+			got[i] = strings.TrimRight(got[i], " ")
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: lines = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package parser
+
+// Document is the structure of an HTML file: blocks of text holding inline elements
+// It is laid out as lines of text by a Renderer
+type Document struct {
+	Blocks   []*Block
+	Images   []Image   // Images of the document, Block.Image indexes them
+	NoteRefs []NoteRef // The n-th note reference is the marker [^n]
+	Links    []Link    // The n-th internal link is the marker [→n]
+	IDs      []string  // Ids of the elements with no content after them
+}
+
+// Image is an image of a document with the text describing it
+type Image struct {
+	Src         string // Source of the image
+	Alt         string // Alternative text
+	Title       string // Title attribute
+	Caption     string // Caption of the figure holding the image
+	Description string // Text of the elements its aria-describedby attribute names
+}
+
+// Label returns the text telling what an image is: its caption, alternative text,
+// title or description, the first one it has
+func (i Image) Label() string {
+	for _, text := range []string{i.Caption, i.Alt, i.Title, i.Description} {
+		if text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// BlockKind is the kind of a block of a document
+type BlockKind int
+
+const (
+	BlockParagraph  BlockKind = iota // Text, Inlines
+	BlockHeading                     // Heading of Level 1 to 6, Inlines
+	BlockList                        // List of Ordered or bullet items, Children
+	BlockListItem                    // Item of a list with its Marker, Children
+	BlockTerm                        // Term of a definition list, Inlines
+	BlockDefinition                  // Description of a term, Children
+	BlockQuote                       // Quotation, Children
+	BlockCode                        // Preformatted Code in a Language
+	BlockImage                       // Image of Document.Images with its Label
+	BlockTable                       // Table with its Caption and Rows
+)
+
+// Block is a block of a document, the fields used depend on its kind
+type Block struct {
+	Kind      BlockKind
+	IDs       []string   // Ids of the elements starting with the block
+	Inlines   []Inline   // Content of paragraphs, headings and terms
+	Children  []*Block   // Content of lists, list items, definitions and quotes
+	Level     int        // Level of a heading, 1 to 6
+	Ordered   bool       // The items of a list are numbered
+	Marker    string     // Number or bullet of a list item
+	Code      string     // Text of a code block
+	Language  string     // Language of a code block, empty when unknown
+	Image     int        // Index of an image in Document.Images
+	Label     string     // Text telling what an image is, shown in its marker
+	Size      ImageSize  // Size an image is drawn at in the text, zero when only its marker is shown
+	Caption   []*Block   // Caption of a table
+	Rows      []TableRow // Rows of a table
+	Align     Align      // Alignment of the lines of paragraphs, headings and terms
+	Indent    int        // Left margin of the block, in cells
+	Pre       bool       // The whitespace of the text is kept and the lines aren't wrapped
+	Dir       Direction  // Direction of the text of paragraphs, headings and terms
+	Hyphenate bool       // The words are hyphenated with the dictionary of the language of the text
+}
+
+// ImageSize is the size in cells of an image drawn in the text
+type ImageSize struct {
+	Cols int
+	Rows int
+}
+
+// Align is the alignment of the lines of a block
+type Align int
+
+const (
+	AlignLeft Align = iota
+	AlignCenter
+	AlignRight
+	AlignJustify // The lines but the last ones of the paragraphs fill the width
+)
+
+// Direction is the direction of the text of a block
+type Direction int
+
+const (
+	DirAuto Direction = iota // The direction of the first strong character (letter) of the text
+	DirLTR
+	DirRTL
+)
+
+// TableRow is a row of a table
+type TableRow struct {
+	Cells  []TableCell
+	Header bool
+}
+
+// TableCell is a cell of a table, spanning one or more columns
+type TableCell struct {
+	Blocks  []*Block
+	Colspan int // 1 to 1000
+	Rowspan int // 0 to 65534, 0 for the rest of the row group; the grid draws the rows apart
+	Header  bool
+}
+
+// InlineKind is the kind of an inline element
+type InlineKind int
+
+const (
+	InlineText    InlineKind = iota // Text with its Style, Ref is the link holding it
+	InlineBreak                     // Line break
+	InlineLink                      // Marker of the Ref-th link, after the text of the link
+	InlineNoteRef                   // Marker of the Ref-th note reference
+	InlineAnchor                    // Position of the element with the id ID
+	InlineRuby                      // Ruby base Text with its reading Ruby, shown above it
+)
+
+// Style is a set of text attributes
+type Style uint16
+
+const (
+	StyleBold Style = 1 << iota
+	StyleItalic
+	StyleUnderline
+	StyleStrike
+	StyleCode
+	StyleSuperscript
+	StyleSubscript
+)
+
+// Inline is an inline element of a paragraph
+type Inline struct {
+	Kind  InlineKind
+	Text  string
+	Style Style
+	Ref   int    // Number of a link or a note reference, 0 for text outside links
+	ID    string // Id of an anchor
+	Ruby  string // Reading of a ruby base
+}
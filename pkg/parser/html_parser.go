@@ -1,49 +1,111 @@
 package parser
 
 import (
-	"bytes"
 	"regexp"
 	"strings"
-	"unicode"
+	"unicode/utf8"
 
-	htmllib "html"
+	"github.com/mattn/go-runewidth"
 
 	"golang.org/x/net/html"
 )
 
-// HTMLParser parses HTML content and converts it to lines of text
+// whitespaceRe matches the runs of whitespace collapsed into a single space
+var whitespaceRe = regexp.MustCompile(`\s+`)
+
+// lineBreakRe matches the runs of whitespace holding a line break
+var lineBreakRe = regexp.MustCompile(`\s*\n\s*`)
+
+// HTMLParser parses HTML content into a Document and lays it out as lines of text
 type HTMLParser struct {
-	text       []string
-	images     []string
-	isHead     bool
-	isInde     bool
-	isBull     bool
-	isPref     bool
-	isCode     bool // Flag indicating if we're inside a code block
-	isHidden   bool
-	headIDs    map[int]bool
-	indeIDs    map[int]bool
-	bullIDs    map[int]bool
-	prefIDs    map[int]bool
-	codeIDs    map[int]bool // Mark which lines are code
-	currentTag string
-	buffer     string
+	doc       *Document
+	container *[]*Block                         // Blocks the parsed blocks are added to
+	paragraph *Block                            // Block the parsed inline elements are added to, nil between blocks
+	pending   []string                          // Ids waiting for the next block
+	text      textStyle                         // Style the parsed text inherits from its elements
+	base      int                               // Left margin of the container the blocks are added to, in cells
+	link      int                               // Number of the link the parsed text belongs to, 0 outside links
+	lists     []listState                       // Lists the parser is in, the innermost last
+	width     int                               // Width of the text area the lines are laid out for
+	colors    CodeColors                        // Colors of the highlighted code
+	styles    stylesheet                        // Rules of the stylesheets of the document
+	loader    func(href string) (string, error) // Reads the linked stylesheets
+	ruby      RubyMode                          // How the ruby annotations are shown
+	wideBreak bool                              // The text ends with a line break after a wide character
+	lang      string                            // Language of the text without a lang attribute
+	justify   bool                              // The paragraphs aligned on the left are justified
+	hyphenate bool                              // The words are hyphenated with a dictionary
+	imageSize func(src string) ImageSize        // Size the images are drawn at, nil to only show their markers
+	rendered  *Rendered                         // Lines laid out for the text area, once asked for
+	plain     *Rendered                         // The same lines without styles, once asked for
+}
+
+// textStyle is the style inherited by the text and the blocks of an element
+type textStyle struct {
+	style      Style     // Style of the text
+	align      Align     // Alignment of the blocks
+	whiteSpace string    // CSS white-space: normal, pre, pre-wrap, pre-line...
+	indent     int       // Left margin of the blocks, in cells
+	dir        Direction // Direction of the text of the blocks
+	lang       string    // Language of the text, from the lang attributes
 }
 
 // NewHTMLParser creates a new HTMLParser
 func NewHTMLParser() *HTMLParser {
-	return &HTMLParser{
-		text:    []string{""},
-		images:  []string{},
-		headIDs: make(map[int]bool),
-		indeIDs: make(map[int]bool),
-		bullIDs: make(map[int]bool),
-		prefIDs: make(map[int]bool),
-		codeIDs: make(map[int]bool),
+	p := &HTMLParser{
+		doc: &Document{
+			Images:   []Image{},
+			NoteRefs: []NoteRef{},
+			Links:    []Link{},
+		},
 	}
+	p.container = &p.doc.Blocks
+	return p
+}
+
+// SetWidth sets the width of the text area the lines are laid out for
+func (p *HTMLParser) SetWidth(width int) {
+	p.width = width
+	p.rendered = nil
+	p.plain = nil
+}
+
+// SetCodeColors sets the colors of the highlighted code
+func (p *HTMLParser) SetCodeColors(colors CodeColors) {
+	p.colors = colors
+	p.rendered = nil
+}
+
+// SetLanguage sets the language of the text without a lang attribute
+func (p *HTMLParser) SetLanguage(lang string) {
+	p.lang = lang
+}
+
+// SetJustify sets if the paragraphs aligned on the left are justified
+func (p *HTMLParser) SetJustify(justify bool) {
+	p.justify = justify
+}
+
+// SetHyphenation sets if the words are hyphenated with the dictionary of their language,
+// only English has one
+func (p *HTMLParser) SetHyphenation(hyphenate bool) {
+	p.hyphenate = hyphenate
 }
 
-// Parse parses HTML content and converts it to lines of text
+// SetImageSize sets the function giving the size the images are drawn at in the text,
+// a zero size leaves an image as its marker
+// The images narrower than the text area are made smaller to fit
+func (p *HTMLParser) SetImageSize(size func(src string) ImageSize) {
+	p.imageSize = size
+}
+
+// SetStylesheetLoader sets the function reading the stylesheets linked by the HTML,
+// the href is the one of the <link>
+func (p *HTMLParser) SetStylesheetLoader(loader func(href string) (string, error)) {
+	p.loader = loader
+}
+
+// Parse parses HTML content into the document
 func (p *HTMLParser) Parse(content string, startAnchor string, nextAnchor string) error {
 	var err error
 	if startAnchor != "" {
@@ -58,85 +120,333 @@ func (p *HTMLParser) Parse(content string, startAnchor string, nextAnchor string
 		return err
 	}
 
+	p.loadStylesheets(doc)
 	p.parseNode(doc)
+	p.endParagraph()
+	p.doc.IDs = append(p.doc.IDs, p.pending...)
+	p.pending = nil
+	p.rendered = nil
+	p.plain = nil
 	return nil
 }
 
 // parseNode parses an HTML node and its children
 func (p *HTMLParser) parseNode(n *html.Node) {
-	if n.Type == html.ElementNode {
-		p.handleStartTag(n)
-	} else if n.Type == html.TextNode {
+	switch n.Type {
+	case html.TextNode:
 		p.handleText(n.Data)
+	case html.ElementNode:
+		p.handleElement(n)
+	default:
+		p.parseChildren(n)
 	}
+}
 
+// parseChildren parses the children of a node
+func (p *HTMLParser) parseChildren(n *html.Node) {
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
 		p.parseNode(c)
 	}
+}
 
-	if n.Type == html.ElementNode {
-		p.handleEndTag(n)
+// parseInto parses the children of a node into the blocks of a container
+func (p *HTMLParser) parseInto(n *html.Node, container *[]*Block) {
+	outer, paragraph, base := p.container, p.paragraph, p.base
+	p.container, p.paragraph, p.base = container, nil, p.text.indent
+	p.parseChildren(n)
+	p.endParagraph()
+	p.container, p.paragraph, p.base = outer, paragraph, base
+}
+
+// addBlock adds a block to the current container, the ids waiting for a block start with it
+func (p *HTMLParser) addBlock(b *Block) {
+	p.endParagraph()
+	b.IDs = append(b.IDs, p.pending...)
+	p.pending = nil
+	b.Align = p.text.align
+	b.Indent = p.text.indent - p.base
+	b.Pre = isPreformatted(p.text.whiteSpace)
+	b.Dir = p.text.dir
+	lang := p.text.lang
+	if lang == "" {
+		lang = p.lang
+	}
+	b.Hyphenate = p.hyphenate && hasHyphenation(lang)
+	if p.justify && b.Align == AlignLeft {
+		b.Align = AlignJustify
+	}
+	*p.container = append(*p.container, b)
+}
+
+// startParagraph adds a block receiving the inline elements parsed next
+func (p *HTMLParser) startParagraph(b *Block) {
+	p.addBlock(b)
+	p.paragraph = b
+}
+
+// endParagraph ends the block receiving the inline elements, the whitespace at its end is dropped
+func (p *HTMLParser) endParagraph() {
+	if p.paragraph == nil {
+		return
+	}
+	inlines := p.paragraph.Inlines
+	if p.paragraph.Pre {
+		// The newline ending preformatted text doesn't start a line
+		for len(inlines) > 0 && inlines[len(inlines)-1].Kind == InlineBreak {
+			inlines = inlines[:len(inlines)-1]
+		}
+		p.paragraph.Inlines = inlines
+	}
+	for i := len(inlines) - 1; i >= 0 && inlines[i].Kind != InlineBreak; i-- {
+		if inlines[i].Kind == InlineText {
+			inlines[i].Text = strings.TrimRight(inlines[i].Text, " ")
+			if inlines[i].Text != "" {
+				break
+			}
+		}
+	}
+	p.paragraph = nil
+}
+
+// addInline adds an inline element to the current paragraph, starting one if needed
+func (p *HTMLParser) addInline(inline Inline) {
+	if p.paragraph == nil {
+		p.startParagraph(&Block{Kind: BlockParagraph})
+	}
+	p.paragraph.Inlines = append(p.paragraph.Inlines, inline)
+}
+
+// addAnchor records where the element with the id starts
+func (p *HTMLParser) addAnchor(id string) {
+	if p.paragraph != nil {
+		p.paragraph.Inlines = append(p.paragraph.Inlines, Inline{Kind: InlineAnchor, ID: id})
+	} else {
+		p.pending = append(p.pending, id)
 	}
 }
 
 // handleText handles text nodes
 func (p *HTMLParser) handleText(data string) {
-	if data == "" || p.isHidden {
+	if data == "" {
+		return
+	}
+	if p.paragraph == nil && strings.TrimSpace(data) == "" {
+		// Whitespace between blocks
 		return
 	}
 
-	// Process the text
-	if p.text[len(p.text)-1] == "" {
-		data = strings.TrimLeftFunc(data, unicode.IsSpace)
+	switch p.text.whiteSpace {
+	case "pre", "pre-wrap", "break-spaces":
+		if p.paragraph == nil {
+			// A newline right after the start of the element isn't part of the text
+			data = strings.TrimPrefix(strings.TrimPrefix(data, "\r"), "\n")
+		}
+		p.addLines(strings.Split(data, "\n"))
+		return
+	case "pre-line":
+		// Spaces are collapsed, the newlines are kept
+		lines := strings.Split(data, "\n")
+		for i, l := range lines {
+			l = whitespaceRe.ReplaceAllString(l, " ")
+			if i > 0 || p.atLineStart() {
+				l = strings.TrimLeft(l, " ")
+			}
+			if i < len(lines)-1 {
+				l = strings.TrimRight(l, " ")
+			}
+			lines[i] = l
+		}
+		p.addLines(lines)
+		return
 	}
 
-	if p.isPref {
-		p.buffer += htmllib.UnescapeString(data)
-	} else {
-		// Replace multiple whitespace with a single space
-		re := regexp.MustCompile(`\s+`)
-		data = re.ReplaceAllString(data, " ")
-		p.buffer += htmllib.UnescapeString(data)
-	}
-
-	// If we have accumulated text, add it to the current line
-	if p.buffer != "" {
-		// Apply code highlighting if in a code block
-		if p.isCode {
-			p.text[len(p.text)-1] += formatCodeLine(p.buffer, "")
-		} else {
-			p.text[len(p.text)-1] += p.buffer
+	// Line breaks between wide characters (CJK) aren't spaces
+	p.dropWideBreak(data)
+	data, p.wideBreak = joinWideLines(data, p.lastRune())
+
+	// Replace multiple whitespace with a single space
+	data = whitespaceRe.ReplaceAllString(data, " ")
+
+	// Whitespace at the start of a line or after a space is dropped
+	if p.atLineStart() {
+		data = strings.TrimLeft(data, " ")
+	}
+	if data == "" {
+		return
+	}
+	p.addInline(Inline{Kind: InlineText, Text: data, Style: p.text.style, Ref: p.link})
+}
+
+// joinWideLines removes the line breaks between wide characters, CJK text has no spaces between words
+// before is the character preceding the text, trailing tells if the text ends with a line break after a wide character
+func joinWideLines(data string, before rune) (string, bool) {
+	var b strings.Builder
+	trailing := false
+	last := 0
+	for _, match := range lineBreakRe.FindAllStringIndex(data, -1) {
+		prev := before
+		if match[0] > 0 {
+			prev, _ = utf8.DecodeLastRuneInString(data[:match[0]])
+		}
+		b.WriteString(data[last:match[0]])
+		last = match[1]
+		if runewidth.RuneWidth(prev) != 2 {
+			b.WriteString(data[match[0]:match[1]])
+			continue
+		}
+		if match[1] == len(data) {
+			// The text going on decides
+			trailing = true
+			b.WriteString(data[match[0]:match[1]])
+			continue
+		}
+		if next, _ := utf8.DecodeRuneInString(data[match[1]:]); runewidth.RuneWidth(next) != 2 {
+			b.WriteString(data[match[0]:match[1]])
 		}
-		p.buffer = ""
-
-		// Mark the line with the appropriate type
-		lineIndex := len(p.text) - 1
-		if p.isHead {
-			p.headIDs[lineIndex] = true
-		} else if p.isBull {
-			p.bullIDs[lineIndex] = true
-		} else if p.isInde {
-			p.indeIDs[lineIndex] = true
-		} else if p.isPref {
-			p.prefIDs[lineIndex] = true
-			if p.isCode {
-				p.codeIDs[lineIndex] = true
+	}
+	b.WriteString(data[last:])
+	return b.String(), trailing
+}
+
+// dropWideBreak drops the space left by a line break after a wide character
+// when the text going on starts with a wide character
+func (p *HTMLParser) dropWideBreak(next string) {
+	if !p.wideBreak || p.paragraph == nil {
+		return
+	}
+	p.wideBreak = false
+	r, _ := utf8.DecodeRuneInString(strings.TrimSpace(next))
+	if runewidth.RuneWidth(r) != 2 {
+		return
+	}
+	inlines := p.paragraph.Inlines
+	if n := len(inlines); n > 0 && inlines[n-1].Kind == InlineText {
+		inlines[n-1].Text = strings.TrimSuffix(inlines[n-1].Text, " ")
+	}
+}
+
+// lastRune returns the last character of the current paragraph, 0 when there's none
+func (p *HTMLParser) lastRune() rune {
+	if p.paragraph == nil {
+		return 0
+	}
+	inlines := p.paragraph.Inlines
+	for i := len(inlines) - 1; i >= 0; i-- {
+		switch inlines[i].Kind {
+		case InlineText, InlineRuby:
+			if inlines[i].Text != "" {
+				r, _ := utf8.DecodeLastRuneInString(inlines[i].Text)
+				return r
 			}
+		case InlineAnchor:
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// addLines adds lines of text separated by line breaks
+func (p *HTMLParser) addLines(lines []string) {
+	for i, l := range lines {
+		if i > 0 {
+			p.addInline(Inline{Kind: InlineBreak})
+		}
+		if l = strings.TrimSuffix(l, "\r"); l != "" {
+			p.addInline(Inline{Kind: InlineText, Text: l, Style: p.text.style, Ref: p.link})
+		}
+	}
+}
+
+// atLineStart checks if the next text starts a line or follows a space
+func (p *HTMLParser) atLineStart() bool {
+	if p.paragraph == nil {
+		return true
+	}
+	inlines := p.paragraph.Inlines
+	for i := len(inlines) - 1; i >= 0; i-- {
+		switch inlines[i].Kind {
+		case InlineBreak:
+			return true
+		case InlineText:
+			return strings.HasSuffix(inlines[i].Text, " ")
+		case InlineLink, InlineNoteRef:
+			return false
 		}
 	}
+	return true
+}
+
+// GetDocument returns the parsed document
+func (p *HTMLParser) GetDocument() *Document {
+	return p.doc
+}
+
+// render lays out the document for the text area, the layout is kept until the width changes
+func (p *HTMLParser) render() *Rendered {
+	if p.rendered == nil {
+		p.rendered = TviewRenderer{Colors: p.colors}.Render(p.doc, p.width)
+	}
+	return p.rendered
 }
 
-// GetLines returns the parsed lines of text
+// GetLines returns the parsed lines of text, styled with tview tags
 func (p *HTMLParser) GetLines() []string {
-	return p.text
+	return p.render().Lines
+}
+
+// GetPlainLines returns the lines of text without styles, laid out like GetLines
+func (p *HTMLParser) GetPlainLines() []string {
+	if p.plain == nil {
+		p.plain = PlainRenderer{}.Render(p.doc, p.width)
+	}
+	return p.plain.Lines
+}
+
+// GetBidiLines returns the lines of GetLines written in visual order for right-to-left text, by index
+func (p *HTMLParser) GetBidiLines() map[int]BidiLine {
+	return p.render().Bidi
+}
+
+// GetPositions returns the position in the text of each line of GetLines, see Rendered.Positions
+func (p *HTMLParser) GetPositions() []int {
+	return p.render().Positions
+}
+
+// GetTextLines returns the text of the document held by each line of GetLines, for searching it
+func (p *HTMLParser) GetTextLines() []TextLine {
+	return p.render().Text
+}
+
+// GetImageBoxes returns the places of the images drawn over the lines of GetLines
+func (p *HTMLParser) GetImageBoxes() []ImageBox {
+	return p.render().Images
+}
+
+// GetImages returns the images found in the HTML with the text describing them,
+// the marker [IMG:n] in the text is the n-th one
+func (p *HTMLParser) GetImages() []Image {
+	return p.doc.Images
 }
 
-// GetImages returns the images found in the HTML
-func (p *HTMLParser) GetImages() []string {
-	return p.images
+// GetNoteRefs returns the note references found in the HTML,
+// the marker [^n] in the text refers to the n-th one
+func (p *HTMLParser) GetNoteRefs() []NoteRef {
+	return p.doc.NoteRefs
 }
 
-// DumpHTML dumps the HTML content as plain text
+// GetLinks returns the internal links found in the HTML,
+// the marker [→n] in the text refers to the n-th one
+func (p *HTMLParser) GetLinks() []Link {
+	return p.doc.Links
+}
+
+// GetAnchors returns the line of the text each element id lands on
+func (p *HTMLParser) GetAnchors() map[string]int {
+	return p.render().Anchors
+}
+
+// DumpHTML dumps the HTML content as plain text, with a blank line between the blocks
 func DumpHTML(content string) (string, error) {
 	parser := NewHTMLParser()
 	err := parser.Parse(content, "", "")
@@ -144,13 +454,10 @@ func DumpHTML(content string) (string, error) {
 		return "", err
 	}
 
-	lines := parser.text
-	var buf bytes.Buffer
-
-	for _, line := range lines {
-		buf.WriteString(line)
-		buf.WriteString("\n\n")
+	rendered := PlainRenderer{}.Render(parser.doc, NoWrap)
+	text := DumpText(rendered.Lines, rendered.Text)
+	if text == "" {
+		return "", nil
 	}
-
-	return buf.String(), nil
+	return text + "\n", nil
 }
@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rivo/tview"
+)
+
+func TestDumpHTML(t *testing.T) {
+	long := strings.TrimSpace(strings.Repeat("many words ", 20))
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{name: "long paragraph", html: "<p>" + long + "</p>", want: long + "\n"},
+		{name: "blocks", html: "<h1>Title</h1><p>One</p><p style=\"text-align: center\">Two</p>", want: "Title\n\nOne\n\nTwo\n"},
+		{name: "line breaks", html: "<p>one<br>two</p>", want: "one\ntwo\n"},
+		{name: "preformatted", html: "<pre>a\n\n\tb</pre><p>c</p>", want: "a\n\n    b\n\nc\n"},
+		{name: "list", html: "<ul><li>" + long + "</li><li>two</li></ul>", want: "  • " + long + "\n\n  • two\n"},
+		{name: "empty", html: "<p></p>", want: ""},
+	}
+	for _, tt := range tests {
+		got, err := DumpHTML(tt.html)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: DumpHTML = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestImageLabelIsEscaped(t *testing.T) {
+	tests := []struct {
+		alt  string
+		want string // Text shown
+	}{
+		{alt: "plain", want: "[IMG:0 - plain]"},
+		{alt: "see [b] and [red]", want: "[IMG:0 - see [b] and [red]]"},
+		{alt: "[::b]bold", want: "[IMG:0 - [::b]bold]"},
+	}
+	for _, tt := range tests {
+		p := NewHTMLParser()
+		if err := p.Parse(`<p><img src="a.png" alt="`+tt.alt+`"/></p>`, "", ""); err != nil {
+			t.Fatal(err)
+		}
+		lines := p.GetLines()
+		if len(lines) == 0 {
+			t.Fatalf("%q: no lines", tt.alt)
+		}
+		view := tview.NewTextView().SetDynamicColors(true).SetText(lines[0])
+		if got := view.GetText(true); got != tt.want {
+			t.Errorf("%q: line %q shows %q, want %q", tt.alt, lines[0], got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package parser
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+// softHyphen (&shy;) marks where a word may be hyphenated, it's only shown at the end of a line
+const softHyphen = '\u00ad'
+
+// The shortest heads and tails the words are hyphenated into, the ones of TeX for English
+const (
+	hyphenMinLeft  = 2
+	hyphenMinRight = 3
+)
+
+// Liang's hyphenation patterns for American English and their list of exceptions,
+// the ones of TeX (hyph-en-us)
+var (
+	//go:embed hyph-en-us.pat.txt
+	englishPatterns string
+	//go:embed hyph-en-us.hyp.txt
+	englishExceptions string
+)
+
+// hasHyphenation checks if there's a hyphenation dictionary for a language (en, en-US...)
+func hasHyphenation(lang string) bool {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	return lang == "en" || strings.HasPrefix(lang, "en-") || strings.HasPrefix(lang, "en_")
+}
+
+// hyphenator finds where words can be hyphenated with Liang's algorithm
+type hyphenator struct {
+	patterns   map[string][]int // Letters of a pattern -> its values before, between and after them
+	exceptions map[string][]int // Word -> number of letters before each of its hyphens
+	longest    int              // Number of letters of the longest pattern
+}
+
+// englishHyphenator is the hyphenator of English, made once it's needed
+var englishHyphenator = sync.OnceValue(func() *hyphenator {
+	return newHyphenator(englishPatterns, englishExceptions)
+})
+
+// newHyphenator makes a hyphenator from patterns (a1b2c) and exceptions (hy-phen), whitespace separated
+func newHyphenator(patterns string, exceptions string) *hyphenator {
+	h := &hyphenator{patterns: make(map[string][]int), exceptions: make(map[string][]int)}
+	for _, pattern := range strings.Fields(patterns) {
+		var letters strings.Builder
+		values := []int{0}
+		for _, r := range pattern {
+			if r >= '0' && r <= '9' {
+				values[len(values)-1] = int(r - '0')
+			} else {
+				letters.WriteRune(r)
+				values = append(values, 0)
+			}
+		}
+		h.patterns[letters.String()] = values
+		h.longest = max(h.longest, letters.Len())
+	}
+	for _, exception := range strings.Fields(exceptions) {
+		var points []int
+		letters := 0
+		for _, r := range exception {
+			if r == '-' {
+				points = append(points, letters)
+			} else {
+				letters++
+			}
+		}
+		h.exceptions[strings.ReplaceAll(exception, "-", "")] = points
+	}
+	return h
+}
+
+// hyphenate returns the number of letters before each place a word of ASCII letters can be hyphenated at
+func (h *hyphenator) hyphenate(word string) []int {
+	word = strings.ToLower(word)
+	if len(word) < hyphenMinLeft+hyphenMinRight {
+		return nil
+	}
+	if points, ok := h.exceptions[word]; ok {
+		return points
+	}
+
+	// values[i] is the value between the letters i-1 and i of the word between dots
+	text := "." + word + "."
+	values := make([]int, len(text)+1)
+	for i := range text {
+		for j := i + 1; j <= len(text) && j-i <= h.longest; j++ {
+			pattern, ok := h.patterns[text[i:j]]
+			if !ok {
+				continue
+			}
+			for k, v := range pattern {
+				values[i+k] = max(values[i+k], v)
+			}
+		}
+	}
+
+	// Odd values are hyphens
+	var points []int
+	for n := hyphenMinLeft; n <= len(word)-hyphenMinRight; n++ {
+		if values[n+1]%2 == 1 {
+			points = append(points, n)
+		}
+	}
+	return points
+}
@@ -0,0 +1,247 @@
+package parser
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// language are the lexing rules of a programming language
+type language struct {
+	keywords      map[string]bool
+	types         map[string]bool
+	constants     map[string]bool
+	functions     map[string]bool // Known functions and commands, colored even when not called with ()
+	lineComments  []string
+	blockComments [][2]string
+	quotes        []quote // Longer delimiters first
+	namePrefixes  string  // Characters starting a name: $VAR, @decorator
+	identChars    string  // Characters allowed in identifiers besides letters, digits and _
+	ignoreCase    bool    // Keywords match in any case (SQL)
+	keys          bool    // Names followed by a colon are keys (JSON, YAML)
+	macros        bool    // Names followed by ! are macros (Rust)
+	preprocessor  bool    // Lines starting with # are preprocessor directives (C, C++)
+}
+
+// quote is a delimiter of string literals
+type quote struct {
+	delim     string
+	raw       bool // Backslashes don't escape
+	multiline bool // The string can span lines
+}
+
+// words returns a set of the space separated words
+func words(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		set[w] = true
+	}
+	return set
+}
+
+var (
+	cComments     = [][2]string{{"/*", "*/"}}
+	cQuotes       = []quote{{delim: `"`}, {delim: `'`}}
+	jsQuotes      = []quote{{delim: `"`}, {delim: `'`}, {delim: "`", multiline: true}}
+	pythonQuotes  = []quote{{delim: `"""`, multiline: true}, {delim: `'''`, multiline: true}, {delim: `"`}, {delim: `'`}}
+	shellQuotes   = []quote{{delim: `"`, multiline: true}, {delim: `'`, raw: true, multiline: true}}
+	sqlQuotes     = []quote{{delim: `'`, raw: true, multiline: true}, {delim: `"`, raw: true}}
+	doubleQuoted  = []quote{{delim: `"`}}
+	yamlQuotes    = []quote{{delim: `"`}, {delim: `'`, raw: true}}
+	slashComments = []string{"//"}
+	hashComments  = []string{"#"}
+)
+
+// languages are the languages code is highlighted for, by name
+var languages = map[string]*language{
+	"go": {
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var`),
+		types: words(`bool byte complex64 complex128 error float32 float64 int int8 int16 int32 int64
+			rune string uint uint8 uint16 uint32 uint64 uintptr any comparable`),
+		constants: words(`true false nil iota`),
+		functions: words(`append cap clear close complex copy delete imag len make max min new panic print
+			println real recover`),
+		lineComments:  slashComments,
+		blockComments: cComments,
+		quotes:        []quote{{delim: `"`}, {delim: `'`}, {delim: "`", raw: true, multiline: true}},
+	},
+	"python": {
+		keywords: words(`and as assert async await break class continue def del elif else except finally
+			for from global if import in is lambda nonlocal not or pass raise return try while with yield
+			match case`),
+		types:        words(`int float complex str bytes bytearray bool list tuple dict set frozenset object type`),
+		constants:    words(`True False None self cls`),
+		functions:    words(`print len range open isinstance super enumerate zip map filter sorted`),
+		lineComments: hashComments,
+		quotes:       pythonQuotes,
+		namePrefixes: "@",
+	},
+	"javascript": {
+		keywords: words(`break case catch class const continue debugger default delete do else export extends
+			finally for function if import in instanceof let new return super switch this throw try typeof
+			var void while with yield async await of static get set from as interface type enum implements
+			private public protected readonly declare namespace abstract keyof`),
+		types:         words(`string number boolean any unknown never object symbol bigint Array Promise Map Set`),
+		constants:     words(`true false null undefined NaN Infinity`),
+		lineComments:  slashComments,
+		blockComments: cComments,
+		quotes:        jsQuotes,
+		namePrefixes:  "@",
+	},
+	"rust": {
+		keywords: words(`as async await break const continue crate dyn else enum extern fn for if impl in let
+			loop match mod move mut pub ref return self Self static struct super trait type unsafe use where
+			while`),
+		types: words(`i8 i16 i32 i64 i128 isize u8 u16 u32 u64 u128 usize f32 f64 bool char str String Vec
+			Option Result Box`),
+		constants:     words(`true false None Some Ok Err`),
+		lineComments:  slashComments,
+		blockComments: cComments,
+		quotes:        []quote{{delim: `"`, multiline: true}},
+		macros:        true,
+	},
+	"c": {
+		keywords: words(`auto break case const continue default do else enum extern for goto if inline
+			register restrict return sizeof static struct switch typedef union volatile while
+			class namespace template typename public private protected virtual override new delete this
+			throw try catch using operator friend explicit constexpr noexcept mutable final static_cast
+			dynamic_cast reinterpret_cast const_cast`),
+		types: words(`void char short int long float double signed unsigned bool size_t ssize_t int8_t
+			int16_t int32_t int64_t uint8_t uint16_t uint32_t uint64_t wchar_t FILE std string vector auto`),
+		constants:     words(`true false NULL nullptr`),
+		lineComments:  slashComments,
+		blockComments: cComments,
+		quotes:        cQuotes,
+		preprocessor:  true,
+	},
+	"java": {
+		keywords: words(`abstract assert break case catch class continue default do else enum extends final
+			finally for if implements import instanceof interface native new package private protected
+			public return static super switch synchronized this throw throws transient try volatile while
+			var record sealed permits yield`),
+		types: words(`boolean byte char short int long float double void String Object Integer Long Double
+			Boolean List Map Set`),
+		constants:     words(`true false null`),
+		lineComments:  slashComments,
+		blockComments: cComments,
+		quotes:        []quote{{delim: `"""`, multiline: true}, {delim: `"`}, {delim: `'`}},
+		namePrefixes:  "@",
+	},
+	"sql": {
+		keywords: words(`select insert update delete create alter drop truncate grant revoke commit rollback
+			savepoint set from where group having order by limit offset join inner outer left right full
+			cross natural on using as union all into values distinct case when then else end with recursive
+			primary key foreign unique not null check default references cascade restrict and or in between
+			like ilike is exists any some intersect except begin transaction table view index sequence
+			trigger procedure function schema database column constraint if returns return declare asc desc
+			over partition window replace`),
+		types: words(`int integer smallint bigint decimal numeric float real double precision char varchar
+			text date time timestamp interval boolean blob clob binary serial uuid json jsonb`),
+		constants:     words(`true false null`),
+		functions:     words(`count sum avg min max coalesce nullif cast extract substring concat trim upper lower length round now`),
+		lineComments:  []string{"--"},
+		blockComments: cComments,
+		quotes:        sqlQuotes,
+		ignoreCase:    true,
+	},
+	"shell": {
+		keywords: words(`if then else elif fi for while until do done case esac in function return local
+			export select break continue readonly declare`),
+		functions: words(`echo cd ls grep sed awk cat printf read set unset source exit test mkdir rm cp mv
+			chmod chown curl wget git sudo make go npm pip tar find xargs`),
+		lineComments: hashComments,
+		quotes:       shellQuotes,
+		namePrefixes: "$",
+		identChars:   "-",
+	},
+	"json": {
+		constants:  words(`true false null`),
+		quotes:     doubleQuoted,
+		keys:       true,
+		identChars: "-",
+	},
+	"yaml": {
+		constants:    words(`true false null yes no on off True False Null`),
+		lineComments: hashComments,
+		quotes:       yamlQuotes,
+		identChars:   "-.",
+		keys:         true,
+	},
+}
+
+// languageAliases are the other names the languages go by
+var languageAliases = map[string]string{
+	"golang": "go",
+	"py":     "python", "python3": "python", "py3": "python",
+	"js": "javascript", "jsx": "javascript", "mjs": "javascript", "node": "javascript",
+	"ts": "javascript", "tsx": "javascript", "typescript": "javascript",
+	"rs": "rust",
+	"h":  "c", "cpp": "c", "c++": "c", "cxx": "c", "cc": "c", "hpp": "c", "objc": "c",
+	"mysql": "sql", "postgresql": "sql", "postgres": "sql", "psql": "sql", "sqlite": "sql", "plsql": "sql",
+	"sh": "shell", "bash": "shell", "zsh": "shell", "ksh": "shell", "console": "shell",
+	"shell-session": "shell", "terminal": "shell",
+	"jsonc": "json", "json5": "json",
+	"yml": "yaml",
+}
+
+// lookupLanguage returns the rules of a language from its name or alias, nil when unknown
+func lookupLanguage(name string) *language {
+	name = strings.ToLower(name)
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	return languages[name]
+}
+
+// languageName returns the name of a known language from its name or alias, empty when unknown
+func languageName(name string) string {
+	name = strings.ToLower(strings.Trim(name, ";,:"))
+	if alias, ok := languageAliases[name]; ok {
+		return alias
+	}
+	if languages[name] != nil {
+		return name
+	}
+	return ""
+}
+
+// languageHints are the patterns telling the language of code without a declared language,
+// the first match wins
+var languageHints = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"shell", regexp.MustCompile(`(?m)^(#!\S*\b(ba|z)?sh\b|\$ \S)`)},
+	{"c", regexp.MustCompile(`(?m)^#include\b|\bint main\s*\(|\bprintf\(|\bstd::`)},
+	{"go", regexp.MustCompile(`(?m)^package \w+$|\bfunc (\([^)]*\) )?\w+\(|:= `)},
+	{"rust", regexp.MustCompile(`\bfn \w+|\blet mut\b|\bprintln!|\bimpl\b|\buse \w+::`)},
+	{"java", regexp.MustCompile(`\bpublic (static )?(final )?(class|void|interface)\b|\bSystem\.out\.|\bprivate \w+ \w+;`)},
+	{"python", regexp.MustCompile(`(?m)^\s*(def \w+\(.*\):|class \w+.*:$|import \w+$|from [\w.]+ import\b|elif\b|print\()`)},
+	{"javascript", regexp.MustCompile(`\b(const|let|var) \w+ =|\bfunction\s*\w*\(|=>|\bconsole\.log\(|\brequire\(`)},
+	{"sql", regexp.MustCompile(`(?is)\bselect\b.+\bfrom\b|\binsert into\b|\bcreate table\b|\bupdate \w+ set\b|\bdelete from\b`)},
+	{"shell", regexp.MustCompile(`(?m)^\s*(sudo|apt(-get)?|brew|cd|echo|export|mkdir|git|npm|pip|curl) `)},
+}
+
+// yamlLineRe matches the key lines of YAML
+var yamlLineRe = regexp.MustCompile(`(?m)^\s*(- )?[\w.-]+:( |$)`)
+
+// detectLanguage guesses the language of code, empty when it can't tell
+func detectLanguage(code string) string {
+	trimmed := strings.TrimSpace(code)
+	if trimmed == "" {
+		return ""
+	}
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)) {
+		return "json"
+	}
+	for _, hint := range languageHints {
+		if hint.pattern.MatchString(code) {
+			return hint.name
+		}
+	}
+	if len(yamlLineRe.FindAllString(code, 2)) == 2 && !strings.ContainsAny(code, "{};") {
+		return "yaml"
+	}
+	return ""
+}
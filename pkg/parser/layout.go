@@ -0,0 +1,410 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// listIndent is the indentation of a list relative to the text it's nested in
+const listIndent = "  "
+
+// definitionIndent is the indentation of the description of a definition list
+const definitionIndent = "    "
+
+// headingStyles are the styles of the headings, by level
+var headingStyles = map[int]Style{
+	1: StyleBold | StyleUnderline, 2: StyleBold, 3: StyleBold | StyleItalic,
+	4: StyleItalic, 5: StyleItalic, 6: StyleItalic,
+}
+
+// layoutMode is how the lines of the blocks are laid out
+type layoutMode int
+
+const (
+	layoutWrap  layoutMode = iota // Lines are wrapped to the width, each one is a row of the text area
+	layoutCell                    // Lines are kept whole to measure table cells, without alignment or margins
+	layoutWhole                   // Lines are kept whole to dump the text, without alignment
+)
+
+// span is a piece of a laid out line in a single style
+type span struct {
+	text   string
+	style  Style
+	token  TokenKind // Kind of the token of highlighted code
+	marker bool      // Markers ([^n], [→n], [IMG:n]) are written as they are
+	anchor string    // Id of the element starting here, the span has no text
+	ruby   string    // Reading of a ruby base, shown above it
+	dir    Direction // Direction of the paragraph holding right-to-left text, shown in visual order
+	image  int       // Image drawn over the blank span, index in Document.Images plus one
+	joint  Joint     // How the line going on from here follows the one before, the span has no text
+	gap    bool      // Space between two words, widened to justify the line
+	hyphen bool      // Hyphen added where a word is broken, not in the text of the document
+}
+
+// isText checks if the span is text the lines can break in
+func (s span) isText() bool {
+	return !s.marker && s.anchor == "" && s.ruby == ""
+}
+
+// line is a laid out line of text
+type line []span
+
+// width returns the number of cells the line takes on the screen
+func (l line) width() int {
+	w := 0
+	for _, s := range l {
+		w += textWidth(s.text)
+	}
+	return w
+}
+
+// isBlank checks if the line shows nothing but spaces, an image is drawn over its blank spans
+func (l line) isBlank() bool {
+	for _, s := range l {
+		if s.image != 0 || strings.TrimSpace(s.text) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// text returns the text of the line without its styles
+func (l line) text() string {
+	var b strings.Builder
+	for _, s := range l {
+		b.WriteString(s.text)
+	}
+	return b.String()
+}
+
+// layoutDocument lays out the blocks of a document for a width, the lines are kept whole for NoWrap
+// anchors maps the ids of the elements to the line they start on
+func layoutDocument(doc *Document, width int) (lines []line, anchors map[string]int) {
+	switch {
+	case width == NoWrap:
+		lines, anchors = layoutBlocks(doc.Blocks, math.MaxInt32, layoutWhole)
+	case width <= 0:
+		lines, anchors = layoutBlocks(doc.Blocks, defaultWidth, layoutWrap)
+	default:
+		lines, anchors = layoutBlocks(doc.Blocks, width, layoutWrap)
+	}
+	for _, id := range doc.IDs {
+		if _, ok := anchors[id]; !ok {
+			anchors[id] = max(len(lines)-1, 0)
+		}
+	}
+	return lines, anchors
+}
+
+// layoutBlocks lays out blocks one after another
+// Blocks with a margin take at most a third of the width for it
+func layoutBlocks(blocks []*Block, width int, mode layoutMode) ([]line, map[string]int) {
+	var lines []line
+	anchors := make(map[string]int)
+	for _, b := range blocks {
+		for _, id := range b.IDs {
+			if _, ok := anchors[id]; !ok {
+				anchors[id] = len(lines)
+			}
+		}
+		var blockLines []line
+		var blockAnchors map[string]int
+		if indent := min(b.Indent, width/3); indent > 0 && mode != layoutCell {
+			blockLines, blockAnchors = layoutBlock(b, width-indent, mode)
+			margin := strings.Repeat(" ", indent)
+			for i, l := range blockLines {
+				if !l.isBlank() {
+					blockLines[i] = append(line{{text: margin}}, l...)
+				}
+			}
+		} else {
+			blockLines, blockAnchors = layoutBlock(b, width, mode)
+		}
+		for id, i := range blockAnchors {
+			if _, ok := anchors[id]; !ok {
+				anchors[id] = len(lines) + i
+			}
+		}
+		if len(blockLines) > 0 {
+			blockLines[0] = append(line{{joint: JointBlock}}, blockLines[0]...)
+		}
+		lines = append(lines, blockLines...)
+	}
+	return lines, anchors
+}
+
+// layoutBlock lays out a block, the anchors are relative to its first line
+func layoutBlock(b *Block, width int, mode layoutMode) ([]line, map[string]int) {
+	switch b.Kind {
+	case BlockParagraph:
+		return layoutInlines(b, 0, width, mode)
+	case BlockHeading:
+		lines, anchors := layoutInlines(b, headingStyles[b.Level], width, mode)
+		return append(lines, nil), anchors
+	case BlockTerm:
+		return layoutInlines(b, StyleBold, width, mode)
+	case BlockList:
+		return layoutList(b, width, mode)
+	case BlockListItem:
+		prefix := listIndent + b.Marker + " "
+		return layoutIndented(b.Children, prefix, strings.Repeat(" ", textWidth(prefix)), width, mode)
+	case BlockDefinition:
+		return layoutIndented(b.Children, definitionIndent, definitionIndent, width, mode)
+	case BlockQuote:
+		return layoutIndented(b.Children, listIndent, listIndent, width, mode)
+	case BlockCode:
+		var lines []line
+		for _, l := range highlightCode(b.Code, b.Language) {
+			lines = append(lines, breakLine(l, width)...)
+		}
+		return lines, map[string]int{}
+	case BlockImage:
+		marker := line{{text: fmt.Sprintf("[IMG:%d]", b.Image), marker: true}}
+		if b.Label != "" {
+			// The label is text of the document, escaped unlike the marker
+			marker = line{{text: fmt.Sprintf("[IMG:%d - ", b.Image), marker: true}, {text: b.Label + "]"}}
+		}
+		markerLines := wrapLine(marker, width, false)
+		if b.Size.Cols <= 0 || b.Size.Rows <= 0 || mode != layoutWrap {
+			return markerLines, map[string]int{}
+		}
+		return append(layoutImage(b, width), markerLines...), map[string]int{}
+	case BlockTable:
+		return layoutTable(b, width)
+	}
+	return nil, map[string]int{}
+}
+
+// layoutImage lays out the blank lines an image is drawn over, centered,
+// an image wider than the width is made smaller
+func layoutImage(b *Block, width int) []line {
+	size := b.Size
+	if size.Cols > width {
+		size.Rows = max((size.Rows*width+size.Cols-1)/size.Cols, 1)
+		size.Cols = max(width, 1)
+	}
+	lines := make([]line, size.Rows)
+	for i := range lines {
+		lines[i] = alignLine(line{{text: strings.Repeat(" ", size.Cols), image: b.Image + 1}}, width, AlignCenter)
+	}
+	return lines
+}
+
+// layoutList lays out the items of a list, the numbers are aligned on the right
+func layoutList(b *Block, width int, mode layoutMode) ([]line, map[string]int) {
+	markerWidth := 0
+	for _, item := range b.Children {
+		if item.Kind == BlockListItem {
+			markerWidth = max(markerWidth, textWidth(item.Marker))
+		}
+	}
+
+	var lines []line
+	anchors := make(map[string]int)
+	for _, item := range b.Children {
+		var itemLines []line
+		var itemAnchors map[string]int
+		if item.Kind == BlockListItem {
+			marker := item.Marker
+			if b.Ordered {
+				marker = strings.Repeat(" ", max(markerWidth-textWidth(marker), 0)) + marker
+			}
+			prefix := listIndent + marker + " "
+			itemLines, itemAnchors = layoutIndented(item.Children, prefix, strings.Repeat(" ", textWidth(prefix)), width, mode)
+		} else {
+			// Content outside of the items
+			itemLines, itemAnchors = layoutIndented([]*Block{item}, listIndent, listIndent, width, mode)
+		}
+		for _, id := range item.IDs {
+			if _, ok := anchors[id]; !ok {
+				anchors[id] = len(lines)
+			}
+		}
+		for id, i := range itemAnchors {
+			if _, ok := anchors[id]; !ok {
+				anchors[id] = len(lines) + i
+			}
+		}
+		lines = append(lines, itemLines...)
+	}
+	return lines, anchors
+}
+
+// layoutIndented lays out blocks with the first line prefixed by first and the other lines by indent,
+// the paragraphs are wrapped to keep the indentation, even in table cells
+func layoutIndented(blocks []*Block, first string, indent string, width int, mode layoutMode) ([]line, map[string]int) {
+	if mode == layoutCell {
+		mode = layoutWrap
+	}
+	lines, anchors := layoutBlocks(blocks, max(width-textWidth(indent), 1), mode)
+
+	// Blank lines around the content are dropped
+	start, end := 0, len(lines)
+	for start < end && lines[start].isBlank() {
+		start++
+	}
+	for end > start && lines[end-1].isBlank() {
+		end--
+	}
+	lines = lines[start:end]
+	for id, i := range anchors {
+		anchors[id] = min(max(i-start, 0), max(len(lines)-1, 0))
+	}
+
+	if len(lines) == 0 {
+		return []line{{{text: strings.TrimRight(first, " ")}}}, anchors
+	}
+	indented := make([]line, len(lines))
+	for i, l := range lines {
+		switch {
+		case i == 0:
+			indented[i] = append(line{{text: first}}, l...)
+		case l.isBlank():
+			indented[i] = nil
+		default:
+			indented[i] = append(line{{text: indent}}, l...)
+		}
+	}
+	return indented, anchors
+}
+
+// layoutInlines lays out the inline elements of a paragraph, a line break starts a new line
+// The lines are wrapped to the width and preformatted lines broken at it,
+// table cells are measured and the text dumped with their lines whole
+func layoutInlines(b *Block, style Style, width int, mode layoutMode) ([]line, map[string]int) {
+	align := b.Align
+	if mode != layoutWrap {
+		align = AlignLeft
+	}
+	dir := b.Dir
+	if dir == DirAuto {
+		dir = textDirection(b.Inlines)
+	}
+	justify := align == AlignJustify
+	if dir == DirRTL && (align == AlignLeft || justify) && mode == layoutWrap {
+		// Right-to-left text starts on the right
+		align = AlignRight
+	}
+	bidiText := dir == DirRTL || hasRTL(b.Inlines)
+	// Ruby readings are laid out above their base, which takes lines of a known width
+	wrap := mode == layoutWrap || hasRuby(b.Inlines)
+
+	lines := []line{nil}
+	hasText := false
+	for _, inline := range b.Inlines {
+		current := &lines[len(lines)-1]
+		switch inline.Kind {
+		case InlineText:
+			*current = append(*current, span{text: inline.Text, style: inline.Style | style})
+			hasText = true
+		case InlineBreak:
+			lines = append(lines, nil)
+			hasText = true
+		case InlineLink:
+			*current = append(*current, span{text: fmt.Sprintf("[→%d]", inline.Ref), marker: true})
+			hasText = true
+		case InlineNoteRef:
+			*current = append(*current, span{text: fmt.Sprintf("[^%d]", inline.Ref), marker: true})
+			hasText = true
+		case InlineAnchor:
+			*current = append(*current, span{anchor: inline.ID})
+		case InlineRuby:
+			*current = append(*current, rubySpan(inline.Text, inline.Ruby, inline.Style|style))
+			hasText = true
+		}
+	}
+
+	anchors := make(map[string]int)
+	if !hasText {
+		// Nothing to show, the anchors point to the next line
+		for _, s := range lines[0] {
+			anchors[s.anchor] = 0
+		}
+		return nil, anchors
+	}
+
+	if bidiText {
+		for _, l := range lines {
+			for i := range l {
+				l[i].dir = dir
+			}
+		}
+	}
+
+	var result []line
+	for _, l := range lines {
+		l = scriptForms(l)
+		if b.Pre {
+			l = expandTabs(l)
+		} else {
+			l = trimLine(l)
+		}
+		switch {
+		case wrap && b.Pre:
+			result = append(result, breakLine(stripSoftHyphens(l), width)...)
+		case wrap:
+			wrapped := wrapLine(l, width, b.Hyphenate)
+			if justify {
+				// The last line of a paragraph isn't justified
+				for i := range len(wrapped) - 1 {
+					wrapped[i] = justifyLine(wrapped[i], width)
+				}
+			}
+			result = append(result, wrapped...)
+		case b.Pre:
+			result = append(result, stripSoftHyphens(l))
+		default:
+			result = append(result, l)
+		}
+	}
+	if align == AlignCenter || align == AlignRight {
+		for i, l := range result {
+			result[i] = alignLine(l, width, align)
+		}
+	}
+	result = addRubyLines(result, width)
+	for i, l := range result {
+		for _, s := range l {
+			if _, ok := anchors[s.anchor]; s.anchor != "" && !ok {
+				anchors[s.anchor] = i
+			}
+		}
+	}
+	return result, anchors
+}
+
+// alignLine moves a line to the center or the right of the width
+func alignLine(l line, width int, align Align) line {
+	space := width - l.width()
+	if space <= 0 || l.isBlank() {
+		return l
+	}
+	if align == AlignCenter {
+		space /= 2
+	}
+	return append(line{{text: strings.Repeat(" ", space)}}, l...)
+}
+
+// trimLine removes the spaces at the start and the end of a line
+func trimLine(l line) line {
+	for i := range l {
+		if l[i].anchor != "" {
+			continue
+		}
+		l[i].text = strings.TrimLeft(l[i].text, " ")
+		if l[i].text != "" {
+			break
+		}
+	}
+	for i := len(l) - 1; i >= 0; i-- {
+		if l[i].anchor != "" {
+			continue
+		}
+		l[i].text = strings.TrimRight(l[i].text, " ")
+		if l[i].text != "" {
+			break
+		}
+	}
+	return l
+}
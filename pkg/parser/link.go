@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Link represents an internal hyperlink, like a cross reference to another section
+type Link struct {
+	Href string // Target of the link, relative to the file holding it
+	Text string
+}
+
+// isInternalLink checks if the href points into the book,
+// links to web pages and mail addresses can't be followed by the reader
+func isInternalLink(href string) bool {
+	if href == "" {
+		return false
+	}
+	u, err := url.Parse(href)
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
+
+// handleLink records an internal link, its marker [→n] is added after the link text
+func (p *HTMLParser) handleLink(n *html.Node) {
+	p.doc.Links = append(p.doc.Links, Link{
+		Href: strings.TrimSpace(attrValue(n, "href")),
+		Text: strings.Join(strings.Fields(nodeText(n)), " "),
+	})
+	number := len(p.doc.Links)
+
+	link := p.link
+	p.link = number
+	p.parseChildren(n)
+	p.link = link
+	p.addInline(Inline{Kind: InlineLink, Ref: number})
+}
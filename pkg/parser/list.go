@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// bullets are the glyphs of unordered list items, by nesting depth
+var bullets = []string{"•", "◦", "▪"}
+
+// listState holds the numbering of a list being parsed
+type listState struct {
+	ordered bool
+	next    int    // Number of the next item
+	step    int    // 1, or -1 for reversed lists
+	style   string // Numbering type: 1, a, A, i or I
+}
+
+// handleList parses an <ol> or <ul> into a list block, the items are numbered
+// or get the bullet of their nesting depth
+func (p *HTMLParser) handleList(n *html.Node) {
+	list := listState{ordered: n.Data == "ol", next: 1, step: 1, style: "1"}
+	items := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "li" {
+			items++
+		}
+	}
+
+	hasStart := false
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "start":
+			if start, err := strconv.Atoi(strings.TrimSpace(attr.Val)); err == nil {
+				list.next = start
+				hasStart = true
+			}
+		case "reversed":
+			list.step = -1
+		case "type":
+			switch attr.Val {
+			case "a", "A", "i", "I":
+				list.style = attr.Val
+			}
+		}
+	}
+	// Reversed lists count down to 1 unless told otherwise
+	if list.step < 0 && !hasStart {
+		list.next = items
+	}
+
+	block := &Block{Kind: BlockList, Ordered: list.ordered}
+	p.addBlock(block)
+	p.lists = append(p.lists, list)
+	p.parseInto(n, &block.Children)
+	p.lists = p.lists[:len(p.lists)-1]
+}
+
+// handleListItem parses a list item with its number or bullet
+func (p *HTMLParser) handleListItem(n *html.Node) {
+	var marker string
+	if len(p.lists) == 0 {
+		// An item outside of a list
+		marker = bullets[0]
+	} else if list := &p.lists[len(p.lists)-1]; list.ordered {
+		for _, attr := range n.Attr {
+			if attr.Key == "value" {
+				if value, err := strconv.Atoi(strings.TrimSpace(attr.Val)); err == nil {
+					list.next = value
+				}
+			}
+		}
+		marker = formatListNumber(list.next, list.style) + "."
+		list.next += list.step
+	} else {
+		depth := 0
+		for _, l := range p.lists[:len(p.lists)-1] {
+			if !l.ordered {
+				depth++
+			}
+		}
+		marker = bullets[depth%len(bullets)]
+	}
+
+	block := &Block{Kind: BlockListItem, Marker: marker}
+	p.addBlock(block)
+	p.parseInto(n, &block.Children)
+}
+
+// formatListNumber formats the number of an ordered list item in the numbering type of the list
+func formatListNumber(n int, style string) string {
+	if n <= 0 {
+		return strconv.Itoa(n)
+	}
+	switch style {
+	case "a", "A":
+		var letters []byte
+		for ; n > 0; n = (n - 1) / 26 {
+			letters = append([]byte{byte('a' + (n-1)%26)}, letters...)
+		}
+		if style == "A" {
+			return strings.ToUpper(string(letters))
+		}
+		return string(letters)
+	case "i", "I":
+		if n >= 4000 {
+			return strconv.Itoa(n)
+		}
+		numerals := []struct {
+			value  int
+			symbol string
+		}{
+			{1000, "m"}, {900, "cm"}, {500, "d"}, {400, "cd"}, {100, "c"}, {90, "xc"},
+			{50, "l"}, {40, "xl"}, {10, "x"}, {9, "ix"}, {5, "v"}, {4, "iv"}, {1, "i"},
+		}
+		var roman strings.Builder
+		for _, numeral := range numerals {
+			for ; n >= numeral.value; n -= numeral.value {
+				roman.WriteString(numeral.symbol)
+			}
+		}
+		if style == "I" {
+			return strings.ToUpper(roman.String())
+		}
+		return roman.String()
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,251 @@
+package parser
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// mathOperators are the operators written with a space on each side
+var mathOperators = map[string]bool{
+	"=": true, "+": true, "-": true, "−": true, "±": true, "∓": true, "×": true, "÷": true, "·": true,
+	"<": true, ">": true, "≤": true, "≥": true, "≠": true, "≈": true, "≡": true, "∼": true, "≅": true,
+	"∝": true, "→": true, "←": true, "↔": true, "⇒": true, "⇐": true, "⇔": true, "↦": true,
+	"∈": true, "∉": true, "⊂": true, "⊃": true, "⊆": true, "⊇": true, "∪": true, "∩": true,
+	"∧": true, "∨": true, ":=": true,
+}
+
+// mathAccents are the combining characters of the accents put over a single character
+var mathAccents = map[string]string{
+	"¯": "̄", "‾": "̅", "^": "̂", "ˆ": "̂", "~": "̃", "˜": "̃",
+	"→": "⃗", "⃗": "⃗", "˙": "̇", ".": "̇", "¨": "̈", "..": "̈",
+}
+
+// handleMath adds a MathML formula as linear text, or its alttext when it has one
+// Formulas displayed as blocks get a centered line of their own
+func (p *HTMLParser) handleMath(n *html.Node) {
+	text := strings.TrimSpace(attrValue(n, "alttext"))
+	if text == "" {
+		text = mathText(n)
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return
+	}
+
+	if attrValue(n, "display") == "block" {
+		block := &Block{Kind: BlockParagraph}
+		p.startParagraph(block)
+		block.Align = AlignCenter
+		p.handleText(text)
+		p.endParagraph()
+		return
+	}
+	p.handleText(text)
+}
+
+// mathChildren returns the element children of a MathML element
+func mathChildren(n *html.Node) []*html.Node {
+	var children []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+// mathText writes a MathML element in a linear notation:
+// fractions as a/b, scripts as Unicode characters or ^( ) and _( ), roots as √( ), matrices as [[a, b], [c, d]]
+func mathText(n *html.Node) string {
+	children := mathChildren(n)
+	arg := func(i int) string {
+		if i < len(children) {
+			return mathText(children[i])
+		}
+		return ""
+	}
+
+	switch n.Data {
+	case "mi", "mn", "mtext":
+		return strings.Join(strings.Fields(nodeText(n)), " ")
+	case "mo":
+		op := strings.TrimSpace(nodeText(n))
+		switch {
+		case mathOperators[op]:
+			return " " + op + " "
+		case op == "," || op == ";":
+			return op + " "
+		}
+		return op
+	case "ms":
+		return `"` + strings.TrimSpace(nodeText(n)) + `"`
+	case "mspace":
+		return " "
+	case "mphantom", "annotation", "annotation-xml", "none", "mprescripts":
+		return ""
+	case "semantics", "maction":
+		return arg(0)
+	case "mfrac":
+		return mathGroup(arg(0)) + "/" + mathGroup(arg(1))
+	case "msqrt":
+		return "√" + mathGroup(mathRow(children))
+	case "mroot":
+		index, _ := toSuperscript(strings.TrimSpace(arg(1)))
+		return index + "√" + mathGroup(arg(0))
+	case "msup":
+		return mathGroup(arg(0)) + mathScript(arg(1), true)
+	case "msub":
+		return mathGroup(arg(0)) + mathScript(arg(1), false)
+	case "msubsup":
+		return mathGroup(arg(0)) + mathScript(arg(1), false) + mathScript(arg(2), true)
+	case "mover":
+		base, over := arg(0), strings.TrimSpace(arg(1))
+		if accent, ok := mathAccents[over]; ok && len([]rune(strings.TrimSpace(base))) == 1 {
+			return strings.TrimSpace(base) + accent
+		}
+		return mathGroup(base) + mathScript(over, true)
+	case "munder":
+		return mathGroup(arg(0)) + mathScript(arg(1), false)
+	case "munderover":
+		return mathGroup(arg(0)) + mathScript(arg(1), false) + mathScript(arg(2), true)
+	case "mmultiscripts":
+		// The scripts after the base come in pairs, the prescripts are dropped
+		text := mathGroup(arg(0))
+		for i := 1; i+1 < len(children) && children[i].Data != "mprescripts"; i += 2 {
+			text += mathScript(arg(i), false) + mathScript(arg(i+1), true)
+		}
+		return text
+	case "mfenced":
+		open, close := "(", ")"
+		for _, attr := range n.Attr {
+			switch attr.Key {
+			case "open":
+				open = attr.Val
+			case "close":
+				close = attr.Val
+			}
+		}
+		separators := []rune(strings.ReplaceAll(attrValue(n, "separators"), " ", ""))
+		if _, ok := attrLookup(n, "separators"); !ok {
+			separators = []rune{','}
+		}
+		if len(children) == 1 && children[0].Data == "mtable" {
+			return open + mathTableRows(children[0]) + close
+		}
+		var b strings.Builder
+		for i, c := range children {
+			if i > 0 && len(separators) > 0 {
+				b.WriteString(string(separators[min(i-1, len(separators)-1)]) + " ")
+			}
+			b.WriteString(strings.TrimSpace(mathText(c)))
+		}
+		return open + b.String() + close
+	case "mtable":
+		return "[" + mathTableRows(n) + "]"
+	}
+	// math, mrow, mstyle, mpadded, menclose, merror, mtd...
+	return mathRow(children)
+}
+
+// mathTableRows writes the rows of a matrix as [a, b], [c, d]
+func mathTableRows(n *html.Node) string {
+	var rows []string
+	for _, row := range mathChildren(n) {
+		var cells []string
+		for _, cell := range mathChildren(row) {
+			cells = append(cells, strings.TrimSpace(mathText(cell)))
+		}
+		if row.Data == "mlabeledtr" && len(cells) > 0 {
+			// The first cell is the label of the equation
+			cells = cells[1:]
+		}
+		rows = append(rows, "["+strings.Join(cells, ", ")+"]")
+	}
+	return strings.Join(rows, ", ")
+}
+
+// mathRow writes MathML elements one after another
+func mathRow(children []*html.Node) string {
+	var b strings.Builder
+	for i, c := range children {
+		// A matrix between brackets takes them instead of its own
+		if c.Data == "mtable" && i > 0 && i+1 < len(children) &&
+			children[i-1].Data == "mo" && children[i+1].Data == "mo" {
+			b.WriteString(mathTableRows(c))
+			continue
+		}
+		b.WriteString(mathText(c))
+	}
+	fields := strings.Fields(b.String())
+	// A leading sign is unary: -x
+	if len(fields) > 1 && (fields[0] == "-" || fields[0] == "−" || fields[0] == "+" || fields[0] == "±") {
+		fields = append([]string{fields[0] + fields[1]}, fields[2:]...)
+	}
+	return strings.Join(fields, " ")
+}
+
+// mathGroup puts an expression between parentheses unless it's a single term
+func mathGroup(text string) string {
+	text = strings.TrimSpace(text)
+	if isMathTerm(text) {
+		return text
+	}
+	return "(" + text + ")"
+}
+
+// isMathTerm checks if an expression reads as a single term: a number, a name or a bracketed expression
+func isMathTerm(text string) bool {
+	runes := []rune(text)
+	if len(runes) <= 1 {
+		return true
+	}
+	if !strings.ContainsAny(text, " +−-/=,") {
+		return true
+	}
+	pairs := map[rune]rune{'(': ')', '[': ']', '{': '}', '|': '|', '⟨': '⟩'}
+	if close, ok := pairs[runes[0]]; ok && runes[len(runes)-1] == close {
+		// The brackets must enclose the whole expression: (a)/(b) isn't a term
+		depth := 0
+		for i, r := range runes {
+			switch {
+			case i > 0 && r == close && depth == 1:
+				return i == len(runes)-1
+			case r == runes[0]:
+				depth++
+			case r == close:
+				depth--
+			}
+		}
+	}
+	return false
+}
+
+// mathScript writes a superscript or a subscript with Unicode characters, or as ^( ) and _( )
+func mathScript(text string, super bool) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+	convert, mark := toSubscript, "_"
+	if super {
+		convert, mark = toSuperscript, "^"
+	}
+	if script, ok := convert(strings.ReplaceAll(text, " ", "")); ok {
+		return script
+	}
+	if len([]rune(text)) > 1 && !strings.HasPrefix(text, "(") {
+		return mark + "(" + text + ")"
+	}
+	return mark + text
+}
+
+// attrLookup returns the value of an attribute of a node, ok is false when missing
+func attrLookup(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,183 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// NoteRef represents a reference to a footnote or an endnote (<a epub:type="noteref">)
+type NoteRef struct {
+	Href  string // Target of the reference, the note may live in another file
+	Label string // Text of the reference in the book, usually the number of the note
+}
+
+// inlineTags are the tags a note target may be nested in, the note is the enclosing block
+var inlineTags = map[string]bool{
+	"a": true, "span": true, "sup": true, "sub": true, "em": true, "strong": true,
+	"b": true, "i": true, "small": true, "cite": true,
+}
+
+// hasEpubType checks if the node has the epub:type or the matching ARIA role (doc-noteref, ...)
+func hasEpubType(n *html.Node, epubType string) bool {
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "epub:type":
+			for _, t := range strings.Fields(attr.Val) {
+				if t == epubType {
+					return true
+				}
+			}
+		case "role":
+			if attr.Val == "doc-"+epubType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// noteLabelLength is the longest label of a superscript link taken for a note reference
+const noteLabelLength = 5
+
+// isNoteRef checks if the node is a link to a footnote or an endnote:
+// a noteref link, or a short superscript link to a fragment (<sup><a href="#n1">1</a></sup>)
+// Superscript links starting a block are the back links of the notes themselves
+func isNoteRef(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Data != "a" {
+		return false
+	}
+	if hasEpubType(n, "noteref") {
+		return true
+	}
+	if hasEpubType(n, "backlink") {
+		return false
+	}
+	href := attrValue(n, "href")
+	label := strings.TrimSpace(nodeText(n))
+	if !isInternalLink(href) || !strings.Contains(href, "#") || label == "" || len([]rune(label)) > noteLabelLength {
+		return false
+	}
+	return isSuperscript(n) && !startsBlock(n)
+}
+
+// isSuperscript checks if a link is in a superscript or holds nothing but one
+func isSuperscript(n *html.Node) bool {
+	for parent := n.Parent; parent != nil && inlineTags[parent.Data]; parent = parent.Parent {
+		if parent.Data == "sup" {
+			return true
+		}
+	}
+	for c := n; c != nil; {
+		var only *html.Node
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			switch {
+			case child.Type == html.ElementNode && only == nil:
+				only = child
+			case child.Type == html.TextNode && strings.TrimSpace(child.Data) == "":
+			default:
+				return false
+			}
+		}
+		if only != nil && only.Data == "sup" {
+			return true
+		}
+		c = only
+	}
+	return false
+}
+
+// startsBlock checks if nothing but whitespace comes before an inline element in its block
+func startsBlock(n *html.Node) bool {
+	for c := n; c != nil && c.Parent != nil; c = c.Parent {
+		for prev := c.PrevSibling; prev != nil; prev = prev.PrevSibling {
+			if strings.TrimSpace(nodeText(prev)) != "" {
+				return false
+			}
+		}
+		if !inlineTags[c.Parent.Data] {
+			return true
+		}
+	}
+	return true
+}
+
+// nodeText returns the text of a node and its children
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var text strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		text.WriteString(nodeText(c))
+	}
+	return text.String()
+}
+
+// handleNoteRef replaces a note reference by the marker [^n]
+func (p *HTMLParser) handleNoteRef(n *html.Node) {
+	p.doc.NoteRefs = append(p.doc.NoteRefs, NoteRef{
+		Href:  attrValue(n, "href"),
+		Label: strings.Join(strings.Fields(nodeText(n)), " "),
+	})
+
+	// The marker goes right after the text it refers to
+	p.addInline(Inline{Kind: InlineNoteRef, Ref: len(p.doc.NoteRefs)})
+}
+
+// ExtractNote extracts the HTML of the note with the given ID
+// When the ID belongs to an inline element (e.g. the back link at the start of
+// the note), the enclosing block is returned. Back links to the reference are removed.
+func ExtractNote(content string, id string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	var find func(n *html.Node) *html.Node
+	find = func(n *html.Node) *html.Node {
+		if n.Type == html.ElementNode {
+			for _, attr := range n.Attr {
+				if (attr.Key == "id" || attr.Key == "name") && attr.Val == id {
+					return n
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if found := find(c); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	note := find(doc)
+	if note == nil {
+		return "", fmt.Errorf("note '%s' not found", id)
+	}
+	for inlineTags[note.Data] && note.Parent != nil && note.Parent.Type == html.ElementNode {
+		note = note.Parent
+	}
+
+	var removeBacklinks func(n *html.Node)
+	removeBacklinks = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode && hasEpubType(c, "backlink") {
+				n.RemoveChild(c)
+			} else {
+				removeBacklinks(c)
+			}
+			c = next
+		}
+	}
+	removeBacklinks(note)
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, note); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
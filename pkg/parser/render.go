@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/rivo/tview"
+)
+
+// Rendered is a document laid out as lines of text
+type Rendered struct {
+	Lines   []string
+	Anchors map[string]int   // Element id -> index of the line the element starts on
+	Bidi    map[int]BidiLine // Index -> line written in visual order, for the lines holding right-to-left text
+	// Positions is the number of letters and digits of the document before each line,
+	// a position in the text which doesn't change with the width
+	Positions []int
+	Images    []ImageBox // Places of the images drawn in the text
+	Text      []TextLine // Text of the document held by each line, for searching it
+}
+
+// ImageBox is the place of an image drawn over blank lines of the text
+type ImageBox struct {
+	Image  int // Index of the image in Document.Images
+	Line   int // Index of its first line
+	Column int // Cell of the lines it starts at
+	ImageSize
+}
+
+// Renderer lays out a document for a width and writes it as lines of text
+type Renderer interface {
+	Render(doc *Document, width int) *Rendered
+}
+
+// TviewRenderer writes the lines for a tview TextView with dynamic colors,
+// the styles are tview tags and the text is escaped
+// Right-to-left text is written in visual order, with the Unicode bidirectional algorithm
+type TviewRenderer struct {
+	Colors CodeColors // Colors of the highlighted code, code isn't colored without them
+}
+
+// PlainRenderer writes the lines as plain text, with the same layout as TviewRenderer
+// The text stays in logical order, for searching
+type PlainRenderer struct{}
+
+// styleFlags are the tview attributes of the styles
+var styleFlags = []struct {
+	style Style
+	flag  byte
+}{
+	{StyleBold, 'b'}, {StyleItalic, 'i'}, {StyleUnderline, 'u'}, {StyleStrike, 's'}, {StyleCode, 'r'},
+}
+
+// Render lays out the document as lines styled with tview tags
+func (r TviewRenderer) Render(doc *Document, width int) *Rendered {
+	lines, anchors := layoutDocument(doc, width)
+	rendered := &Rendered{
+		Lines:     make([]string, len(lines)),
+		Anchors:   anchors,
+		Bidi:      make(map[int]BidiLine),
+		Positions: linePositions(lines),
+		Images:    imageBoxes(lines),
+		Text:      textLines(lines),
+	}
+	for i, l := range lines {
+		visual, order := visualLine(l)
+		if order != nil {
+			rendered.Bidi[i] = BidiLine{Text: l.text(), Order: order}
+		}
+		rendered.Lines[i] = tviewLine(visual, r.Colors)
+	}
+	return rendered
+}
+
+// tviewLine writes a line with tview tags, each line turns off the styles it turns on
+func tviewLine(l line, colors CodeColors) string {
+	var b strings.Builder
+	var current Style
+	color := ""
+	for _, s := range l {
+		if s.text == "" {
+			continue
+		}
+		if tag := styleTag(current, s.style); tag != "" {
+			b.WriteString(tag)
+			current = s.style
+		}
+		if c := colors[s.token]; c != color {
+			if c == "" {
+				b.WriteString("[-]")
+			} else {
+				b.WriteString("[" + c + "]")
+			}
+			color = c
+		}
+		if s.marker {
+			b.WriteString(s.text)
+		} else {
+			b.WriteString(tview.Escape(s.text))
+		}
+	}
+	b.WriteString(styleTag(current, 0))
+	if color != "" {
+		b.WriteString("[-]")
+	}
+	return b.String()
+}
+
+// styleTag returns the tview tag going from a style to another, empty when nothing changes
+func styleTag(from Style, to Style) string {
+	var flags []byte
+	for _, f := range styleFlags {
+		switch {
+		case from&f.style != 0 && to&f.style == 0:
+			flags = append(flags, f.flag-('a'-'A'))
+		case from&f.style == 0 && to&f.style != 0:
+			flags = append(flags, f.flag)
+		}
+	}
+	if len(flags) == 0 {
+		return ""
+	}
+	return "[::" + string(flags) + "]"
+}
+
+// Render lays out the document as lines of plain text
+func (PlainRenderer) Render(doc *Document, width int) *Rendered {
+	lines, anchors := layoutDocument(doc, width)
+	rendered := &Rendered{
+		Lines:     make([]string, len(lines)),
+		Anchors:   anchors,
+		Positions: linePositions(lines),
+		Images:    imageBoxes(lines),
+		Text:      textLines(lines),
+	}
+	for i, l := range lines {
+		rendered.Lines[i] = l.text()
+	}
+	return rendered
+}
+
+// linePositions counts the letters and digits before each line, the markers don't count
+func linePositions(lines []line) []int {
+	positions := make([]int, len(lines))
+	count := 0
+	for i, l := range lines {
+		positions[i] = count
+		for _, s := range l {
+			if s.marker {
+				continue
+			}
+			for _, r := range s.text {
+				if unicode.IsLetter(r) || unicode.IsDigit(r) {
+					count++
+				}
+			}
+		}
+	}
+	return positions
+}
+
+// imageBoxes finds the images drawn over the lines, an image goes on as long as
+// the next line holds it at the same place
+func imageBoxes(lines []line) []ImageBox {
+	var boxes []ImageBox
+	for i, l := range lines {
+		column := 0
+		for _, s := range l {
+			if s.image != 0 {
+				box := ImageBox{Image: s.image - 1, Line: i, Column: column, ImageSize: ImageSize{Cols: textWidth(s.text), Rows: 1}}
+				if n := len(boxes); n > 0 && boxes[n-1].Image == box.Image && boxes[n-1].Column == column &&
+					boxes[n-1].Line+boxes[n-1].Rows == i {
+					boxes[n-1].Rows++
+				} else {
+					boxes = append(boxes, box)
+				}
+			}
+			column += textWidth(s.text)
+		}
+	}
+	return boxes
+}
+
+// PositionLine returns the index of the line holding a position of Rendered.Positions
+func PositionLine(positions []int, pos int) int {
+	i := sort.Search(len(positions), func(i int) bool { return positions[i] > pos })
+	return max(i-1, 0)
+}
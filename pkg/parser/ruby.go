@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/net/html"
+)
+
+// RubyMode is how the ruby annotations (<ruby>漢字<rt>かんじ</rt></ruby>) are shown
+type RubyMode int
+
+const (
+	// RubyParentheses shows the reading after its base: 漢字(かんじ)
+	RubyParentheses RubyMode = iota
+	// RubyAbove shows the reading on a line above its base when it fits, between parentheses otherwise
+	RubyAbove
+	// RubyHidden shows the base alone
+	RubyHidden
+)
+
+// rubyOverhang is how far a reading may go past each side of its base to be shown above it
+const rubyOverhang = 1
+
+// String returns the name of the ruby mode
+func (m RubyMode) String() string {
+	switch m {
+	case RubyAbove:
+		return "above"
+	case RubyHidden:
+		return "hidden"
+	}
+	return "parentheses"
+}
+
+// SetRubyMode sets how the ruby annotations are shown
+func (p *HTMLParser) SetRubyMode(mode RubyMode) {
+	p.ruby = mode
+}
+
+// handleRuby adds the bases of a ruby element with their readings
+// The bases are the text and the <rb> elements, each <rt> is the reading of the base before it,
+// <rb> bases are paired with the <rt> readings in order
+func (p *HTMLParser) handleRuby(n *html.Node) {
+	var bases []string
+	textBase := false // The last base is text, more text adds to it
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.TextNode:
+			if textBase {
+				bases[len(bases)-1] += c.Data
+			} else {
+				bases = append(bases, c.Data)
+				textBase = true
+			}
+		case c.Type != html.ElementNode || c.Data == "rp":
+		case c.Data == "rt" || c.Data == "rtc":
+			reading := rubyText(c)
+			if len(bases) == 0 {
+				continue
+			}
+			if c.Data == "rtc" {
+				// A container of readings annotates all the bases
+				bases = []string{strings.Join(bases, "")}
+			}
+			p.addRuby(bases[0], reading)
+			bases = bases[1:]
+			textBase = false
+		default:
+			bases = append(bases, nodeText(c))
+			textBase = false
+		}
+	}
+	for _, base := range bases {
+		p.addRuby(base, "")
+	}
+}
+
+// rubyText returns the text of a reading without the <rp> fallback parentheses
+func rubyText(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "rp" {
+			continue
+		}
+		b.WriteString(nodeText(c))
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// addRuby adds a ruby base with its reading as the ruby mode shows it
+func (p *HTMLParser) addRuby(base string, reading string) {
+	base = strings.TrimSpace(whitespaceRe.ReplaceAllString(base, " "))
+	if base == "" {
+		return
+	}
+	switch {
+	case reading == "" || p.ruby == RubyHidden:
+		p.handleText(base)
+	case p.ruby == RubyAbove:
+		p.dropWideBreak(base)
+		p.addInline(Inline{Kind: InlineRuby, Text: base, Ruby: reading, Style: p.text.style, Ref: p.link})
+	default:
+		p.handleText(rubyParentheses(base, reading))
+	}
+}
+
+// rubyParentheses writes a reading after its base between parentheses,
+// full-width ones after wide characters
+func rubyParentheses(base string, reading string) string {
+	if runewidth.StringWidth(base) > len([]rune(base)) {
+		return base + "（" + reading + "）"
+	}
+	return base + "(" + reading + ")"
+}
+
+// hasRuby checks if inline elements hold ruby bases
+func hasRuby(inlines []Inline) bool {
+	for _, inline := range inlines {
+		if inline.Kind == InlineRuby {
+			return true
+		}
+	}
+	return false
+}
+
+// rubySpan returns the span of a ruby base, the reading goes between parentheses
+// when it's too wide to be shown above the base
+func rubySpan(base string, reading string, style Style) span {
+	if textWidth(reading) > textWidth(base)+2*rubyOverhang {
+		return span{text: rubyParentheses(base, reading), style: style}
+	}
+	return span{text: base, style: style, ruby: reading}
+}
+
+// addRubyLines adds a line with the readings above each line holding ruby bases,
+// each reading is centered above its base and pushed right to not overlap the one before
+func addRubyLines(lines []line, width int) []line {
+	var result []line
+	for _, l := range lines {
+		var ruby line
+		rubyWidth := 0 // Width of the ruby line so far
+		column := 0
+		for _, s := range l {
+			w := textWidth(s.text)
+			if s.ruby != "" {
+				readingWidth := textWidth(s.ruby)
+				start := max(column+(w-readingWidth)/2, rubyWidth, 0)
+				if width > 0 && start+readingWidth > width {
+					start = max(width-readingWidth, rubyWidth)
+				}
+				if start > rubyWidth {
+					ruby = append(ruby, span{text: strings.Repeat(" ", start-rubyWidth)})
+				}
+				ruby = append(ruby, span{text: s.ruby})
+				rubyWidth = start + readingWidth
+			}
+			column += w
+		}
+		if ruby != nil {
+			result = append(result, append(line{{joint: JointReading}}, ruby...))
+		}
+		result = append(result, l)
+	}
+	return result
+}
@@ -0,0 +1,119 @@
+package parser
+
+import "strings"
+
+// superscripts are the Unicode superscript forms of characters
+var superscripts = map[rune]rune{
+	'0': '⁰', '1': '¹', '2': '²', '3': '³', '4': '⁴', '5': '⁵', '6': '⁶', '7': '⁷', '8': '⁸', '9': '⁹',
+	'+': '⁺', '-': '⁻', '−': '⁻', '=': '⁼', '(': '⁽', ')': '⁾',
+	'a': 'ᵃ', 'b': 'ᵇ', 'c': 'ᶜ', 'd': 'ᵈ', 'e': 'ᵉ', 'f': 'ᶠ', 'g': 'ᵍ', 'h': 'ʰ', 'i': 'ⁱ', 'j': 'ʲ',
+	'k': 'ᵏ', 'l': 'ˡ', 'm': 'ᵐ', 'n': 'ⁿ', 'o': 'ᵒ', 'p': 'ᵖ', 'r': 'ʳ', 's': 'ˢ', 't': 'ᵗ', 'u': 'ᵘ',
+	'v': 'ᵛ', 'w': 'ʷ', 'x': 'ˣ', 'y': 'ʸ', 'z': 'ᶻ',
+	'A': 'ᴬ', 'B': 'ᴮ', 'D': 'ᴰ', 'E': 'ᴱ', 'G': 'ᴳ', 'H': 'ᴴ', 'I': 'ᴵ', 'J': 'ᴶ', 'K': 'ᴷ', 'L': 'ᴸ',
+	'M': 'ᴹ', 'N': 'ᴺ', 'O': 'ᴼ', 'P': 'ᴾ', 'R': 'ᴿ', 'T': 'ᵀ', 'U': 'ᵁ', 'V': 'ⱽ', 'W': 'ᵂ',
+	'*': '*', '′': '′', '″': '″',
+}
+
+// subscripts are the Unicode subscript forms of characters
+var subscripts = map[rune]rune{
+	'0': '₀', '1': '₁', '2': '₂', '3': '₃', '4': '₄', '5': '₅', '6': '₆', '7': '₇', '8': '₈', '9': '₉',
+	'+': '₊', '-': '₋', '−': '₋', '=': '₌', '(': '₍', ')': '₎',
+	'a': 'ₐ', 'e': 'ₑ', 'h': 'ₕ', 'i': 'ᵢ', 'j': 'ⱼ', 'k': 'ₖ', 'l': 'ₗ', 'm': 'ₘ', 'n': 'ₙ', 'o': 'ₒ',
+	'p': 'ₚ', 'r': 'ᵣ', 's': 'ₛ', 't': 'ₜ', 'u': 'ᵤ', 'v': 'ᵥ', 'x': 'ₓ',
+}
+
+// toScript converts text to Unicode superscript or subscript characters,
+// ok is false when a character has no such form
+func toScript(text string, forms map[rune]rune) (string, bool) {
+	if strings.TrimSpace(text) == "" {
+		return text, false
+	}
+	var b strings.Builder
+	for _, r := range text {
+		form, found := forms[r]
+		if !found {
+			return text, false
+		}
+		b.WriteRune(form)
+	}
+	return b.String(), true
+}
+
+// toSuperscript converts text to Unicode superscript characters, ok is false when it can't
+func toSuperscript(text string) (string, bool) {
+	return toScript(text, superscripts)
+}
+
+// toSubscript converts text to Unicode subscript characters, ok is false when it can't
+func toSubscript(text string) (string, bool) {
+	return toScript(text, subscripts)
+}
+
+// scriptForms writes the superscripts and subscripts of a line with Unicode characters,
+// a run of them holding a character without a Unicode form is put whole between ^{ } or _{ }
+func scriptForms(l line) line {
+	for i := 0; i < len(l); {
+		script := scriptStyle(l[i])
+		if script == 0 {
+			i++
+			continue
+		}
+		forms, open := superscripts, "^{"
+		if script&StyleSuperscript == 0 {
+			forms, open = subscripts, "_{"
+		}
+
+		// The run goes on over the anchors and the spans of the same script
+		var run []int
+		convertible := true
+		for ; i < len(l) && (l[i].anchor != "" || scriptStyle(l[i]) == script); i++ {
+			if l[i].anchor != "" {
+				continue
+			}
+			run = append(run, i)
+			for _, r := range l[i].text {
+				if _, ok := forms[r]; !ok && r != ' ' {
+					convertible = false
+				}
+			}
+		}
+
+		for _, k := range run {
+			l[k].style &^= script
+		}
+		if convertible {
+			for _, k := range run {
+				l[k].text = strings.Map(func(r rune) rune {
+					if form, ok := forms[r]; ok {
+						return form
+					}
+					return r
+				}, l[k].text)
+			}
+			continue
+		}
+		// The braces go around the text of the run, the spaces around it stay out
+		for _, k := range run {
+			if text := strings.TrimLeft(l[k].text, " "); text != "" {
+				l[k].text = l[k].text[:len(l[k].text)-len(text)] + open + text
+				break
+			}
+		}
+		for n := len(run) - 1; n >= 0; n-- {
+			k := run[n]
+			if text := strings.TrimRight(l[k].text, " "); text != "" {
+				l[k].text = text + "}" + l[k].text[len(text):]
+				break
+			}
+		}
+	}
+	return l
+}
+
+// scriptStyle returns the superscript or subscript style of a span of text, 0 for the other spans
+func scriptStyle(s span) Style {
+	if s.anchor != "" || s.marker {
+		return 0
+	}
+	return s.style & (StyleSuperscript | StyleSubscript)
+}
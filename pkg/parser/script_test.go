@@ -0,0 +1,29 @@
+package parser
+
+import "testing"
+
+func TestScriptRuns(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{html: "x<sup>2</sup>", want: "x²"},
+		{html: "H<sub>2</sub>O", want: "H₂O"},
+		{html: "x<sup>n+<i>1</i></sup>", want: "xⁿ⁺¹"},   // A run goes over the styles
+		{html: "e<sup>iπ</sup>", want: "e^{iπ}"},         // π has no superscript form, nor has the run
+		{html: "b<sub>xy</sub>", want: "b_{xy}"},         // y has no subscript form
+		{html: "e<sup>i<b>π</b></sup>", want: "e^{iπ}"},  // Across spans
+		{html: "y<sup>α β </sup>z", want: "y^{α β} z"},   // The spaces after the run stay out
+		{html: "x<sup>2</sup><sub>k</sub>", want: "x²ₖ"}, // Runs of each script apart
+		{html: "x<sup>2</sup><sub>q</sub>", want: "x²_{q}"},
+	}
+	for _, tt := range tests {
+		p := NewHTMLParser()
+		if err := p.Parse("<p>"+tt.html+"</p>", "", ""); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.GetPlainLines(); len(got) == 0 || got[0] != tt.want {
+			t.Errorf("%s: lines %q, want %q", tt.html, got, tt.want)
+		}
+	}
+}
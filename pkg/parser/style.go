@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// styleTagRe matches the tags TviewRenderer puts in the text: colors of highlighted code
+// ([#rrggbb], [-]) and attributes ([::b], [::B])
+var styleTagRe = regexp.MustCompile(`\[(?:#[0-9a-fA-F]{6}|-)\]|\[::[buildsrBUILDSR-]+\]`)
+
+// escapeRe matches the text escaped by tview.Escape, the bracket before the last one was added
+var escapeRe = regexp.MustCompile(`\[[a-zA-Z0-9_,;: \-\."#]+\[*\[\]`)
+
+// hiddenRanges returns the byte ranges of a line written by TviewRenderer that aren't shown:
+// the style tags and the brackets added to escape the text
+func hiddenRanges(line string) [][]int {
+	ranges := styleTagRe.FindAllStringIndex(line, -1)
+	for _, match := range escapeRe.FindAllStringIndex(line, -1) {
+		ranges = append(ranges, []int{match[1] - 2, match[1] - 1})
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	return ranges
+}
+
+// StripTags returns the text shown for lines written by TviewRenderer,
+// without the style tags and the escaping
+func StripTags(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, r := range hiddenRanges(text) {
+		b.WriteString(text[last:r[0]])
+		last = r[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// HighlightMatches wraps the pieces of each match in the lines of the text with the tag returned
+// by open for the number of the match, the color of the text is restored after each of them
+// The pieces are byte ranges of the lines without the style tags, the lines written in visual order,
+// bidi by index, are mapped from their logical text
+func HighlightMatches(text string, bidi map[int]BidiLine, matches []TextMatch, open func(match int) string) string {
+	// Ranges of the text without styles of each line, with the number of their match
+	pieces := make(map[int][][]int)
+	for n, m := range matches {
+		for _, p := range m.Pieces {
+			pieces[p.Line] = append(pieces[p.Line], []int{p.Start, p.End, n})
+		}
+	}
+
+	lines := strings.Split(text, "\n")
+	color := "-" // Foreground color in effect, it may be set on a previous line
+	for i, line := range lines {
+		hidden := hiddenRanges(line)
+
+		// Map each byte of the shown line to its position in the written line
+		var plain strings.Builder
+		var positions []int
+		last := 0
+		for _, r := range append(hidden, []int{len(line), len(line)}) {
+			for j := last; j < r[0]; j++ {
+				positions = append(positions, j)
+			}
+			plain.WriteString(line[last:r[0]])
+			last = r[1]
+		}
+
+		var b strings.Builder
+		written, next := 0, 0
+		// copyTo copies the line up to pos, following the colors set on the way
+		copyTo := func(pos int) {
+			for ; next < len(hidden) && hidden[next][0] < pos; next++ {
+				tag := line[hidden[next][0]:hidden[next][1]]
+				if strings.HasPrefix(tag, "[#") || tag == "[-]" {
+					color = tag[1 : len(tag)-1]
+				}
+			}
+			b.WriteString(line[written:pos])
+			written = pos
+		}
+
+		ranges := pieces[i]
+		if bl, ok := bidi[i]; ok {
+			var shown [][]int
+			for _, r := range ranges {
+				for _, v := range visualRanges(plain.String(), bl, r[0], r[1]) {
+					shown = append(shown, append(v, r[2]))
+				}
+			}
+			sort.Slice(shown, func(i, j int) bool { return shown[i][0] < shown[j][0] })
+			ranges = shown
+		}
+		for _, r := range ranges {
+			if r[0] >= r[1] || r[1] > len(positions) {
+				continue
+			}
+			copyTo(positions[r[0]])
+			b.WriteString(open(r[2]))
+			copyTo(positions[r[1]-1] + 1)
+			b.WriteString("[" + color + ":-]")
+		}
+		copyTo(len(line))
+		lines[i] = b.String()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,40 @@
+package parser
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHighlightMatchesNumbersBidiPieces(t *testing.T) {
+	p := NewHTMLParser()
+	if err := p.Parse(`<p dir="rtl">שלום abc def עולם</p>`, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	rendered := TviewRenderer{}.Render(p.doc, 80)
+	if len(rendered.Bidi) == 0 {
+		t.Fatal("the line isn't written in visual order")
+	}
+	text := strings.Join(rendered.Lines, "\n")
+	plain := PlainRenderer{}.Render(p.doc, 80)
+
+	tests := []struct {
+		pattern string
+		want    []int // Numbers of the matches opened, in visual order
+	}{
+		{pattern: `שלום abc`, want: []int{0, 0}}, // One match cut in two pieces
+		{pattern: `abc|עולם`, want: []int{1, 0}},
+	}
+	for _, tt := range tests {
+		var got []int
+		matches := FindText(plain.Lines, plain.Text, regexp.MustCompile(tt.pattern))
+		HighlightMatches(text, rendered.Bidi, matches, func(match int) string {
+			got = append(got, match)
+			return "[black:yellow]"
+		})
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: matches %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// svgHiddenTags are the SVG elements whose text isn't shown
+var svgHiddenTags = map[string]bool{
+	"desc": true, "defs": true, "style": true, "script": true, "metadata": true, "symbol": true,
+}
+
+// handleSVG adds the images of an SVG, with its title and text elements as a caption
+// An SVG without images in the middle of a paragraph keeps its text inline
+func (p *HTMLParser) handleSVG(n *html.Node) {
+	var captions []string
+	hasImage := false
+	var collect func(node *html.Node)
+	collect = func(node *html.Node) {
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || svgHiddenTags[c.Data] {
+				continue
+			}
+			switch c.Data {
+			case "image":
+				hasImage = true
+				p.handleImage(c)
+			case "title":
+				// Only the title of the SVG itself, the titles of its shapes are tooltips
+				if node == n {
+					captions = append(captions, svgText(c))
+				}
+			case "text":
+				captions = append(captions, svgText(c))
+			case "foreignObject":
+				p.parseChildren(c)
+			default:
+				collect(c)
+			}
+		}
+	}
+	collect(n)
+
+	var lines []string
+	for _, caption := range captions {
+		if caption != "" {
+			lines = append(lines, caption)
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	outer := p.text.style
+	p.text.style |= StyleItalic
+	if p.paragraph != nil && !hasImage {
+		p.handleText(" " + strings.Join(lines, " ") + " ")
+	} else {
+		p.startParagraph(&Block{Kind: BlockParagraph})
+		for i, l := range lines {
+			if i > 0 {
+				p.addInline(Inline{Kind: InlineBreak})
+			}
+			p.handleText(l)
+		}
+		p.endParagraph()
+	}
+	p.text.style = outer
+}
+
+// svgText returns the text of an SVG element, its <tspan> pieces joined by spaces
+func svgText(n *html.Node) string {
+	var pieces []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		pieces = append(pieces, nodeText(c))
+	}
+	return strings.Join(strings.Fields(strings.Join(pieces, " ")), " ")
+}
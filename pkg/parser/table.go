@@ -0,0 +1,466 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// minColumnWidth is the narrowest a column is shrunk to before falling back to the record layout
+const minColumnWidth = 6
+
+// maxColspan, maxRowspan and maxColumns bound the spans of the cells as the HTML spec does,
+// and the columns of a table, for a crafted table not to take all the memory
+const (
+	maxColspan = 1000
+	maxRowspan = 65534
+	maxColumns = 1000
+)
+
+// tableCell is a cell of a table laid out as lines
+type tableCell struct {
+	lines   []line
+	colspan int
+	header  bool
+	blocks  []*Block // Content of a cell holding a table, laid out again at the width of the cell
+}
+
+// tableRow is a row of a table laid out as cells
+type tableRow struct {
+	cells  []tableCell
+	header bool
+}
+
+// handleTable parses a table into its caption and rows of cells
+func (p *HTMLParser) handleTable(n *html.Node) {
+	block := &Block{Kind: BlockTable}
+	p.addBlock(block)
+
+	var collect func(node *html.Node, inHead bool)
+	collect = func(node *html.Node, inHead bool) {
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "caption":
+				p.parseInto(c, &block.Caption)
+			case "thead":
+				collect(c, true)
+			case "tbody", "tfoot":
+				collect(c, false)
+			case "tr":
+				row := TableRow{Header: inHead}
+				allHeaders := true
+				columns := 0 // Columns spanned by the cells of the row
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type != html.ElementNode || (cell.Data != "td" && cell.Data != "th") {
+						continue
+					}
+					if columns >= maxColumns {
+						break
+					}
+					colspan := min(spanAttr(cell, "colspan", 1, 1, maxColspan), maxColumns-columns)
+					columns += colspan
+					tableCell := TableCell{
+						Colspan: colspan,
+						Rowspan: spanAttr(cell, "rowspan", 1, 0, maxRowspan),
+						Header:  cell.Data == "th",
+					}
+					for _, id := range elementIDs(cell) {
+						p.addAnchor(id)
+					}
+					p.parseInto(cell, &tableCell.Blocks)
+					row.Cells = append(row.Cells, tableCell)
+					allHeaders = allHeaders && cell.Data == "th"
+				}
+				if len(row.Cells) > 0 {
+					row.Header = row.Header || allHeaders
+					block.Rows = append(block.Rows, row)
+				}
+			}
+		}
+	}
+	collect(n, false)
+}
+
+// spanAttr returns the value of the colspan or rowspan attribute of a cell clamped to low..high,
+// def when it's missing or invalid
+func spanAttr(n *html.Node, key string, def int, low int, high int) int {
+	span, err := strconv.Atoi(strings.TrimSpace(attrValue(n, key)))
+	if err != nil {
+		return def
+	}
+	return min(max(span, low), high)
+}
+
+// layoutTable lays out a table as a box-drawn grid
+// Tables too wide for the text area are shown as one record per row, the tables nested
+// in cells are laid out at the width of their cell
+// The anchors inside the table point to its first line
+func layoutTable(b *Block, width int) ([]line, map[string]int) {
+	anchors := make(map[string]int)
+	// cellLines lays out the blocks of a cell for a width without their blank lines,
+	// the text of the header cells is bold like the headings
+	cellLines := func(blocks []*Block, width int, header bool) []line {
+		lines, cellAnchors := layoutBlocks(blocks, width, layoutCell)
+		for id := range cellAnchors {
+			anchors[id] = 0
+		}
+		var result []line
+		for _, l := range lines {
+			if l = trimLine(l); !l.isBlank() {
+				if header {
+					for i := range l {
+						if l[i].isText() {
+							l[i].style |= StyleBold
+						}
+					}
+				}
+				result = append(result, l)
+			}
+		}
+		return result
+	}
+
+	caption := cellLines(b.Caption, width, false)
+	var rows []tableRow
+	for _, row := range b.Rows {
+		r := tableRow{header: row.Header}
+		for _, cell := range row.Cells {
+			c := tableCell{
+				lines:   cellLines(cell.Blocks, width, cell.Header || row.Header),
+				colspan: cell.Colspan,
+				header:  cell.Header,
+			}
+			if hasTable(cell.Blocks) {
+				c.blocks = cell.Blocks
+			}
+			r.cells = append(r.cells, c)
+		}
+		rows = append(rows, r)
+	}
+	if len(rows) == 0 {
+		return caption, anchors
+	}
+
+	lines := caption
+	if widths := layoutColumns(rows, width); widths != nil {
+		for _, row := range rows {
+			col := 0
+			for i, cell := range row.cells {
+				if cell.blocks != nil {
+					row.cells[i].lines = cellLines(cell.blocks, spannedWidth(widths, col, cell.colspan), cell.header || row.header)
+				}
+				col += cell.colspan
+			}
+		}
+		lines = append(lines, renderGrid(rows, widths)...)
+	} else {
+		for _, row := range rows {
+			for i, cell := range row.cells {
+				if cell.blocks != nil {
+					row.cells[i].lines = cellLines(cell.blocks, width, cell.header || row.header)
+				}
+			}
+		}
+		lines = append(lines, renderRecords(rows, width)...)
+	}
+	return append(lines, nil), anchors
+}
+
+// hasTable checks if blocks hold a table, at any depth
+func hasTable(blocks []*Block) bool {
+	for _, b := range blocks {
+		if b.Kind == BlockTable || hasTable(b.Children) {
+			return true
+		}
+	}
+	return false
+}
+
+// spannedWidth returns the width of the content of a cell spanning columns from col,
+// with the borders between them
+func spannedWidth(widths []int, col int, colspan int) int {
+	w := -3
+	for i := col; i < col+colspan && i < len(widths); i++ {
+		w += widths[i] + 3
+	}
+	return w
+}
+
+// columnCount returns the number of columns of the table
+func columnCount(rows []tableRow) int {
+	count := 0
+	for _, row := range rows {
+		n := 0
+		for _, cell := range row.cells {
+			n += cell.colspan
+		}
+		count = max(count, n)
+	}
+	return count
+}
+
+// layoutColumns computes the width of the content of each column
+// Columns get their natural width when the table fits, otherwise the widest
+// columns are shrunk. nil is returned when the table can't fit in width.
+func layoutColumns(rows []tableRow, width int) []int {
+	count := columnCount(rows)
+	if count > maxColumns {
+		return nil
+	}
+	natural := make([]int, count)
+	minimum := make([]int, count)
+
+	for _, row := range rows {
+		col := 0
+		for _, cell := range row.cells {
+			// Spanning cells are laid out across the widths of the columns they span
+			if cell.colspan == 1 {
+				for _, l := range cell.lines {
+					natural[col] = max(natural[col], l.width())
+					for _, w := range splitWords(l) {
+						minimum[col] = max(minimum[col], min(w.width, minColumnWidth))
+					}
+				}
+			}
+			col += cell.colspan
+		}
+	}
+	for i := range natural {
+		natural[i] = max(natural[i], 1)
+		minimum[i] = max(minimum[i], 1)
+	}
+
+	// Widen the last column spanned by cells wider than their columns
+	for _, row := range rows {
+		col := 0
+		for _, cell := range row.cells {
+			if cell.colspan > 1 && col+cell.colspan <= count {
+				spanned := 3 * (cell.colspan - 1)
+				for i := col; i < col+cell.colspan; i++ {
+					spanned += natural[i]
+				}
+				for _, l := range cell.lines {
+					if w := l.width(); w > spanned {
+						natural[col+cell.colspan-1] += w - spanned
+						spanned = w
+					}
+				}
+			}
+			col += cell.colspan
+		}
+	}
+
+	// Borders: "│ " before each column and " │" at the end
+	available := width - 3*count - 1
+	total := 0
+	for _, w := range natural {
+		total += w
+	}
+	if total <= available {
+		return natural
+	}
+
+	minTotal := 0
+	for _, w := range minimum {
+		minTotal += w
+	}
+	if minTotal > available {
+		return nil
+	}
+
+	// Take the missing width from the widest columns first
+	widths := append([]int(nil), natural...)
+	for excess := total - available; excess > 0; excess-- {
+		widest := -1
+		for i, w := range widths {
+			if w > minimum[i] && (widest == -1 || w > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest == -1 {
+			return nil
+		}
+		widths[widest]--
+	}
+	return widths
+}
+
+// renderGrid draws the table with box-drawing characters
+// The header rows are separated from the body by a double rule
+func renderGrid(rows []tableRow, widths []int) []line {
+	// boundaries returns the columns a row has a border before
+	boundaries := func(row *tableRow) map[int]bool {
+		bounds := map[int]bool{0: true, len(widths): true}
+		col := 0
+		for _, cell := range row.cells {
+			col += cell.colspan
+			bounds[col] = true
+		}
+		// Missing cells at the end of the row are drawn as empty cells
+		for ; col < len(widths); col++ {
+			bounds[col] = true
+		}
+		return bounds
+	}
+
+	// rule draws a horizontal line between the rows above and below (nil at the edges)
+	rule := func(above *tableRow, below *tableRow, double bool) line {
+		var up, down map[int]bool
+		if above != nil {
+			up = boundaries(above)
+		}
+		if below != nil {
+			down = boundaries(below)
+		}
+		horizontal, joints := "─", [2][2]string{{"─", "┬"}, {"┴", "┼"}}
+		left, right := "├", "┤"
+		if above == nil {
+			left, right = "┌", "┐"
+		} else if below == nil {
+			left, right = "└", "┘"
+		}
+		if double {
+			horizontal, joints = "═", [2][2]string{{"═", "╤"}, {"╧", "╪"}}
+			left, right = "╞", "╡"
+		}
+
+		var b strings.Builder
+		b.WriteString(left)
+		for i, w := range widths {
+			b.WriteString(strings.Repeat(horizontal, w+2))
+			if i == len(widths)-1 {
+				break
+			}
+			joint := joints[boolIndex(up[i+1])][boolIndex(down[i+1])]
+			b.WriteString(joint)
+		}
+		b.WriteString(right)
+		return line{{text: b.String()}}
+	}
+
+	var lines []line
+	for r := range rows {
+		var above *tableRow
+		if r > 0 {
+			above = &rows[r-1]
+		}
+		lines = append(lines, rule(above, &rows[r], r > 0 && rows[r-1].header && !rows[r].header))
+
+		// Wrap the cells, a row is as high as its highest cell
+		var cells [][]line
+		var cellWidths []int
+		height := 1
+		col := 0
+		for _, cell := range rows[r].cells {
+			w := spannedWidth(widths, col, cell.colspan)
+			col += cell.colspan
+
+			var wrapped []line
+			for _, l := range cell.lines {
+				for _, cellLine := range wrapLine(l, w, false) {
+					wrapped = append(wrapped, stripJoints(cellLine))
+				}
+			}
+			if cell.header {
+				for i := range wrapped {
+					wrapped[i] = padCenter(wrapped[i], w)
+				}
+			}
+			cells = append(cells, wrapped)
+			cellWidths = append(cellWidths, w)
+			height = max(height, len(wrapped))
+		}
+		// Rows with fewer cells are filled with empty ones
+		for ; col < len(widths); col++ {
+			cells = append(cells, nil)
+			cellWidths = append(cellWidths, widths[col])
+		}
+
+		for h := 0; h < height; h++ {
+			l := line{{text: "│"}}
+			for i, cell := range cells {
+				var text line
+				if h < len(cell) {
+					text = cell[h]
+				}
+				l = append(l, span{text: " "})
+				l = append(l, padRight(text, cellWidths[i])...)
+				l = append(l, span{text: " │"})
+			}
+			lines = append(lines, l)
+		}
+	}
+	lines = append(lines, rule(&rows[len(rows)-1], nil, false))
+
+	return lines
+}
+
+// renderRecords shows a table as a list of records, one per row,
+// each cell prefixed with the header of its column
+func renderRecords(rows []tableRow, width int) []line {
+	var headers []line
+	if rows[0].header {
+		for _, cell := range rows[0].cells {
+			name := joinLines(cell.lines)
+			for i := 0; i < cell.colspan; i++ {
+				headers = append(headers, name)
+			}
+		}
+		rows = rows[1:]
+	}
+
+	var lines []line
+	for r, row := range rows {
+		title := fmt.Sprintf("── %d ", r+1)
+		lines = append(lines, line{{text: title + strings.Repeat("─", max(width-textWidth(title), 0))}})
+
+		col := 0
+		for _, cell := range row.cells {
+			var text line
+			if col < len(headers) && len(headers[col]) > 0 {
+				text = append(append(text, headers[col]...), span{text: ": "})
+			}
+			col += cell.colspan
+
+			if cell.blocks != nil {
+				// A nested table is kept whole below the header of its column
+				if len(text) > 0 {
+					lines = append(lines, wrapLine(trimLine(text), width, false)...)
+				}
+				lines = append(lines, cell.lines...)
+				continue
+			}
+			text = append(text, joinLines(cell.lines)...)
+			lines = append(lines, wrapLine(text, width, false)...)
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, nil)
+	}
+	return lines
+}
+
+// joinLines joins lines into one, separated by spaces
+func joinLines(lines []line) line {
+	var joined line
+	for i, l := range lines {
+		if i > 0 {
+			joined = append(joined, span{text: " "})
+		}
+		joined = append(joined, l...)
+	}
+	return joined
+}
+
+// boolIndex converts a boolean to an index (false: 0, true: 1)
+func boolIndex(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
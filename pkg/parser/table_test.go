@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const nestedTableHTML = `<table>
+<tr><th>Name</th><th>Details</th></tr>
+<tr><td>Alpha</td><td>Some text<table>
+<tr><th>Key</th><th>Value</th></tr>
+<tr><td>size</td><td>large enough to wrap around</td></tr>
+</table></td></tr>
+</table>`
+
+func TestNestedTableFitsItsCell(t *testing.T) {
+	tests := []struct {
+		width   int
+		grid    bool // The nested table is drawn as a grid
+		records bool // The nested table is shown as records
+	}{
+		{width: 60, grid: true},
+		{width: 34, grid: true},
+		{width: 22, records: true},
+	}
+	for _, tt := range tests {
+		p := NewHTMLParser()
+		p.SetWidth(tt.width)
+		if err := p.Parse(nestedTableHTML, "", ""); err != nil {
+			t.Fatalf("width %d: %v", tt.width, err)
+		}
+		lines := p.GetPlainLines()
+		text := strings.Join(lines, "\n")
+		for _, l := range lines {
+			if w := textWidth(l); w > tt.width {
+				t.Errorf("width %d: line %q is %d cells wide", tt.width, l, w)
+			}
+			// The borders of the outer table are whole, the nested table is inside them
+			if strings.HasPrefix(l, "│") && !strings.HasSuffix(l, "│") {
+				t.Errorf("width %d: line %q is cut", tt.width, l)
+			}
+		}
+		if got := strings.Count(text, "┌"); tt.grid && got != 2 {
+			t.Errorf("width %d: %d grids drawn, want 2:\n%s", tt.width, got, text)
+		}
+		if tt.records && !strings.Contains(text, "│ Key: size") {
+			t.Errorf("width %d: nested table not shown as records:\n%s", tt.width, text)
+		}
+	}
+}
+
+func TestLayoutColumns(t *testing.T) {
+	cell := func(text string) tableCell {
+		return tableCell{lines: []line{{{text: text}}}, colspan: 1}
+	}
+	rows := []tableRow{
+		{cells: []tableCell{cell("a"), cell("a much longer cell")}},
+		{cells: []tableCell{cell("bbbb"), cell("c")}},
+	}
+	tests := []struct {
+		width int
+		want  []int
+	}{
+		{width: 80, want: []int{4, 18}}, // Natural widths
+		{width: 20, want: []int{4, 9}},  // The widest column is shrunk
+		{width: 12, want: nil},          // Too narrow for the minimum widths
+	}
+	for _, tt := range tests {
+		got := layoutColumns(rows, tt.width)
+		if !slices.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+			t.Errorf("layoutColumns(width %d) = %v, want %v", tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestTableSpansAreClamped(t *testing.T) {
+	tests := []struct {
+		html    string
+		colspan []int
+		rowspan []int
+	}{
+		{html: `<td colspan="2000000000" rowspan="99999">a</td><td>b</td>`, colspan: []int{1000}, rowspan: []int{65534}},
+		{html: `<td colspan="0" rowspan="0">a</td><td colspan="x">b</td>`, colspan: []int{1, 1}, rowspan: []int{0, 1}},
+		{html: `<td colspan="999">a</td><td colspan="999">b</td><td>c</td>`, colspan: []int{999, 1}, rowspan: []int{1, 1}},
+		{html: `<td colspan=" 3 ">a</td>`, colspan: []int{3}, rowspan: []int{1}},
+	}
+	for _, tt := range tests {
+		p := NewHTMLParser()
+		p.SetWidth(40)
+		if err := p.Parse("<table><tr>"+tt.html+"</tr></table>", "", ""); err != nil {
+			t.Fatalf("%s: %v", tt.html, err)
+		}
+		var colspan, rowspan []int
+		for _, b := range p.doc.Blocks {
+			if b.Kind != BlockTable {
+				continue
+			}
+			for _, cell := range b.Rows[0].Cells {
+				colspan = append(colspan, cell.Colspan)
+				rowspan = append(rowspan, cell.Rowspan)
+			}
+		}
+		if !slices.Equal(colspan, tt.colspan) || !slices.Equal(rowspan, tt.rowspan) {
+			t.Errorf("%s: spans %v %v, want %v %v", tt.html, colspan, rowspan, tt.colspan, tt.rowspan)
+		}
+		for _, l := range p.GetPlainLines() {
+			if w := textWidth(l); w > 40 {
+				t.Errorf("%s: line %q is %d cells wide", tt.html, l, w)
+			}
+		}
+	}
+}
+
+func TestHeaderCellsAreBold(t *testing.T) {
+	tests := []struct {
+		html  string
+		bold  []string
+		plain []string
+	}{
+		{html: `<table><tr><th>Name</th><th>Size</th></tr><tr><td>alpha</td><td>1</td></tr></table>`,
+			bold: []string{"Name", "Size"}, plain: []string{"alpha"}},
+		{html: `<table><thead><tr><td>Name</td></tr></thead><tr><td>alpha</td></tr></table>`,
+			bold: []string{"Name"}, plain: []string{"alpha"}},
+		{html: `<table><tr><th>Key</th><td>value</td></tr></table>`,
+			bold: []string{"Key"}, plain: []string{"value"}},
+	}
+	for _, tt := range tests {
+		p := NewHTMLParser()
+		p.SetWidth(40)
+		if err := p.Parse(tt.html, "", ""); err != nil {
+			t.Fatal(err)
+		}
+		text := strings.Join(p.GetLines(), "\n")
+		for _, word := range tt.bold {
+			if !strings.Contains(text, "[::b]"+word) {
+				t.Errorf("%s: %q isn't bold:\n%s", tt.html, word, text)
+			}
+		}
+		for _, word := range tt.plain {
+			if strings.Contains(text, "[::b]"+word) {
+				t.Errorf("%s: %q is bold:\n%s", tt.html, word, text)
+			}
+		}
+	}
+}
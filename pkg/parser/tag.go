@@ -1,107 +1,378 @@
 package parser
 
 import (
-	"fmt"
-	htmllib "html"
-	"regexp"
 	"strings"
 
 	"golang.org/x/net/html"
 )
 
-// handleStartTag handles the start of an HTML tag
-func (p *HTMLParser) handleStartTag(n *html.Node) {
+// hiddenTags are the elements whose content isn't shown
+var hiddenTags = map[string]bool{
+	"head": true, "script": true, "style": true, "template": true, "noscript": true,
+}
+
+// blockTags are the elements laid out as blocks of their own
+var blockTags = map[string]bool{
+	"html": true, "body": true, "p": true, "div": true, "section": true, "article": true,
+	"aside": true, "header": true, "footer": true, "nav": true, "main": true, "figure": true,
+	"figcaption": true, "address": true, "center": true, "dl": true, "hr": true,
+	"details": true, "summary": true, "fieldset": true, "form": true, "hgroup": true,
+}
+
+// structureTags are the elements with a block of their own kind
+var structureTags = map[string]bool{
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "pre": true,
+	"ul": true, "ol": true, "menu": true, "li": true, "dt": true, "dd": true,
+	"blockquote": true, "table": true,
+}
+
+// styleTags are the styles of the inline elements
+var styleTags = map[string]Style{
+	"b": StyleBold, "strong": StyleBold,
+	"i": StyleItalic, "em": StyleItalic, "cite": StyleItalic, "dfn": StyleItalic, "var": StyleItalic,
+	"u": StyleUnderline, "ins": StyleUnderline,
+	"s": StyleStrike, "strike": StyleStrike, "del": StyleStrike,
+	"code": StyleCode, "kbd": StyleCode, "samp": StyleCode, "tt": StyleCode,
+	"sup": StyleSuperscript, "sub": StyleSubscript,
+}
+
+// handleElement handles an HTML element and its children
+func (p *HTMLParser) handleElement(n *html.Node) {
 	tag := n.Data
-	p.currentTag = tag
-
-	// Check if this is a heading tag (h1-6)
-	isHeading := regexp.MustCompile(`^h[1-6]$`).MatchString(tag)
-
-	if isHeading {
-		p.isHead = true
-	} else if tag == "q" || tag == "dt" || tag == "dd" || tag == "blockquote" {
-		p.isInde = true
-	} else if tag == "pre" {
-		p.isPref = true
-		// For all pre tags, we'll treat them as code blocks
-		p.isCode = true
-	} else if tag == "code" {
-		// If already inside a pre tag, this is a code block
-		if p.isPref {
-			p.isCode = true
+	if hiddenTags[tag] {
+		return
+	}
+
+	css := p.styles.elementStyle(n)
+	if dir := strings.ToLower(attrValue(n, "dir")); dir != "" && css["direction"] == "" {
+		// The dir attribute is the direction of the element unless the stylesheets set it
+		css["direction"] = dir
+	}
+	if css["display"] == "none" {
+		// Links to hidden elements land where they would be
+		for _, id := range elementIDs(n) {
+			p.addAnchor(id)
 		}
-	} else if tag == "li" {
-		p.isBull = true
-	} else if tag == "script" || tag == "style" || tag == "head" {
-		p.isHidden = true
-	} else if tag == "sup" {
-		p.buffer += "^{"
-	} else if tag == "sub" {
-		p.buffer += "_{"
-	} else if tag == "img" || tag == "image" {
-		// Handle image tags
-		var src, alt string
-		for _, attr := range n.Attr {
-			if (tag == "img" && attr.Key == "src") || (tag == "image" && strings.HasSuffix(attr.Key, "href")) {
-				src = attr.Val
-			} else if attr.Key == "alt" {
-				alt = attr.Val
-			}
+		return
+	}
+	block := isBlockElement(tag, css["display"])
+
+	// Blocks start with the ids of their elements, inline elements record them where they are
+	if block {
+		p.endParagraph()
+	}
+	for _, id := range elementIDs(n) {
+		p.addAnchor(id)
+	}
+
+	outer := p.text
+	p.text.style |= styleTags[tag]
+	if lang := elementLang(n); lang != "" {
+		p.text.lang = lang
+	}
+	// The margins of the page are the reader's
+	p.applyStyle(css, block && tag != "html" && tag != "body")
+	if block {
+		p.applyDirection(css)
+	}
+
+	switch {
+	case isNoteRef(n):
+		p.handleNoteRef(n)
+	case len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6':
+		p.startParagraph(&Block{Kind: BlockHeading, Level: int(tag[1] - '0')})
+		p.parseChildren(n)
+		p.endParagraph()
+	case tag == "dt":
+		p.startParagraph(&Block{Kind: BlockTerm})
+		p.parseChildren(n)
+		p.endParagraph()
+	case tag == "pre":
+		p.handlePre(n)
+	case tag == "ul" || tag == "ol" || tag == "menu":
+		p.handleList(n)
+	case tag == "li":
+		p.handleListItem(n)
+	case tag == "dd":
+		block := &Block{Kind: BlockDefinition}
+		p.addBlock(block)
+		p.parseInto(n, &block.Children)
+	case tag == "blockquote":
+		block := &Block{Kind: BlockQuote}
+		p.addBlock(block)
+		p.parseInto(n, &block.Children)
+	case tag == "table":
+		p.handleTable(n)
+	case tag == "ruby":
+		p.handleRuby(n)
+	case tag == "math":
+		p.handleMath(n)
+	case tag == "svg":
+		p.handleSVG(n)
+	case tag == "img" || tag == "image":
+		p.handleImage(n)
+	case tag == "figcaption" && isImageCaption(n):
+		// Shown in the markers of the images
+	case tag == "br":
+		p.addInline(Inline{Kind: InlineBreak})
+	case tag == "a" && isInternalLink(attrValue(n, "href")):
+		p.handleLink(n)
+	default:
+		p.parseChildren(n)
+		if block {
+			p.endParagraph()
 		}
-		if src != "" {
-			imgIndex := len(p.images)
-			imgText := fmt.Sprintf("[IMG:%d]", imgIndex)
-			if alt != "" {
-				imgText = fmt.Sprintf("[IMG:%d - %s]", imgIndex, alt)
-			}
-			p.text = append(p.text, imgText)
-			p.images = append(p.images, htmllib.UnescapeString(src))
+	}
+	p.text = outer
+}
+
+// isBlockElement checks if an element is laid out as a block, the CSS display
+// changes inline elements into blocks and back, the structures keep their kind
+func isBlockElement(tag string, display string) bool {
+	if structureTags[tag] {
+		return true
+	}
+	switch display {
+	case "block", "list-item", "flex", "grid", "table", "table-row", "table-caption":
+		return true
+	case "inline", "inline-block", "inline-flex", "inline-grid", "inline-table":
+		return false
+	}
+	return blockTags[tag]
+}
+
+// applyStyle applies the CSS declarations of an element to the style its content inherits,
+// the alignment and the margin only apply to blocks
+func (p *HTMLParser) applyStyle(css map[string]string, block bool) {
+	switch weight := css["font-weight"]; weight {
+	case "bold", "bolder", "600", "700", "800", "900":
+		p.text.style |= StyleBold
+	case "normal", "lighter", "100", "200", "300", "400", "500":
+		p.text.style &^= StyleBold
+	}
+	switch css["font-style"] {
+	case "italic", "oblique":
+		p.text.style |= StyleItalic
+	case "normal":
+		p.text.style &^= StyleItalic
+	}
+	if whiteSpace := css["white-space"]; whiteSpace != "" {
+		p.text.whiteSpace = whiteSpace
+	}
+	if !block {
+		return
+	}
+	switch css["text-align"] {
+	case "center":
+		p.text.align = AlignCenter
+	case "right", "end":
+		p.text.align = AlignRight
+	case "left", "start", "justify":
+		p.text.align = AlignLeft
+	}
+	p.text.indent += cssIndent(css["margin-left"])
+}
+
+// applyDirection applies the CSS direction of a block to the blocks it holds
+func (p *HTMLParser) applyDirection(css map[string]string) {
+	switch css["direction"] {
+	case "rtl":
+		p.text.dir = DirRTL
+	case "ltr":
+		p.text.dir = DirLTR
+	case "auto":
+		p.text.dir = DirAuto
+	}
+}
+
+// isPreformatted checks if a CSS white-space keeps the whitespace of the text
+func isPreformatted(whiteSpace string) bool {
+	return whiteSpace == "pre" || whiteSpace == "pre-wrap" || whiteSpace == "break-spaces"
+}
+
+// handleImage adds an image as a block of its own
+func (p *HTMLParser) handleImage(n *html.Node) {
+	image := Image{Caption: figureCaption(n), Description: describedBy(n)}
+	for _, attr := range n.Attr {
+		switch {
+		case (n.Data == "img" && attr.Key == "src") || (n.Data == "image" && strings.HasSuffix(attr.Key, "href")):
+			image.Src = attr.Val
+		case attr.Key == "alt":
+			image.Alt = collapseSpaces(attr.Val)
+		case attr.Key == "title":
+			image.Title = collapseSpaces(attr.Val)
 		}
-	} else if tag == "br" {
-		p.text = append(p.text, "")
 	}
+	if image.Src == "" {
+		return
+	}
+	block := &Block{Kind: BlockImage, Image: len(p.doc.Images), Label: image.Label()}
+	if p.imageSize != nil {
+		block.Size = p.imageSize(image.Src)
+	}
+	p.addBlock(block)
+	p.doc.Images = append(p.doc.Images, image)
 }
 
-// handleEndTag handles the end of an HTML tag
-func (p *HTMLParser) handleEndTag(n *html.Node) {
-	tag := n.Data
+// collapseSpaces trims text and turns its runs of whitespace into single spaces
+func collapseSpaces(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
 
-	// Check if this is a heading tag (h1-h6)
-	isHeading := regexp.MustCompile(`^h[1-6]$`).MatchString(tag)
-
-	if isHeading {
-		p.text = append(p.text, "")
-		p.text = append(p.text, "")
-		p.isHead = false
-	} else if tag == "p" || tag == "div" {
-		p.text = append(p.text, "")
-	} else if tag == "script" || tag == "style" || tag == "head" {
-		p.isHidden = false
-	} else if tag == "q" || tag == "dt" || tag == "dd" || tag == "blockquote" {
-		if p.text[len(p.text)-1] != "" {
-			p.text = append(p.text, "")
+// enclosingFigure returns the figure holding an element, nil without one
+func enclosingFigure(n *html.Node) *html.Node {
+	for figure := n.Parent; figure != nil; figure = figure.Parent {
+		if figure.Type == html.ElementNode && figure.Data == "figure" {
+			return figure
 		}
-		p.isInde = false
-	} else if tag == "pre" {
-		if p.text[len(p.text)-1] != "" {
-			p.text = append(p.text, "")
+	}
+	return nil
+}
+
+// figureCaption returns the caption of the figure holding an element, empty without one
+func figureCaption(n *html.Node) string {
+	figure := enclosingFigure(n)
+	if figure == nil {
+		return ""
+	}
+	for c := figure.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "figcaption" {
+			return collapseSpaces(nodeText(c))
+		}
+	}
+	return ""
+}
+
+// describedBy returns the text of the elements named by the aria-describedby attribute of an element
+func describedBy(n *html.Node) string {
+	ids := strings.Fields(attrValue(n, "aria-describedby"))
+	if len(ids) == 0 {
+		return ""
+	}
+	root := n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	var texts []string
+	for _, id := range ids {
+		if element := findElement(root, func(e *html.Node) bool { return attrValue(e, "id") == id }); element != nil {
+			texts = append(texts, collapseSpaces(nodeText(element)))
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+// findElement returns the first element of a tree matching a condition, nil without one
+func findElement(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// isImageCaption checks if a figcaption is the caption of images of its figure, its text is then
+// in their markers; a caption with links is kept for them to be followed
+func isImageCaption(n *html.Node) bool {
+	figure := enclosingFigure(n)
+	if figure == nil || n.Parent != figure {
+		return false
+	}
+	isImage := func(e *html.Node) bool { return e.Data == "img" || e.Data == "image" }
+	isLink := func(e *html.Node) bool { return e.Data == "a" && attrValue(e, "href") != "" }
+	return findElement(figure, isImage) != nil && findElement(n, isLink) == nil
+}
+
+// handlePre adds a block of preformatted text, its whitespace is kept
+func (p *HTMLParser) handlePre(n *html.Node) {
+	var code strings.Builder
+	var ids []string
+	var collect func(node *html.Node)
+	collect = func(node *html.Node) {
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				code.WriteString(c.Data)
+			case c.Type != html.ElementNode || hiddenTags[c.Data]:
+			case c.Data == "br":
+				code.WriteString("\n")
+			default:
+				ids = append(ids, elementIDs(c)...)
+				collect(c)
+			}
+		}
+	}
+	collect(n)
+
+	// A newline right after <pre> isn't part of the text
+	text := strings.TrimPrefix(code.String(), "\n")
+	text = strings.TrimRight(text, " \t\r\n")
+
+	block := &Block{Kind: BlockCode, Code: text, Language: codeLanguage(n, text)}
+	p.addBlock(block)
+	block.IDs = append(block.IDs, ids...)
+}
+
+// codeLanguage returns the language of a code block from the attributes of the <pre>
+// or of the <code> it holds (class="language-go", class="lang-go", class="go", data-lang="go"),
+// or guesses it from the code when none is declared
+func codeLanguage(n *html.Node, code string) string {
+	nodes := []*html.Node{n}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "code" {
+			nodes = append(nodes, c)
+		}
+	}
+	for _, node := range nodes {
+		for _, key := range []string{"data-lang", "data-language"} {
+			if name := languageName(attrValue(node, key)); name != "" {
+				return name
+			}
+		}
+		for _, class := range strings.Fields(attrValue(node, "class")) {
+			for _, prefix := range []string{"language-", "lang-"} {
+				class = strings.TrimPrefix(class, prefix)
+			}
+			if name := languageName(class); name != "" {
+				return name
+			}
 		}
-		p.isPref = false
-		p.isCode = false
-	} else if tag == "code" {
-		if p.isPref && p.isCode {
-			p.isCode = false
+	}
+	return detectLanguage(code)
+}
+
+// attrValue returns the value of an attribute of a node, empty when missing
+func attrValue(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
 		}
-	} else if tag == "li" {
-		if p.text[len(p.text)-1] != "" {
-			p.text = append(p.text, "")
+	}
+	return ""
+}
+
+// elementLang returns the language of an element from its lang or xml:lang attribute
+func elementLang(n *html.Node) string {
+	for _, attr := range n.Attr {
+		if attr.Key == "lang" || attr.Key == "xml:lang" {
+			return strings.TrimSpace(attr.Val)
 		}
-		p.isBull = false
-	} else if tag == "sub" || tag == "sup" {
-		p.buffer += "}"
-	} else if tag == "img" || tag == "image" {
-		p.text = append(p.text, "")
 	}
+	return ""
+}
 
-	p.currentTag = ""
+// elementIDs returns the ids of an element,
+// <a name="..."> anchors of older books are ids as well
+func elementIDs(n *html.Node) []string {
+	var ids []string
+	for _, attr := range n.Attr {
+		if (attr.Key == "id" || (attr.Key == "name" && n.Data == "a")) && attr.Val != "" {
+			ids = append(ids, attr.Val)
+		}
+	}
+	return ids
 }
@@ -0,0 +1,205 @@
+package parser
+
+import "strings"
+
+// Joint is how a line follows the line before it in the text of the document
+type Joint int
+
+const (
+	JointLine    Joint = iota // A new line of the same block, after a line break
+	JointBlock                // The first line of a block
+	JointSpace                // A wrapped line, a space separates it from the line before
+	JointWord                 // A line wrapped in a word or between wide characters
+	JointReading              // The ruby readings of the line after it, not in the text of the document
+)
+
+// TextLine is the text of the document a laid out line holds
+type TextLine struct {
+	// Ranges are the byte ranges of the line without styles, in logical order, holding the text:
+	// the indentation of wrapped lines, the hyphens and the spaces justifying the line are left out
+	Ranges [][2]int
+	Joint  Joint
+}
+
+// textLine finds the text of the document in a line
+func textLine(l line) TextLine {
+	var t TextLine
+	pos := 0
+	add := func(start int, end int) {
+		if n := len(t.Ranges); n > 0 && t.Ranges[n-1][1] == start {
+			t.Ranges[n-1][1] = end
+		} else if start < end {
+			t.Ranges = append(t.Ranges, [2]int{start, end})
+		}
+	}
+	for _, s := range l {
+		switch {
+		case s.joint == JointReading:
+			return TextLine{Joint: JointReading}
+		case s.joint == JointSpace || s.joint == JointWord:
+			// What comes before is the indentation of the wrapped line
+			t.Ranges, t.Joint = nil, s.joint
+		case s.joint == JointBlock:
+			t.Joint = JointBlock
+		case s.hyphen:
+		case s.gap:
+			add(pos, pos+min(len(s.text), 1))
+		default:
+			add(pos, pos+len(s.text))
+		}
+		pos += len(s.text)
+	}
+	return t
+}
+
+// textLines finds the text of the document in the lines, a ruby line gives the block
+// it starts to the line after it
+func textLines(lines []line) []TextLine {
+	text := make([]TextLine, len(lines))
+	block := false
+	for i, l := range lines {
+		text[i] = textLine(l)
+		switch {
+		case text[i].Joint == JointReading:
+			block = block || hasJoint(l, JointBlock)
+		case block:
+			text[i].Joint = JointBlock
+			block = false
+		}
+	}
+	return text
+}
+
+// hasJoint checks if a line holds a joint
+func hasJoint(l line, joint Joint) bool {
+	for _, s := range l {
+		if s.joint == joint {
+			return true
+		}
+	}
+	return false
+}
+
+// stripJoints removes the joints of a line put inside another one, like a line of a table cell
+func stripJoints(l line) line {
+	var stripped line
+	for _, s := range l {
+		if s.joint == JointLine {
+			stripped = append(stripped, s)
+		}
+	}
+	return stripped
+}
+
+// DumpText writes the text of the document held by lines without styles: the wrapped lines
+// are joined, the blocks are separated by a blank line and the blank lines ending a block dropped
+func DumpText(lines []string, text []TextLine) string {
+	var b strings.Builder
+	pending := ""    // Separator written before the next text
+	started := false // Text of the current block was written
+	for i := range min(len(lines), len(text)) {
+		switch text[i].Joint {
+		case JointReading:
+			continue
+		case JointBlock:
+			pending, started = "", false
+			if b.Len() > 0 {
+				pending = "\n\n"
+			}
+		case JointSpace:
+			pending += " "
+		case JointLine:
+			if started {
+				pending += "\n"
+			}
+		}
+		for _, r := range text[i].Ranges {
+			if r[0] < r[1] && r[1] <= len(lines[i]) {
+				b.WriteString(pending)
+				b.WriteString(lines[i][r[0]:r[1]])
+				pending, started = "", true
+			}
+		}
+	}
+	return b.String()
+}
+
+// Matcher finds the byte ranges of the first n matches of a pattern in a text, all of them if n < 0,
+// like regexp.Regexp
+type Matcher interface {
+	FindAllStringIndex(s string, n int) [][]int
+}
+
+// TextMatch is a match of a pattern in the text of the document
+type TextMatch struct {
+	Line       int         // Line the match starts on
+	Pieces     []TextPiece // Parts of the match on each line, in logical order
+	Text       string      // Text of the lines holding the match, wrapped lines joined
+	Start, End int         // Byte range of the match in Text
+}
+
+// TextPiece is the byte range of a line without styles holding a part of a match
+type TextPiece struct {
+	Line, Start, End int
+}
+
+// FindText finds the matches of a pattern in the text of the document held by lines without
+// styles, with the text of each line; the lines wrapped from the same line of the document are
+// joined for the matches to go across them
+// The empty matches and the matches of the space joining two lines only are dropped
+func FindText(lines []string, text []TextLine, re Matcher) []TextMatch {
+	// segment is a range of a line copied in the joined text
+	type segment struct {
+		offset           int
+		line, start, end int
+	}
+	var matches []TextMatch
+	var joined strings.Builder
+	var segments []segment
+	flush := func() {
+		s := joined.String()
+		for _, match := range re.FindAllStringIndex(s, -1) {
+			m := TextMatch{Text: s, Start: match[0], End: match[1]}
+			for _, seg := range segments {
+				start := max(match[0], seg.offset) - seg.offset + seg.start
+				end := min(match[1], seg.offset+seg.end-seg.start) - seg.offset + seg.start
+				if start >= end {
+					continue
+				}
+				if n := len(m.Pieces); n > 0 && m.Pieces[n-1].Line == seg.line {
+					// Pieces of a line go over the spaces justifying it
+					m.Pieces[n-1].End = end
+				} else {
+					m.Pieces = append(m.Pieces, TextPiece{Line: seg.line, Start: start, End: end})
+				}
+			}
+			if len(m.Pieces) > 0 {
+				m.Line = m.Pieces[0].Line
+				matches = append(matches, m)
+			}
+		}
+		joined.Reset()
+		segments = nil
+	}
+
+	for i := range min(len(lines), len(text)) {
+		switch text[i].Joint {
+		case JointReading:
+			continue
+		case JointSpace:
+			joined.WriteString(" ")
+		case JointWord:
+		default:
+			flush()
+		}
+		for _, r := range text[i].Ranges {
+			if r[1] > len(lines[i]) {
+				break
+			}
+			segments = append(segments, segment{offset: joined.Len(), line: i, start: r[0], end: r[1]})
+			joined.WriteString(lines[i][r[0]:r[1]])
+		}
+	}
+	flush()
+	return matches
+}
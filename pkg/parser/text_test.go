@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFindTextAcrossLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		html      string
+		width     int
+		justify   bool
+		hyphenate bool
+		ruby      RubyMode
+		pattern   string
+		want      []string // Text of each match
+		lines     int      // Lines the first match is on
+	}{
+		{
+			name: "wrapped", html: "<p>one two three four five six</p>", width: 10,
+			pattern: `two three`, want: []string{"two three"}, lines: 2,
+		},
+		{
+			name: "justified", html: "<p>one two three four five six seven</p>", width: 13, justify: true,
+			pattern: `two three|five six`, want: []string{"two three", "five six"}, lines: 1,
+		},
+		{
+			name: "hyphenated", html: "<p>an extraordinarily long word</p>", width: 12, hyphenate: true,
+			pattern: `extraordinarily`, want: []string{"extraordinarily"}, lines: 2,
+		},
+		{
+			name: "soft hyphens", html: "<p>an extra­ordinarily long word</p>", width: 10,
+			pattern: `extraordinarily long`, want: []string{"extraordinarily long"}, lines: 3,
+		},
+		{
+			name: "wide characters", html: "<p>日本語の文章です</p>", width: 6,
+			pattern: `語の文`, want: []string{"語の文"}, lines: 2,
+		},
+		{
+			name: "list item", html: "<ul><li>alpha beta gamma delta</li></ul>", width: 14,
+			pattern: `beta gamma delta`, want: []string{"beta gamma delta"}, lines: 3,
+		},
+		{
+			name: "preformatted", html: "<pre>abcdefghij</pre>", width: 6,
+			pattern: `efgh`, want: []string{"efgh"}, lines: 2,
+		},
+		{
+			name: "paragraphs", html: "<p>one</p><p>two</p><p>one<br>two</p>", width: 20,
+			pattern: `one ?two`,
+		},
+		{
+			name: "ruby readings", html: "<p><ruby>漢字<rt>かんじ</rt></ruby>を読む</p>", width: 20, ruby: RubyAbove,
+			pattern: `かんじ|漢字を`, want: []string{"漢字を"}, lines: 1,
+		},
+	}
+	for _, tt := range tests {
+		p := NewHTMLParser()
+		p.SetWidth(tt.width)
+		p.SetJustify(tt.justify)
+		p.SetLanguage("en")
+		p.SetHyphenation(tt.hyphenate)
+		p.SetRubyMode(tt.ruby)
+		if err := p.Parse(tt.html, "", ""); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		lines := p.GetPlainLines()
+		matches := FindText(lines, p.GetTextLines(), regexp.MustCompile(tt.pattern))
+
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.Text[m.Start:m.End])
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: matches %q, want %q in\n%s", tt.name, got, tt.want, strings.Join(lines, "\n"))
+			continue
+		}
+		if len(matches) > 0 && len(matches[0].Pieces) != tt.lines {
+			t.Errorf("%s: first match on %d lines, want %d: %+v", tt.name, len(matches[0].Pieces), tt.lines, matches[0].Pieces)
+		}
+		for _, m := range matches {
+			if m.Line != m.Pieces[0].Line {
+				t.Errorf("%s: match starts on line %d, its first piece on line %d", tt.name, m.Line, m.Pieces[0].Line)
+			}
+		}
+	}
+}
+
+func TestHighlightMatchesAcrossLines(t *testing.T) {
+	p := NewHTMLParser()
+	p.SetWidth(15)
+	p.SetJustify(true)
+	if err := p.Parse("<p>one two three four five six seven</p>", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	matches := FindText(p.GetPlainLines(), p.GetTextLines(), regexp.MustCompile(`two three|six seven`))
+	text := HighlightMatches(strings.Join(p.GetLines(), "\n"), nil, matches, func(match int) string {
+		return "<" + string(rune('a'+match)) + ">"
+	})
+	// The spaces justifying a line are highlighted with the words around them
+	want := "one  <a>two  three[-:-]\nfour  five  <b>six[-:-]\n<b>seven[-:-]"
+	if text != want {
+		t.Errorf("highlighted text\n%q, want\n%q", text, want)
+	}
+}
@@ -0,0 +1,391 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// defaultWidth is the width used to lay out the text when the width of the text area is unknown
+const defaultWidth = 80
+
+// NoWrap is the width laying out the lines whole, to dump the text
+const NoWrap = -1
+
+// textWidth returns the number of cells the text takes on the screen
+func textWidth(text string) int {
+	return runewidth.StringWidth(text)
+}
+
+// tabWidth is the distance between the tab stops, tview draws tabs up to the next one
+const tabWidth = 4
+
+// expandTabs replaces the tabs of a preformatted line with spaces up to the next tab stop,
+// for the line to be measured as it is drawn
+func expandTabs(l line) line {
+	col := 0
+	for i, s := range l {
+		if !strings.ContainsRune(s.text, '\t') {
+			col += textWidth(s.text)
+			continue
+		}
+		var b strings.Builder
+		for _, r := range s.text {
+			if r == '\t' {
+				n := tabWidth - col%tabWidth
+				b.WriteString(strings.Repeat(" ", n))
+				col += n
+				continue
+			}
+			b.WriteRune(r)
+			col += runewidth.RuneWidth(r)
+		}
+		l[i].text = b.String()
+	}
+	return l
+}
+
+// noLineStart are the characters that can't start a line (kinsoku shori):
+// closing brackets, punctuation, small kana and prolonged sound marks
+var noLineStart = runeSet(")]}〕〉》」』】〙〗〟’”｠»ヽヾーァィゥェォッャュョヮヵヶぁぃぅぇぉっゃゅょゎゕゖ" +
+	"ㇰㇱㇲㇳㇴㇵㇶㇷㇸㇹㇺㇻㇼㇽㇾㇿ々〻‐゠–〜～?!‼⁇⁈⁉・、:;,.。）］｝，．：；？！")
+
+// noLineEnd are the characters that can't end a line: opening brackets
+var noLineEnd = runeSet("([{〔〈《「『【〘〖〝‘“｟«（［｛")
+
+// runeSet returns the set of the characters of a string
+func runeSet(chars string) map[rune]bool {
+	set := make(map[rune]bool)
+	for _, r := range chars {
+		set[r] = true
+	}
+	return set
+}
+
+// canBreak checks if a line can break between two characters not separated by a space,
+// lines break around wide characters (CJK) unless the kinsoku rules forbid it
+func canBreak(before rune, after rune) bool {
+	if before == 0 || noLineEnd[before] || noLineStart[after] {
+		return false
+	}
+	return runewidth.RuneWidth(before) == 2 || runewidth.RuneWidth(after) == 2
+}
+
+// word is a run of spans the line can't break in, but for hyphens
+type word struct {
+	spans      line
+	width      int
+	spaced     bool  // A space separates the word from the one before it
+	breaks     []int // Widths of the heads the word can be hyphenated after
+	hyphenated bool  // The breaks of the hyphenation dictionary were added
+}
+
+// splitWords splits a line into words at spaces and between wide characters,
+// anchors stick to the word after them and markers and ruby to the word before them
+func splitWords(l line) []word {
+	var words []word
+	var current word
+	var last rune // Last character of the current word
+	spaced := false
+	flush := func() {
+		if current.width > 0 {
+			words = append(words, current)
+			current, last = word{}, 0
+		}
+	}
+	start := func(first rune) {
+		if current.width > 0 && canBreak(last, first) {
+			flush()
+		}
+		if current.width == 0 {
+			current.spaced = spaced && len(words) > 0
+			spaced = false
+		}
+	}
+
+	for _, s := range l {
+		switch {
+		case s.anchor != "":
+			current.spans = append(current.spans, s)
+		case s.marker || s.ruby != "":
+			first, _ := utf8.DecodeRuneInString(s.text)
+			if s.ruby != "" {
+				start(first)
+			} else if current.width == 0 {
+				start(first)
+			}
+			current.spans = append(current.spans, s)
+			current.width += textWidth(s.text)
+			last, _ = utf8.DecodeLastRuneInString(s.text)
+		default:
+			for _, r := range s.text {
+				if r == ' ' {
+					flush()
+					spaced = true
+					continue
+				}
+				if r == softHyphen {
+					if current.width > 0 {
+						current.breaks = append(current.breaks, current.width)
+					}
+					continue
+				}
+				start(r)
+				n := len(current.spans)
+				if n > 0 && current.spans[n-1].isText() && current.spans[n-1].style == s.style &&
+					current.spans[n-1].token == s.token && current.spans[n-1].dir == s.dir {
+					current.spans[n-1].text += string(r)
+				} else {
+					current.spans = append(current.spans, span{text: string(r), style: s.style, token: s.token, dir: s.dir})
+				}
+				current.width += runewidth.RuneWidth(r)
+				last = r
+			}
+		}
+	}
+	if current.width > 0 || len(words) == 0 {
+		words = append(words, current)
+	} else {
+		// Anchors at the end of the line
+		words[len(words)-1].spans = append(words[len(words)-1].spans, current.spans...)
+	}
+	return words
+}
+
+// cutWord cuts the head of a word no wider than width
+func cutWord(w word, width int) (head word, tail word) {
+	for i, s := range w.spans {
+		sw := textWidth(s.text)
+		if head.width+sw <= width {
+			head.spans = append(head.spans, s)
+			head.width += sw
+			continue
+		}
+		text := runewidth.Truncate(s.text, width-head.width, "")
+		if text == "" && head.width == 0 {
+			// A wide character in a one-cell width
+			_, size := utf8.DecodeRuneInString(s.text)
+			text = s.text[:size]
+		}
+		if text != "" {
+			cut := s
+			cut.text = text
+			head.spans = append(head.spans, cut)
+			head.width += textWidth(text)
+		}
+		rest := s
+		rest.text = s.text[len(text):]
+		tail.spans = append(line{rest}, w.spans[i+1:]...)
+		tail.width = w.width - head.width
+		return head, tail
+	}
+	return head, tail
+}
+
+// wrapLine breaks a line into lines no wider than width, at spaces when possible
+// Words going past the end of a line are hyphenated at their soft hyphens, and at the places
+// the hyphenation dictionary finds when hyphenate is set, the words wider than a line are cut
+// The lines after the first one start with a joint telling how they go on from the one before
+func wrapLine(l line, width int, hyphenate bool) []line {
+	if width <= 0 || l.width() <= width {
+		return []line{stripSoftHyphens(l)}
+	}
+
+	var lines []line
+	var current line
+	currentWidth := 0
+	for _, w := range splitWords(l) {
+		for {
+			gap := 0
+			if w.spaced && currentWidth > 0 {
+				gap = 1
+			}
+			if currentWidth+gap+w.width <= width {
+				current = appendWord(current, w, gap)
+				currentWidth += gap + w.width
+				break
+			}
+			if head, tail, ok := breakWord(w, width-currentWidth-gap, hyphenate); ok {
+				lines = append(lines, appendWord(current, head, gap))
+				current, currentWidth = line{{joint: JointWord}}, 0
+				w = tail
+				continue
+			}
+			if currentWidth > 0 {
+				lines = append(lines, current)
+				current, currentWidth = line{{joint: JointWord}}, 0
+				if w.spaced {
+					current[0].joint = JointSpace
+				}
+				continue
+			}
+			var head word
+			head, w = cutWord(w, width)
+			lines = append(lines, append(current, head.spans...))
+			current = line{{joint: JointWord}}
+		}
+	}
+	if currentWidth > 0 || len(current) > 0 || len(lines) == 0 {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// appendWord appends a word to a line, after a space when gap is 1
+func appendWord(l line, w word, gap int) line {
+	if gap > 0 && len(l) > 0 && len(w.spans) > 0 {
+		// The space keeps the style shared by the words around it
+		space := span{text: " ", style: l[len(l)-1].style & w.spans[0].style, gap: true}
+		if d := w.spans[0].dir; l[len(l)-1].dir == d {
+			space.dir = d
+		}
+		l = append(l, space)
+	}
+	return append(l, w.spans...)
+}
+
+// breakWord hyphenates a word for its head and a hyphen to take at most width,
+// at the last place it can, ok is false when it can't
+func breakWord(w word, width int, hyphenate bool) (head word, tail word, ok bool) {
+	if hyphenate && !w.hyphenated {
+		w.breaks = append(w.breaks, dictionaryBreaks(w)...)
+		w.hyphenated = true
+	}
+	at := 0
+	for _, b := range w.breaks {
+		if b+1 <= width && b > at && b < w.width {
+			at = b
+		}
+	}
+	if at == 0 {
+		return head, tail, false
+	}
+
+	head, tail = cutWord(w, at)
+	style := Style(0)
+	for _, s := range head.spans {
+		if s.isText() {
+			style = s.style
+		}
+	}
+	head.spans = append(head.spans, span{text: "-", style: style, dir: head.spans[len(head.spans)-1].dir, hyphen: true})
+	head.width++
+	for _, b := range w.breaks {
+		if b > at {
+			tail.breaks = append(tail.breaks, b-at)
+		}
+	}
+	tail.hyphenated = true
+	return head, tail, true
+}
+
+// dictionaryBreaks returns the widths of the heads a word can be hyphenated after,
+// from the hyphenation dictionary, each run of ASCII letters is hyphenated on its own
+// Code, addresses and paths aren't hyphenated
+func dictionaryBreaks(w word) []int {
+	for _, s := range w.spans {
+		if s.isText() && (s.style&StyleCode != 0 || strings.ContainsAny(s.text, "/\\@_0123456789")) {
+			return nil
+		}
+	}
+	var breaks []int
+	column := 0  // Width of the word before the current span
+	letters := 0 // Column the current run of letters starts at
+	var run strings.Builder
+	flush := func() {
+		for _, n := range englishHyphenator().hyphenate(run.String()) {
+			breaks = append(breaks, letters+n)
+		}
+		run.Reset()
+	}
+	for _, s := range w.spans {
+		if !s.isText() {
+			flush()
+			column += textWidth(s.text)
+			continue
+		}
+		for _, r := range s.text {
+			if r < 128 && unicode.IsLetter(r) {
+				if run.Len() == 0 {
+					letters = column
+				}
+				run.WriteRune(r)
+			} else {
+				flush()
+			}
+			column += runewidth.RuneWidth(r)
+		}
+	}
+	flush()
+	return breaks
+}
+
+// breakLine breaks a preformatted line into lines no wider than width, wherever the width ends
+func breakLine(l line, width int) []line {
+	if width <= 0 || l.width() <= width {
+		return []line{l}
+	}
+	var lines []line
+	rest := word{spans: l, width: l.width()}
+	for rest.width > width {
+		var head word
+		head, rest = cutWord(rest, width)
+		lines = append(lines, head.spans)
+		rest.spans = append(line{{joint: JointWord}}, rest.spans...)
+	}
+	return append(lines, rest.spans)
+}
+
+// justifyLine widens the spaces between the words of a wrapped line for it to fill the width,
+// the spaces on the left widen first
+func justifyLine(l line, width int) line {
+	var gaps []int
+	for i, s := range l {
+		if s.gap {
+			gaps = append(gaps, i)
+		}
+	}
+	extra := width - l.width()
+	if len(gaps) == 0 || extra <= 0 {
+		return l
+	}
+	for k, i := range gaps {
+		n := extra / len(gaps)
+		if k < extra%len(gaps) {
+			n++
+		}
+		l[i].text += strings.Repeat(" ", n)
+	}
+	return l
+}
+
+// stripSoftHyphens removes the soft hyphens of a line
+func stripSoftHyphens(l line) line {
+	for i, s := range l {
+		if strings.ContainsRune(s.text, softHyphen) {
+			l[i].text = strings.ReplaceAll(s.text, string(softHyphen), "")
+		}
+	}
+	return l
+}
+
+// padRight pads the line with spaces to the given width
+func padRight(l line, width int) line {
+	if w := l.width(); w < width {
+		return append(l, span{text: strings.Repeat(" ", width-w)})
+	}
+	return l
+}
+
+// padCenter centers the line in the given width
+func padCenter(l line, width int) line {
+	w := l.width()
+	if w >= width {
+		return l
+	}
+	left := (width - w) / 2
+	centered := append(line{{text: strings.Repeat(" ", left)}}, l...)
+	return append(centered, span{text: strings.Repeat(" ", width-w-left)})
+}
@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandTabs(t *testing.T) {
+	tests := []struct {
+		spans []string
+		want  string
+	}{
+		{spans: []string{"\tx"}, want: "    x"},
+		{spans: []string{"ab\tc"}, want: "ab  c"},
+		{spans: []string{"abcd\te"}, want: "abcd    e"},
+		{spans: []string{"a", "b\t", "\tc"}, want: "ab      c"}, // Columns go on across spans
+		{spans: []string{"日本\tx"}, want: "日本    x"},             // Wide characters take two columns
+		{spans: []string{"日\tx"}, want: "日  x"},
+	}
+	for _, tt := range tests {
+		var l line
+		for _, text := range tt.spans {
+			l = append(l, span{text: text})
+		}
+		if got := expandTabs(l).text(); got != tt.want {
+			t.Errorf("expandTabs(%q) = %q, want %q", tt.spans, got, tt.want)
+		}
+	}
+}
+
+func TestPreformattedTabsFitTheWidth(t *testing.T) {
+	tests := []struct {
+		html string
+	}{
+		{html: "<pre>\tif x {\n\t\treturn aaaaaaaaaa\n\t}</pre>"},
+		{html: "<pre><code class=\"language-go\">\tif x {\n\t\treturn aaaaaaaaaa\n\t}</code></pre>"},
+		{html: "<p style=\"white-space: pre\">\t\treturn aaaaaaaaaa</p>"},
+	}
+	for _, tt := range tests {
+		p := NewHTMLParser()
+		p.SetWidth(12)
+		if err := p.Parse(tt.html, "", ""); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range p.GetPlainLines() {
+			if strings.ContainsRune(l, '\t') {
+				t.Errorf("%s: line %q holds a tab", tt.html, l)
+			}
+			if w := textWidth(l); w > 12 {
+				t.Errorf("%s: line %q is %d cells wide", tt.html, l, w)
+			}
+		}
+	}
+}
+
+func TestWrapLine(t *testing.T) {
+	tests := []struct {
+		text      string
+		width     int
+		hyphenate bool
+		want      []string
+		joints    []Joint
+	}{
+		{
+			text: "the quick brown fox jumps", width: 10,
+			want:   []string{"the quick", "brown fox", "jumps"},
+			joints: []Joint{JointLine, JointSpace, JointSpace},
+		},
+		{
+			text: "a won\u00adder\u00adful day", width: 8, // Soft hyphens
+			want:   []string{"a won-", "derful", "day"},
+			joints: []Joint{JointLine, JointWord, JointSpace},
+		},
+		{
+			text: "an extraordinary idea", width: 10, hyphenate: true,
+			want:   []string{"an extra-", "ordinary", "idea"},
+			joints: []Joint{JointLine, JointWord, JointSpace},
+		},
+		{
+			text: "an extraordinary idea", width: 10, // Words wider than a line are cut
+			want:   []string{"an", "extraordin", "ary idea"},
+			joints: []Joint{JointLine, JointSpace, JointWord},
+		},
+		{
+			text: "see /usr/local/bin now", width: 10, hyphenate: true, // Paths aren't hyphenated
+			want:   []string{"see", "/usr/local", "/bin now"},
+			joints: []Joint{JointLine, JointSpace, JointWord},
+		},
+		{
+			text: "日本語の文章です。", width: 6, // Not before the full stop
+			want:   []string{"日本語", "の文章", "です。"},
+			joints: []Joint{JointLine, JointWord, JointWord},
+		},
+	}
+	for _, tt := range tests {
+		var got []string
+		var joints []Joint
+		for _, l := range wrapLine(line{{text: tt.text}}, tt.width, tt.hyphenate) {
+			got = append(got, l.text())
+			joints = append(joints, textLine(l).Joint)
+		}
+		if !slices.Equal(got, tt.want) || !slices.Equal(joints, tt.joints) {
+			t.Errorf("wrapLine(%q, %d, %v) = %q %v, want %q %v",
+				tt.text, tt.width, tt.hyphenate, got, joints, tt.want, tt.joints)
+		}
+	}
+}
+
+func TestJustifyLine(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{text: "one two three four", width: 17, want: []string{"one   two   three", "four"}},
+		{text: "the quick brown fox jumps", width: 11, want: []string{"the   quick", "brown   fox", "jumps"}},
+		{text: "a b c d", width: 5, want: []string{"a b c", "d"}}, // Already full
+		{text: "a bb cc dddddd", width: 8, want: []string{"a  bb cc", "dddddd"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, l := range wrapLine(line{{text: tt.text}}, tt.width, false) {
+			justified := justifyLine(l, tt.width)
+			if text := textLine(justified); len(text.Ranges) > 0 {
+				// The spaces widening the line aren't in its text
+				var b strings.Builder
+				for _, r := range text.Ranges {
+					b.WriteString(justified.text()[r[0]:r[1]])
+				}
+				if want := strings.Join(strings.Fields(justified.text()), " "); b.String() != want {
+					t.Errorf("justifyLine(%q): text %q, want %q", justified.text(), b.String(), want)
+				}
+			}
+			got = append(got, justified.text())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("justifyLine(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.want)
+		}
+	}
+}
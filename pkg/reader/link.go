@@ -0,0 +1,134 @@
+package reader
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ray-d-song/goread/pkg/utils"
+)
+
+// linkMarkerRe matches the [→n] markers the parser puts after internal links
+var linkMarkerRe = regexp.MustCompile(`\[→(\d+)\]`)
+
+// position is a place in the book the history can return to
+type position struct {
+	Index int // Chapter index
+	Row   int // Scroll offset in the chapter
+}
+
+// currentPosition returns the position shown on the screen
+func (r *Reader) currentPosition() position {
+	row, _ := r.UI.TextArea.GetScrollOffset()
+	return position{Index: r.CurrentChapter, Row: row}
+}
+
+// goToPosition shows the chapter of the position scrolled to its row
+func (r *Reader) goToPosition(pos position) error {
+	if pos.Index != r.CurrentChapter {
+		if err := r.readChapter(pos.Index, 0); err != nil {
+			return err
+		}
+	}
+	r.UI.TextArea.ScrollTo(pos.Row, 0)
+	return nil
+}
+
+// pushHistory records the current position before a jump,
+// a new jump drops the positions we went back from
+func (r *Reader) pushHistory() {
+	r.BackHistory = append(r.BackHistory, r.currentPosition())
+	r.ForwardHistory = nil
+}
+
+// historyBack returns to the position before the last jump (Ctrl-O)
+func (r *Reader) historyBack() {
+	if len(r.BackHistory) == 0 {
+		r.UI.SetStatus("Already at the oldest position")
+		return
+	}
+	pos := r.BackHistory[len(r.BackHistory)-1]
+	r.BackHistory = r.BackHistory[:len(r.BackHistory)-1]
+	r.ForwardHistory = append(r.ForwardHistory, r.currentPosition())
+	if err := r.goToPosition(pos); err != nil {
+		r.UI.SetStatus(fmt.Sprintf("Error reading chapter: %v", err))
+	}
+}
+
+// historyForward goes to the position we came back from (Ctrl-I / Tab)
+func (r *Reader) historyForward() {
+	if len(r.ForwardHistory) == 0 {
+		r.UI.SetStatus("Already at the newest position")
+		return
+	}
+	pos := r.ForwardHistory[len(r.ForwardHistory)-1]
+	r.ForwardHistory = r.ForwardHistory[:len(r.ForwardHistory)-1]
+	r.BackHistory = append(r.BackHistory, r.currentPosition())
+	if err := r.goToPosition(pos); err != nil {
+		r.UI.SetStatus(fmt.Sprintf("Error reading chapter: %v", err))
+	}
+}
+
+// visibleLinks returns the numbers of the link markers shown on the screen
+func (r *Reader) visibleLinks() []int {
+	_, _, _, height := r.UI.TextArea.GetInnerRect()
+	row, _ := r.UI.TextArea.GetScrollOffset()
+	lines := strings.Split(r.UI.TextArea.GetText(true), "\n")
+
+	var links []int
+	for i := row; i < row+height && i < len(lines); i++ {
+		for _, match := range linkMarkerRe.FindAllStringSubmatch(lines[i], -1) {
+			n, err := strconv.Atoi(match[1])
+			if err == nil && n > 0 && n <= len(r.Links) {
+				links = append(links, n)
+			}
+		}
+	}
+	return links
+}
+
+// selectLink asks for the number of a link on the screen and follows it
+// With a single link on the screen, the link is followed right away
+func (r *Reader) selectLink() {
+	links := r.visibleLinks()
+	if len(links) == 0 {
+		r.UI.SetStatus("No links on the screen")
+		return
+	}
+	if len(links) == 1 {
+		r.followLink(links[0] - 1)
+		return
+	}
+
+	r.UI.ShowLinkSelect(links[0], links[len(links)-1], func(n int) {
+		if n == 0 {
+			r.UI.SetStatus("No link selected")
+			return
+		}
+		if n < 0 || n > len(r.Links) {
+			r.UI.SetStatus(fmt.Sprintf("Invalid link number: %d", n))
+			return
+		}
+		r.followLink(n - 1)
+	})
+}
+
+// followLink jumps to the target of the i-th link of the chapter, at the line of its anchor
+func (r *Reader) followLink(i int) {
+	link := r.Links[i]
+	path, fragment := r.Book.ResolveLink(r.CurrentChapter, link.Href)
+	index, line, err := r.Book.FindAnchor(path, fragment)
+	if err != nil {
+		utils.DebugLog("[ERROR:followLink] Error finding link target %s: %v", link.Href, err)
+		r.UI.SetStatus(fmt.Sprintf("Link target not found: %s", link.Href))
+		return
+	}
+
+	r.pushHistory()
+	if err := r.goToPosition(position{Index: index, Row: line}); err != nil {
+		r.UI.SetStatus(fmt.Sprintf("Error reading chapter: %v", err))
+		return
+	}
+	r.UI.SetStatus(fmt.Sprintf("Followed link: %s (C-o to go back)", link.Text))
+}
@@ -2,7 +2,6 @@ package reader
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 
 	"github.com/gdamore/tcell/v2"
@@ -97,92 +96,83 @@ func (r *Reader) jumpToPosition(index int, pos int, pctg float64) {
 func (r *Reader) nextChapter(pos int, pctg float64) {
 	utils.DebugLog("[INFO:nextChapter] Moving to next chapter from index: %d", r.CurrentChapter)
 
-	// Save current chapter state before moving to next chapter
-	row, _ := r.UI.TextArea.GetScrollOffset()
-	text := r.UI.TextArea.GetText(false)
-	lines := strings.Split(text, "\n")
-	currentPctg := float64(0)
-	if len(lines) > 0 {
-		currentPctg = float64(row) / float64(len(lines))
-	}
-	r.saveState(r.CurrentChapter, r.UI.Width, row, currentPctg)
+	r.saveCurrentState()
 
-	r.CurrentChapter++
-	err := r.readChapter(r.CurrentChapter, 0) // Start at the beginning of the new chapter
+	next := r.linearChapter(r.CurrentChapter, 1)
+	if next < 0 {
+		r.UI.SetStatus("Already at the last chapter")
+		return
+	}
+	err := r.readChapter(next, 0) // Start at the beginning of the new chapter
 	if err != nil {
 		r.UI.StatusBar.SetText(fmt.Sprintf("Error reading chapter: %v", err))
 	}
-	// If there's an active search pattern, try to find the first occurrence in the new chapter
-	if r.UI.SearchPattern != "" {
-		re, err := regexp.Compile(r.UI.SearchPattern)
-		if err == nil {
-			// Find the first occurrence in the new chapter
-			text := r.UI.TextArea.GetText(false)
-			lines := strings.Split(text, "\n")
-			foundIndex := -1
-
-			for i, line := range lines {
-				if re.MatchString(line) {
-					foundIndex = i
-					break
-				}
-			}
+}
 
-			if foundIndex >= 0 {
-				// Highlight all results with the first one focused
-				r.highlightSearchResults(re, foundIndex)
-				// Scroll to the first occurrence
-				r.UI.TextArea.ScrollTo(foundIndex, 0)
-				r.UI.SetStatus(fmt.Sprintf("Found: %s", lines[foundIndex]))
-			}
+// linearChapter returns the index of the next chapter in the given direction (1 or -1)
+// Non-linear chapters are skipped, returns -1 if there is none
+func (r *Reader) linearChapter(from int, step int) int {
+	for i := from + step; i >= 0 && i < r.Book.TOC.Len(); i += step {
+		if !r.Book.TOC.Slice[i].IsNonLinear {
+			return i
 		}
 	}
-
+	return -1
 }
 
 // prevChapter moves to the previous chapter
 func (r *Reader) prevChapter(pos int, pctg float64) {
 	utils.DebugLog("[INFO:prevChapter] Moving to previous chapter from index: %d", r.CurrentChapter)
 
-	// Save current chapter state before moving to previous chapter
-	row, _ := r.UI.TextArea.GetScrollOffset()
-	text := r.UI.TextArea.GetText(false)
-	lines := strings.Split(text, "\n")
-	currentPctg := float64(0)
-	if len(lines) > 0 {
-		currentPctg = float64(row) / float64(len(lines))
-	}
-	r.saveState(r.CurrentChapter, r.UI.Width, row, currentPctg)
+	r.saveCurrentState()
 
-	r.CurrentChapter--
-	err := r.readChapter(r.CurrentChapter, 0) // Start at the beginning of the new chapter
+	prev := r.linearChapter(r.CurrentChapter, -1)
+	if prev < 0 {
+		r.UI.SetStatus("Already at the first chapter")
+		return
+	}
+	err := r.readChapter(prev, 0) // Start at the beginning of the new chapter
 	if err != nil {
 		r.UI.StatusBar.SetText(fmt.Sprintf("Error reading chapter: %v", err))
 	}
+}
 
-	// If there's an active search pattern, try to find the first occurrence in the new chapter
-	if r.UI.SearchPattern != "" {
-		re, err := regexp.Compile(r.UI.SearchPattern)
-		if err == nil {
-			// Find the first occurrence in the new chapter
-			text := r.UI.TextArea.GetText(false)
-			lines := strings.Split(text, "\n")
-			foundIndex := -1
-
-			for i, line := range lines {
-				if re.MatchString(line) {
-					foundIndex = i
-					break
-				}
-			}
+// jumpToTarget opens the chapter holding the given file and fragment
+func (r *Reader) jumpToTarget(path string, fragment string) error {
+	index, line, err := r.Book.FindAnchor(path, fragment)
+	if err != nil {
+		return err
+	}
+
+	r.saveCurrentState()
+	r.pushHistory()
+	return r.goToPosition(position{Index: index, Row: line})
+}
+
+// goToPage asks for a page number of the print edition and jumps to it
+func (r *Reader) goToPage() {
+	if len(r.Book.PageList) == 0 {
+		r.UI.SetStatus("This book has no page list")
+		return
+	}
 
-			if foundIndex >= 0 {
-				// Highlight all results with the first one focused
-				r.highlightSearchResults(re, foundIndex)
-				// Scroll to the first occurrence
-				r.UI.TextArea.ScrollTo(foundIndex, 0)
-				r.UI.SetStatus(fmt.Sprintf("Found: %s", lines[foundIndex]))
+	first := r.Book.PageList[0].Label
+	last := r.Book.PageList[len(r.Book.PageList)-1].Label
+	r.UI.ShowPageSelect(first, last, func(label string) {
+		if label == "" {
+			return
+		}
+
+		for _, page := range r.Book.PageList {
+			if strings.EqualFold(page.Label, label) {
+				if err := r.jumpToTarget(page.Path, page.Fragment); err != nil {
+					r.UI.SetStatus(fmt.Sprintf("Error jumping to page %s: %v", label, err))
+				} else {
+					r.UI.SetStatus(fmt.Sprintf("Page %s", page.Label))
+				}
+				return
 			}
 		}
-	}
+		r.UI.SetStatus(fmt.Sprintf("Page not found: %s", label))
+	})
 }
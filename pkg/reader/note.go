@@ -0,0 +1,146 @@
+package reader
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/ray-d-song/goread/pkg/parser"
+	"github.com/ray-d-song/goread/pkg/ui"
+	"github.com/ray-d-song/goread/pkg/utils"
+	"github.com/rivo/tview"
+)
+
+// noteMarkerRe matches the [^n] markers the parser puts in place of note references
+var noteMarkerRe = regexp.MustCompile(`\[\^(\d+)\]`)
+
+// visibleNotes returns the indexes of the note references shown on the screen
+func (r *Reader) visibleNotes() []int {
+	_, _, _, height := r.UI.TextArea.GetInnerRect()
+	row, _ := r.UI.TextArea.GetScrollOffset()
+	lines := strings.Split(r.UI.TextArea.GetText(true), "\n")
+
+	var notes []int
+	for i := row; i < row+height && i < len(lines); i++ {
+		for _, match := range noteMarkerRe.FindAllStringSubmatch(lines[i], -1) {
+			n, err := strconv.Atoi(match[1])
+			if err == nil && n > 0 && n <= len(r.NoteRefs) {
+				notes = append(notes, n-1)
+			}
+		}
+	}
+	return notes
+}
+
+// showNotes lets the user choose among the notes referenced on the screen
+// With a single note on the screen, the note is shown right away
+func (r *Reader) showNotes() {
+	if len(r.NoteRefs) == 0 {
+		r.UI.SetStatus("No notes found in this chapter")
+		return
+	}
+
+	notes := r.visibleNotes()
+	if len(notes) == 0 {
+		// If no notes in visible area, show all notes
+		for i := range r.NoteRefs {
+			notes = append(notes, i)
+		}
+	}
+	if len(notes) == 1 {
+		r.showNote(notes[0])
+		return
+	}
+
+	list := tview.NewList().
+		ShowSecondaryText(true).
+		SetHighlightFullLine(true)
+	switch r.UI.ColorScheme {
+	case ui.DefaultColorScheme:
+		list.SetBackgroundColor(tcell.ColorDefault)
+		list.SetMainTextColor(tcell.ColorDefault)
+		list.SetSecondaryTextColor(tcell.ColorDarkCyan)
+		list.SetSelectedBackgroundColor(tcell.ColorDarkCyan)
+	case ui.DarkColorScheme:
+		list.SetBackgroundColor(tcell.ColorDarkSlateGray)
+		list.SetMainTextColor(tcell.ColorWhite)
+		list.SetSecondaryTextColor(tcell.ColorLightGray)
+		list.SetSelectedBackgroundColor(tcell.ColorDarkBlue)
+	case ui.LightColorScheme:
+		list.SetBackgroundColor(tcell.ColorWhite)
+		list.SetMainTextColor(tcell.ColorBlack)
+		list.SetSecondaryTextColor(tcell.ColorDarkBlue)
+		list.SetSelectedBackgroundColor(tcell.ColorLightBlue)
+	}
+
+	for _, i := range notes {
+		// Preview the beginning of the note, the whole note is shown once selected
+		preview := ""
+		if lines, err := r.Book.GetNote(r.CurrentChapter, r.NoteRefs[i].Href); err == nil {
+			preview = parser.StripTags(strings.Join(lines, " "))
+		}
+		list.AddItem(tview.Escape(noteTitle(i, r.NoteRefs[i].Label)), tview.Escape(preview), 0, nil)
+	}
+
+	var resetCapture func()
+	resetContent := r.UI.SetTempContent(list)
+	r.UI.App.SetFocus(list)
+
+	list.SetSelectedFunc(func(i int, _ string, _ string, _ rune) {
+		resetCapture()
+		resetContent()
+		r.showNote(notes[i])
+	})
+
+	resetCapture = r.UI.SetCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			resetCapture()
+			resetContent()
+			return nil
+		case tcell.KeyEnter, tcell.KeyUp, tcell.KeyDown, tcell.KeyHome, tcell.KeyEnd, tcell.KeyPgUp, tcell.KeyPgDn:
+			return event
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'q':
+				resetCapture()
+				resetContent()
+				return nil
+			case 'j':
+				return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+			case 'k':
+				return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+			}
+		}
+		return nil
+	})
+}
+
+// showNote shows the i-th note referenced in the current chapter
+func (r *Reader) showNote(i int) {
+	noteRef := r.NoteRefs[i]
+	lines, err := r.Book.GetNote(r.CurrentChapter, noteRef.Href)
+	if err != nil {
+		utils.DebugLog("[ERROR:showNote] Error getting note %s: %v", noteRef.Href, err)
+		r.UI.SetStatus(fmt.Sprintf("Error getting note: %v", err))
+		return
+	}
+	r.UI.ShowNote(noteTitle(i, noteRef.Label), lines, func() {
+		// Read the note where it lives, C-o comes back to the reference
+		path, fragment := r.Book.ResolveLink(r.CurrentChapter, noteRef.Href)
+		if err := r.jumpToTarget(path, fragment); err != nil {
+			r.UI.SetStatus(fmt.Sprintf("Error jumping to note: %v", err))
+		}
+	})
+}
+
+// noteTitle returns the title of a note, with the label used in the book if it differs from the marker
+func noteTitle(i int, label string) string {
+	marker := fmt.Sprintf("[^%d]", i+1)
+	if label == "" || label == strconv.Itoa(i+1) {
+		return "Note " + marker
+	}
+	return fmt.Sprintf("Note %s (%s)", marker, label)
+}
@@ -25,6 +25,22 @@ type Reader struct {
 	UI             *ui.UI
 	JumpList       map[rune][4]interface{} // [index, width, pos, pctg]
 	CurrentChapter int                     // Current chapter index
+	Text           string                  // Text of the current chapter, styled with tview tags
+	Plain          []string                // Lines of the current chapter without styles
+	TextLines      []parser.TextLine       // Text of the chapter held by each line of Plain, for searching it
+	Bidi           map[int]parser.BidiLine // Lines of Text in visual order for right-to-left text, by index
+	Positions      []int                   // Position in the text of each line of Text, see parser.Rendered
+	FirstOpen      bool                    // The book is opened for the first time, show its cover
+	NoteRefs       []parser.NoteRef        // Note references in the current chapter
+	Links          []parser.Link           // Internal links in the current chapter
+	BackHistory    []position              // Positions before the jumps, for C-o
+	ForwardHistory []position              // Positions we went back from, for C-i
+	Ruby           parser.RubyMode         // How the ruby annotations are shown
+	Justify        bool                    // Justify the left-aligned paragraphs
+	Hyphenate      bool                    // Hyphenate the words of the languages with a dictionary
+	InlineImages   bool                    // Draw the images in the text instead of their markers
+	SearchResults  []searchResult          // Matches of the search pattern in the book, nil before searching
+	SearchCurrent  int                     // Index of the search result shown, -1 without one
 
 	// Cache fields
 	TempDir string // Temporary directory for image files
@@ -43,15 +59,18 @@ func NewReader(book *epub.Epub, cfg *config.Config, filePath string) *Reader {
 		utils.DebugLog("[INFO:NewReader] Created temp directory: %s", tempDir)
 	}
 
-	return &Reader{
+	reader := &Reader{
 		Book:           book,
 		Config:         cfg,
 		FilePath:       filePath,
 		UI:             ui.NewUI(),
 		JumpList:       make(map[rune][4]interface{}),
 		CurrentChapter: 0,
+		SearchCurrent:  -1,
 		TempDir:        tempDir,
 	}
+	reader.UI.ReadImage = book.ReadImage
+	return reader
 }
 
 var InitialCapture func(event *tcell.EventKey) *tcell.EventKey
@@ -70,32 +89,31 @@ func (r *Reader) Run(index int, width int, pos int, pctg float64) {
 	}
 
 	r.UI.ReadChapter = r.readChapter
-	// First load the regular chapter
+	r.UI.Resized = r.fitWidth
+	// First load the regular chapter, the position in the text doesn't change with the width
+	// unlike the percentage, which is only left for the states saved without it
+	if pos > 0 {
+		pctg = 0
+	}
 	err := r.readChapter(index, pctg)
 	if err != nil {
 		utils.DebugLog("[ERROR:Run] Error reading chapter: %v", err)
 		r.UI.StatusBar.SetText(fmt.Sprintf("Error reading chapter: %v", err))
+	} else if pos > 0 {
+		r.UI.TextArea.ScrollTo(parser.PositionLine(r.Positions, pos), 0)
 	}
-
 	// Set up the key handling
 	ic := r.UI.App.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Key() {
 		case tcell.KeyEscape, tcell.KeyCtrlC:
 			if r.UI.SearchPattern != "" {
 				r.UI.SearchPattern = ""
+				r.SearchResults = nil
 				r.clearSearchHighlights()
 				return nil
 			} else {
 				// Only exit if not in search mode
-				// Get current position
-				row, _ := r.UI.TextArea.GetScrollOffset()
-				text := r.UI.TextArea.GetText(false)
-				lines := strings.Split(text, "\n")
-				currentPctg := float64(0)
-				if len(lines) > 0 {
-					currentPctg = float64(row) / float64(len(lines))
-				}
-				r.saveState(r.CurrentChapter, r.UI.Width, row, currentPctg)
+				r.saveCurrentState()
 				r.UI.App.Stop()
 				return nil
 			}
@@ -104,18 +122,11 @@ func (r *Reader) Run(index int, width int, pos int, pctg float64) {
 			case 'q':
 				if r.UI.SearchPattern != "" {
 					r.UI.SearchPattern = ""
+					r.SearchResults = nil
 					r.clearSearchHighlights()
 					return nil
 				}
-				// Get current position
-				row, _ := r.UI.TextArea.GetScrollOffset()
-				text := r.UI.TextArea.GetText(false)
-				lines := strings.Split(text, "\n")
-				currentPctg := float64(0)
-				if len(lines) > 0 {
-					currentPctg = float64(row) / float64(len(lines))
-				}
-				r.saveState(r.CurrentChapter, r.UI.Width, row, currentPctg)
+				r.saveCurrentState()
 				r.UI.App.Stop()
 				return nil
 			case '?':
@@ -124,10 +135,28 @@ func (r *Reader) Run(index int, width int, pos int, pctg float64) {
 			case 'm':
 				r.showMetadata()
 				return nil
+			case 'R':
+				r.showRenditions()
+				return nil
+			case 'v':
+				r.showCover()
+				return nil
 			// NEED FIX: not work in some books
-			case 't', '\t':
+			case 't':
 				r.showTOC(r.CurrentChapter)
 				return nil
+			case 'L':
+				r.showLandmarks()
+				return nil
+			case 'p':
+				r.goToPage()
+				return nil
+			case 'F':
+				r.showNotes()
+				return nil
+			case 'f':
+				r.selectLink()
+				return nil
 			case '/':
 				r.search()
 				return nil
@@ -173,6 +202,32 @@ func (r *Reader) Run(index int, width int, pos int, pctg float64) {
 				return nil
 			case 'c':
 				r.UI.CycleColorScheme()
+				// Code is highlighted with the colors of the scheme
+				r.relayout()
+				return nil
+			case 'r':
+				r.Ruby = (r.Ruby + 1) % 3
+				r.relayout()
+				r.UI.SetStatus(fmt.Sprintf("Ruby: %s", r.Ruby))
+				return nil
+			case 'J':
+				r.Justify = !r.Justify
+				r.relayout()
+				r.UI.SetStatus(fmt.Sprintf("Justify: %s", onOff(r.Justify)))
+				return nil
+			case 'H':
+				r.Hyphenate = !r.Hyphenate
+				r.relayout()
+				r.UI.SetStatus(fmt.Sprintf("Hyphenation: %s", onOff(r.Hyphenate)))
+				return nil
+			case 'i':
+				r.InlineImages = !r.InlineImages
+				r.relayout()
+				if r.InlineImages {
+					r.UI.SetStatus(fmt.Sprintf("Inline images: on (%s)", r.UI.ImageProtocol))
+				} else {
+					r.UI.SetStatus("Inline images: off")
+				}
 				return nil
 			case 'C':
 				r.UI.SetStatus("All caches cleared")
@@ -191,12 +246,27 @@ func (r *Reader) Run(index int, width int, pos int, pctg float64) {
 		case tcell.KeyUp:
 			r.scrollUp()
 			return nil
-		case tcell.KeyPgDn, tcell.KeyRight:
+		case tcell.KeyPgDn:
 			r.pageDown(pos)
 			return nil
-		case tcell.KeyPgUp, tcell.KeyLeft:
+		case tcell.KeyPgUp:
 			r.pageUp(pos)
 			return nil
+		case tcell.KeyRight:
+			// Pages of right-to-left books progress to the left
+			if r.Book.IsRTL() {
+				r.pageUp(pos)
+			} else {
+				r.pageDown(pos)
+			}
+			return nil
+		case tcell.KeyLeft:
+			if r.Book.IsRTL() {
+				r.pageDown(pos)
+			} else {
+				r.pageUp(pos)
+			}
+			return nil
 		case tcell.KeyHome:
 			r.goToStart()
 			return nil
@@ -209,12 +279,24 @@ func (r *Reader) Run(index int, width int, pos int, pctg float64) {
 		case tcell.KeyCtrlD:
 			r.halfPageDown(pos)
 			return nil
+		case tcell.KeyCtrlO:
+			r.historyBack()
+			return nil
+		case tcell.KeyTab:
+			// Terminals send Tab for C-i
+			r.historyForward()
+			return nil
 		}
 		return event
 	})
 
 	InitialCapture = ic.GetInputCapture()
 
+	// The cover is shown over the first chapter on the first open of the book
+	if r.FirstOpen && r.Book.HasCover() {
+		r.showCover()
+	}
+
 	// Run the application
 	if err := r.UI.App.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error running application: %v\n", err)
@@ -231,6 +313,16 @@ func (r *Reader) readChapter(index int, pctg float64) error {
 	}
 
 	r.CurrentChapter = index
+	// The text is wrapped to the width of the text area
+	r.Book.Width = r.UI.TextWidth()
+	r.Book.CodeColors = r.UI.CodeColors()
+	r.Book.Ruby = r.Ruby
+	r.Book.Justify = r.Justify
+	r.Book.Hyphenate = r.Hyphenate
+	r.Book.ImageSize = nil
+	if r.InlineImages {
+		r.Book.ImageSize = r.UI.ImageSize
+	}
 	r.UI.StatusBar.SetText(fmt.Sprintf("Reading chapter %d of %d", index+1, r.Book.TOC.Len()))
 
 	// Step 1: Get HTML content (from cache if available)
@@ -244,31 +336,30 @@ func (r *Reader) readChapter(index int, pctg float64) error {
 
 	// Store the images for later use
 	r.UI.Images = chapterContent.Images
+	r.UI.ImagePaths = make([]string, len(chapterContent.Images))
+	for i, image := range chapterContent.Images {
+		r.UI.ImagePaths[i] = epub.ImagePath(r.Book.TOC.Slice[index].Path, image.Src)
+	}
+	r.UI.ImageBoxes = chapterContent.Boxes
+	r.NoteRefs = chapterContent.NoteRefs
+	r.Links = chapterContent.Links
 
 	// Clear the text area and write the formatted lines
+	r.Text = chapterContent.Text
+	r.Plain = chapterContent.Plain
+	r.TextLines = chapterContent.TextLines
+	r.Bidi = chapterContent.Bidi
+	r.Positions = chapterContent.Positions
 	r.UI.TextArea.Clear()
 	fmt.Fprintln(r.UI.TextArea, chapterContent.Text)
 
 	// If there's an active search pattern, highlight the results
 	if r.UI.SearchPattern != "" {
-		re, err := regexp.Compile(r.UI.SearchPattern)
+		re, err := r.UI.CompileSearch()
 		if err == nil {
-			// Find the first occurrence to highlight it differently
-			foundIndex := -1
-			for i, line := range chapterContent.Lines {
-				if re.MatchString(line) {
-					foundIndex = i
-					break
-				}
-			}
-
-			if foundIndex >= 0 {
-				r.highlightSearchResults(re, foundIndex)
-				// Don't automatically scroll to it here, as we want to respect the pctg parameter
-			} else {
-				// If no matches found, just highlight all (none will be focused)
-				r.highlightSearchResults(re, -1)
-			}
+			// The first match is highlighted differently
+			// Don' automatically scroll to it here, as we want to respect the pctg parameter
+			r.highlightSearchResults(r.chapterMatches(re), 0)
 		} else {
 			// If the pattern is invalid, clear it
 			r.UI.SearchPattern = ""
@@ -290,15 +381,39 @@ func (r *Reader) readChapter(index int, pctg float64) error {
 	return nil
 }
 
-// saveState saves the reading state
+// saveCurrentState saves the reading state at the position shown on the screen
+func (r *Reader) saveCurrentState() {
+	row, _ := r.UI.TextArea.GetScrollOffset()
+	lines := strings.Split(r.UI.TextArea.GetText(false), "\n")
+	pctg := float64(0)
+	if len(lines) > 0 {
+		pctg = float64(row) / float64(len(lines))
+	}
+	r.saveState(r.CurrentChapter, r.UI.Width, row, pctg)
+}
+
+// saveState saves the reading state, pos is the row at the top of the screen
 func (r *Reader) saveState(index int, width int, pos int, pctg float64) {
+	position := 0
+	if index == r.CurrentChapter && pos >= 0 && pos < len(r.Positions) {
+		position = r.Positions[pos]
+	}
 	state := config.State{
 		Index:       index,
 		Width:       width,
 		Pos:         pos,
 		Pctg:        pctg,
+		Position:    position,
 		LastRead:    true,
 		ColorScheme: r.UI.ColorScheme,
+		Ruby:        r.Ruby,
+		Justify:     r.Justify,
+		Hyphenate:   r.Hyphenate,
+		Images:      r.InlineImages,
+	}
+	// Only multiple-rendition books need to remember the rendition
+	if len(r.Book.Renditions) > 1 {
+		state.Rendition = r.Book.Renditions[r.Book.Rendition].FullPath
 	}
 	r.Config.SetState(r.FilePath, state)
 	r.Config.Save()
@@ -340,9 +455,10 @@ func (r *Reader) openImage() {
 		return
 	}
 
-	// Use the ShowImageSelect function to let the user select an image by number
-	r.UI.ShowImageSelect(r.UI.Images, func(imagePath string) {
-		if imagePath == "" {
+	// Use the ShowImageSelect function to let the user select an image by number,
+	// it's shown in the image viewer with the other images of the book
+	r.UI.ShowImageSelect(r.UI.Images, func(number int) {
+		if number < 0 {
 			r.UI.SetStatus("No image selected")
 			return
 		}
@@ -352,25 +468,51 @@ func (r *Reader) openImage() {
 			r.UI.SetStatus(fmt.Sprintf("Invalid chapter index: %d", index))
 			return
 		}
-
 		chapterPath := r.Book.TOC.Slice[index].Path
-		chapterDir := filepath.Dir(chapterPath)
-		resolvedPath := filepath.Join(chapterDir, imagePath)
-
-		// Extract the image to a temporary file
-		tempFile, err := extractImage(r.Book, resolvedPath, r.TempDir)
-		if err != nil {
-			r.UI.SetStatus(fmt.Sprintf("Error extracting image: %v", err))
-			return
+		resolvedPath := epub.ImagePath(chapterPath, r.UI.Images[number].Src)
+
+		var images []ui.ViewerImage
+		current := -1
+		for i, image := range r.Book.GetBookImages() {
+			images = append(images, ui.ViewerImage{
+				Path:    image.Path,
+				Chapter: r.Book.TOC.Slice[image.Chapter].Title,
+				Image:   image.Image,
+			})
+			if image.Path != resolvedPath {
+				continue
+			}
+			// The image of the chapter, or the first one with the same path
+			if r.Book.TOC.Slice[image.Chapter].Path == chapterPath && image.Index == number {
+				current = i
+			} else if current < 0 {
+				current = i
+			}
 		}
-
-		// Open the image using the system's default image viewer
-		err = r.UI.OpenImage(tempFile)
-		if err != nil {
-			utils.DebugLog("[ERROR:openImage] Error opening image: %v", err)
-			r.UI.SetStatus(fmt.Sprintf("Error opening image: %v", err))
-			return
+		if current < 0 {
+			images = append(images, ui.ViewerImage{
+				Path:    resolvedPath,
+				Chapter: r.Book.TOC.Slice[index].Title,
+				Image:   r.UI.Images[number],
+			})
+			current = len(images) - 1
 		}
+
+		r.UI.ShowImageViewer(images, current, func(path string) {
+			// Extract the image to a temporary file
+			tempFile, err := extractImage(r.Book, path, r.TempDir)
+			if err != nil {
+				r.UI.SetStatus(fmt.Sprintf("Error extracting image: %v", err))
+				return
+			}
+
+			// Open the image using the system's default image viewer
+			err = r.UI.OpenImage(tempFile)
+			if err != nil {
+				utils.DebugLog("[ERROR:openImage] Error opening image: %v", err)
+				r.UI.SetStatus(fmt.Sprintf("Error opening image: %v", err))
+			}
+		})
 	})
 }
 
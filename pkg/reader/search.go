@@ -1,206 +1,373 @@
 package reader
 
 import (
+	"errors"
 	"fmt"
-	"regexp"
+	"regexp/syntax"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/ray-d-song/goread/pkg/parser"
+	"github.com/ray-d-song/goread/pkg/ui"
+	"github.com/ray-d-song/goread/pkg/utils"
+	"github.com/rivo/tview"
+)
+
+// Characters of a paragraph shown before a match in the search results, and at most after it:
+// a match is found in the text of its whole paragraph
+const (
+	contextWidth = 30
+	contextAfter = 120
 )
 
-// search searches for a pattern
+// searchResult is a match of the search pattern in the book
+type searchResult struct {
+	Chapter int    // Index of the chapter holding it
+	Match   int    // Number of the match in the chapter, the line may change with the layout
+	Line    int    // Line of the match when the book was searched
+	Context string // Text around the match, with the match highlighted
+}
+
+// search searches the whole book for a pattern and shows the results
 func (r *Reader) search() {
 	r.UI.ShowSearch(func() {
-		// When search is completed, highlight all occurrences and find the first one
-		if r.UI.SearchPattern != "" {
-			re, err := regexp.Compile(r.UI.SearchPattern)
-			if err == nil {
-				// First find the first occurrence to get its index
-				text := r.UI.TextArea.GetText(false)
-				lines := strings.Split(text, "\n")
-				foundIndex := -1
-
-				for i, line := range lines {
-					if re.MatchString(line) {
-						foundIndex = i
-						break
-					}
-				}
-
-				if foundIndex >= 0 {
-					// Highlight all results with the first one focused
-					r.highlightSearchResults(re, foundIndex)
-					// Scroll to the first occurrence
-					r.UI.TextArea.ScrollTo(foundIndex, 0)
-					r.UI.SetStatus(fmt.Sprintf("Found: %s", lines[foundIndex]))
-				} else {
-					r.UI.StatusBar.Clear()
-					fmt.Fprintf(r.UI.StatusBar, "[red]Pattern not found:[white] %s", r.UI.SearchPattern)
-				}
-			}
+		r.SearchResults = nil
+		r.SearchCurrent = -1
+		if r.UI.SearchPattern == "" {
+			return
 		}
+		re, err := r.UI.CompileSearch()
+		if err != nil {
+			r.invalidSearchPattern(err)
+			return
+		}
+
+		r.SearchResults = r.searchBook(re)
+		if len(r.SearchResults) == 0 {
+			r.highlightSearchResults(r.chapterMatches(re), -1)
+			r.UI.StatusBar.Clear()
+			fmt.Fprintf(r.UI.StatusBar, "[red]Pattern not found:[white] %s (%s)", tview.Escape(r.UI.SearchPattern), r.searchModeText())
+			return
+		}
+		r.showSearchResults(re)
 	})
 }
 
-// searchNext searches for the next occurrence of the search pattern
-func (r *Reader) searchNext() {
-	if r.UI.SearchPattern == "" {
-		return
+// searchModeText describes how the search pattern matches the text: "regex, smart case"...
+func (r *Reader) searchModeText() string {
+	return ui.SearchModeText(r.UI.SearchPattern, r.UI.SearchMode)
+}
+
+// invalidSearchPattern shows why the search pattern isn't a regular expression
+func (r *Reader) invalidSearchPattern(err error) {
+	reason := err.Error()
+	var syntaxErr *syntax.Error
+	if errors.As(err, &syntaxErr) {
+		reason = fmt.Sprintf("%s `%s`", syntaxErr.Code, syntaxErr.Expr)
 	}
+	r.UI.StatusBar.Clear()
+	fmt.Fprintf(r.UI.StatusBar, "[red]Invalid pattern:[white] %s (Ctrl-L: literal)", tview.Escape(reason))
+}
 
-	text := r.UI.TextArea.GetText(false)
-	re, err := regexp.Compile(r.UI.SearchPattern)
-	if err != nil {
-		r.UI.SetStatus(fmt.Sprintf("Invalid search pattern: %v", err))
-		return
+// searchBook returns the matches of a pattern in the chapters of the book, in reading order
+func (r *Reader) searchBook(re *ui.SearchMatcher) []searchResult {
+	var results []searchResult
+	for index, tocValue := range r.Book.TOC.Slice {
+		// A part starting where its first chapter starts holds the same text
+		if index+1 < r.Book.TOC.Len() {
+			next := r.Book.TOC.Slice[index+1]
+			if next.Path == tocValue.Path && next.Fragment == tocValue.Fragment {
+				continue
+			}
+		}
+		content, err := r.Book.GetChapterContents(index)
+		if err != nil {
+			utils.DebugLog("[WARN:searchBook] Can't read chapter %d: %v", index, err)
+			continue
+		}
+		for match, m := range parser.FindText(content.Plain, content.TextLines, re) {
+			results = append(results, searchResult{
+				Chapter: index,
+				Match:   match,
+				Line:    m.Line,
+				Context: matchContext(m.Text, m.Start, m.End),
+			})
+		}
 	}
+	utils.DebugLog("[INFO:searchBook] %d matches of %s", len(results), re.String())
+	return results
+}
 
-	// Get the current position
-	row, _ := r.UI.TextArea.GetScrollOffset()
-	pos := row
+// chapterMatches returns the matches of a pattern in the text of the current chapter,
+// a match may go across the lines a paragraph is wrapped in
+func (r *Reader) chapterMatches(re *ui.SearchMatcher) []parser.TextMatch {
+	return parser.FindText(r.Plain, r.TextLines, re)
+}
 
-	lines := strings.Split(text, "\n")
-	found := false
-	foundIndex := -1
+// matchContext returns the text around a match of a paragraph, with the match highlighted
+func matchContext(text string, start int, end int) string {
+	before, after := text[:start], text[end:]
+	if utf8.RuneCountInString(before) > contextWidth {
+		runes := []rune(before)
+		before = "…" + strings.TrimLeft(string(runes[len(runes)-contextWidth:]), " ")
+	} else {
+		before = strings.TrimLeft(before, " ")
+	}
+	if runes := []rune(after); len(runes) > contextAfter {
+		after = strings.TrimRight(string(runes[:contextAfter]), " ") + "…"
+	}
+	return tview.Escape(before) + "[::r]" + tview.Escape(text[start:end]) + "[::-]" + tview.Escape(after)
+}
 
-	for i := pos + 1; i < len(lines); i++ {
-		if re.MatchString(lines[i]) {
-			foundIndex = i
-			found = true
-			break
-		}
+// showSearchResults shows the matches of the search in a list, the selected one is shown in the book
+func (r *Reader) showSearchResults(re *ui.SearchMatcher) {
+	// Matches per chapter
+	counts := make(map[int]int)
+	for _, result := range r.SearchResults {
+		counts[result.Chapter]++
 	}
 
-	// If we get here and didn't find anything, wrap around
-	if !found {
-		for i := 0; i <= pos; i++ {
-			if re.MatchString(lines[i]) {
-				foundIndex = i
-				found = true
-				break
-			}
-		}
+	list := tview.NewList().
+		ShowSecondaryText(true).
+		SetHighlightFullLine(true)
+	header := tview.NewTextView().SetDynamicColors(true)
+	switch r.UI.ColorScheme {
+	case ui.DefaultColorScheme:
+		list.SetBackgroundColor(tcell.ColorDefault)
+		list.SetMainTextColor(tcell.ColorDefault)
+		list.SetSecondaryTextColor(tcell.ColorDarkCyan)
+		list.SetSelectedBackgroundColor(tcell.ColorDarkCyan)
+		header.SetBackgroundColor(tcell.ColorDefault)
+		header.SetTextColor(tcell.ColorDefault)
+	case ui.DarkColorScheme:
+		list.SetBackgroundColor(tcell.ColorDarkSlateGray)
+		list.SetMainTextColor(tcell.ColorWhite)
+		list.SetSecondaryTextColor(tcell.ColorLightGray)
+		list.SetSelectedBackgroundColor(tcell.ColorDarkBlue)
+		header.SetBackgroundColor(tcell.ColorDarkSlateGray)
+		header.SetTextColor(tcell.ColorWhite)
+	case ui.LightColorScheme:
+		list.SetBackgroundColor(tcell.ColorWhite)
+		list.SetMainTextColor(tcell.ColorBlack)
+		list.SetSecondaryTextColor(tcell.ColorDarkBlue)
+		list.SetSelectedBackgroundColor(tcell.ColorLightBlue)
+		header.SetBackgroundColor(tcell.ColorWhite)
+		header.SetTextColor(tcell.ColorBlack)
 	}
+	header.SetText(fmt.Sprintf("[::b]%s[::-] in %s for /%s/ (%s) [::d](Enter: go, Esc: close)[::-]",
+		plural(len(r.SearchResults), "match", "matches"), plural(len(counts), "chapter", "chapters"),
+		tview.Escape(r.UI.SearchPattern), r.searchModeText()))
 
-	if found {
-		// Highlight the search results in the entire text with the current focused one highlighted differently
-		r.highlightSearchResults(re, foundIndex)
+	for _, result := range r.SearchResults {
+		list.AddItem(result.Context, tview.Escape(fmt.Sprintf("%s · %s",
+			r.chapterTitle(result.Chapter), plural(counts[result.Chapter], "match", "matches"))), 0, nil)
+	}
+	// The first match after the position shown is selected
+	first, _ := r.nextSearchResult(re, 1)
+	list.SetCurrentItem(first)
 
-		// Scroll to the found occurrence
-		r.UI.TextArea.ScrollTo(foundIndex, 0)
+	view := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(header, 1, 0, false).
+		AddItem(list, 0, 1, true)
+	var resetCapture func()
+	resetContent := r.UI.SetTempContent(view)
+	// The results are as wide as the text
+	r.UI.Horizontal.ResizeItem(view, r.UI.TextWidth(), 0)
+	r.UI.App.SetFocus(list)
 
-		// Show status message
-		if foundIndex <= pos {
-			r.UI.SetStatus(fmt.Sprintf("Found: %s (wrapped)", lines[foundIndex]))
-		} else {
-			r.UI.SetStatus(fmt.Sprintf("Found: %s", lines[foundIndex]))
+	list.SetSelectedFunc(func(i int, _ string, _ string, _ rune) {
+		resetCapture()
+		resetContent()
+		if r.SearchResults[i].Chapter != r.CurrentChapter ||
+			!r.searchResultShown(r.chapterMatches(re), i) {
+			r.pushHistory()
 		}
-	} else {
-		r.UI.StatusBar.Clear()
-		fmt.Fprintf(r.UI.StatusBar, "[red]Pattern not found:[white] %s", r.UI.SearchPattern)
+		r.showSearchResult(re, i, "")
+	})
+
+	resetCapture = r.UI.SetCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			resetCapture()
+			resetContent()
+			r.highlightSearchResults(r.chapterMatches(re), -1)
+			return nil
+		case tcell.KeyEnter, tcell.KeyUp, tcell.KeyDown, tcell.KeyHome, tcell.KeyEnd, tcell.KeyPgUp, tcell.KeyPgDn:
+			return event
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'q':
+				resetCapture()
+				resetContent()
+				r.highlightSearchResults(r.chapterMatches(re), -1)
+				return nil
+			case 'j', 'n':
+				return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+			case 'k', 'N':
+				return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+			case 'g':
+				return tcell.NewEventKey(tcell.KeyHome, 0, tcell.ModNone)
+			case 'G':
+				return tcell.NewEventKey(tcell.KeyEnd, 0, tcell.ModNone)
+			}
+		}
+		return nil
+	})
+}
+
+// plural writes a count with the singular or plural form of a word
+func plural(n int, singular string, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
 	}
+	return fmt.Sprintf("%d %s", n, plural)
 }
 
-// searchPrev searches for the previous occurrence of the search pattern
-func (r *Reader) searchPrev() {
-	if r.UI.SearchPattern == "" {
-		return
+// chapterTitle returns the title of a chapter, its number without one
+func (r *Reader) chapterTitle(index int) string {
+	if title := strings.TrimSpace(r.Book.TOC.Slice[index].Title); title != "" {
+		return title
 	}
+	return fmt.Sprintf("Chapter %d", index+1)
+}
 
-	text := r.UI.TextArea.GetText(false)
-	re, err := regexp.Compile(r.UI.SearchPattern)
-	if err != nil {
-		r.UI.SetStatus(fmt.Sprintf("Invalid search pattern: %v", err))
-		return
+// resultLine returns the line of the current chapter holding a search result,
+// from the matches of the chapter as its layout may have changed
+func (r *Reader) resultLine(matches []parser.TextMatch, i int) int {
+	if match := r.SearchResults[i].Match; match < len(matches) {
+		return matches[match].Line
 	}
+	return r.SearchResults[i].Line
+}
 
-	// Get the current position
+// searchResultShown checks if a search result of the current chapter is on the screen
+func (r *Reader) searchResultShown(matches []parser.TextMatch, i int) bool {
+	if i < 0 || i >= len(r.SearchResults) || r.SearchResults[i].Chapter != r.CurrentChapter {
+		return false
+	}
+	line := r.resultLine(matches, i)
 	row, _ := r.UI.TextArea.GetScrollOffset()
-	pos := row
-
-	// Split the text into lines
-	lines := strings.Split(text, "\n")
-	found := false
-	foundIndex := -1
-
-	// Find the previous occurrence (searching backwards)
-	for i := pos - 1; i >= 0; i-- {
-		if re.MatchString(lines[i]) {
-			foundIndex = i
-			found = true
-			break
+	_, _, _, height := r.UI.TextArea.GetInnerRect()
+	return line >= row && line < row+max(height, 1)
+}
+
+// showSearchResult shows a search result, its match highlighted differently from the others,
+// note is added to the status
+func (r *Reader) showSearchResult(re *ui.SearchMatcher, i int, note string) {
+	result := r.SearchResults[i]
+	if result.Chapter != r.CurrentChapter {
+		if err := r.readChapter(result.Chapter, 0); err != nil {
+			r.UI.SetStatus(fmt.Sprintf("Error reading chapter: %v", err))
+			return
 		}
 	}
+	matches := r.chapterMatches(re)
+	line := r.resultLine(matches, i)
+	r.highlightSearchResults(matches, result.Match)
+	if !r.searchResultShown(matches, i) {
+		r.UI.TextArea.ScrollTo(line, 0)
+	}
+	r.SearchCurrent = i
+	r.UI.SetStatus(fmt.Sprintf("Match %d/%d%s (%s) · %s: %s", i+1, len(r.SearchResults), note,
+		r.searchModeText(), tview.Escape(r.chapterTitle(result.Chapter)), result.Context))
+}
+
+// nextSearchResult returns the search result after (step 1) or before (step -1) the current one,
+// or the position shown when it isn't on the screen; wrapped tells if it went around the book
+func (r *Reader) nextSearchResult(re *ui.SearchMatcher, step int) (next int, wrapped bool) {
+	n := len(r.SearchResults)
+	matches := r.chapterMatches(re)
+	if r.searchResultShown(matches, r.SearchCurrent) {
+		next = r.SearchCurrent + step
+		return (next + n) % n, next < 0 || next >= n
+	}
 
-	// If we get here and didn't find anything, wrap around to the end
-	if !found {
-		for i := len(lines) - 1; i >= pos; i-- {
-			if re.MatchString(lines[i]) {
-				foundIndex = i
-				found = true
-				break
+	row, _ := r.UI.TextArea.GetScrollOffset()
+	// after checks if a result comes after the position shown
+	after := func(i int) bool {
+		result := r.SearchResults[i]
+		if result.Chapter != r.CurrentChapter {
+			return result.Chapter > r.CurrentChapter
+		}
+		return r.resultLine(matches, i) >= row
+	}
+	if step > 0 {
+		for i := range n {
+			if after(i) {
+				return i, false
 			}
 		}
+		return 0, true
 	}
+	for i := n - 1; i >= 0; i-- {
+		if !after(i) {
+			return i, false
+		}
+	}
+	return n - 1, true
+}
 
-	if found {
-		// Highlight the search results in the entire text with the current focused one highlighted differently
-		r.highlightSearchResults(re, foundIndex)
+// searchNext shows the next match of the search pattern in the book
+func (r *Reader) searchNext() {
+	r.searchStep(1)
+}
 
-		// Scroll to the found occurrence
-		r.UI.TextArea.ScrollTo(foundIndex, 0)
+// searchPrev shows the previous match of the search pattern in the book
+func (r *Reader) searchPrev() {
+	r.searchStep(-1)
+}
 
-		// Show status message
-		if foundIndex >= pos {
-			r.UI.SetStatus(fmt.Sprintf("Found: %s (wrapped)", lines[foundIndex]))
-		} else {
-			r.UI.SetStatus(fmt.Sprintf("Found: %s", lines[foundIndex]))
-		}
-	} else {
+// searchStep shows the match of the search pattern after (step 1) or before (step -1) the current one,
+// going around the book at its ends
+func (r *Reader) searchStep(step int) {
+	if r.UI.SearchPattern == "" {
+		return
+	}
+
+	re, err := r.UI.CompileSearch()
+	if err != nil {
+		r.invalidSearchPattern(err)
+		return
+	}
+	if r.SearchResults == nil {
+		r.SearchResults = r.searchBook(re)
+		r.SearchCurrent = -1
+	}
+	if len(r.SearchResults) == 0 {
 		r.UI.StatusBar.Clear()
-		fmt.Fprintf(r.UI.StatusBar, "[red]Pattern not found:[white] %s", r.UI.SearchPattern)
+		fmt.Fprintf(r.UI.StatusBar, "[red]Pattern not found:[white] %s (%s)", tview.Escape(r.UI.SearchPattern), r.searchModeText())
+		return
+	}
+
+	next, wrapped := r.nextSearchResult(re, step)
+	note := ""
+	if wrapped {
+		note = " (wrapped)"
 	}
+	r.showSearchResult(re, next, note)
 }
 
-// highlightSearchResults highlights all occurrences of the search pattern in the text
-// focusedLineIndex is the line index of the currently focused search result
-func (r *Reader) highlightSearchResults(re *regexp.Regexp, focusedLineIndex int) {
-	// Get the current text
-	text := r.UI.TextArea.GetText(false)
-	lines := strings.Split(text, "\n")
+// highlightSearchResults highlights the matches of the search pattern in the text of the current chapter,
+// the match number focused is the current search result
+func (r *Reader) highlightSearchResults(matches []parser.TextMatch, focused int) {
+	text := parser.HighlightMatches(r.Text, r.Bidi, matches, func(match int) string {
+		// For the focused match, highlight with a different color
+		if match == focused {
+			return "[black:green]"
+		}
+		return "[black:yellow]"
+	})
 
-	// Clear the text area
 	r.UI.TextArea.Clear()
-
-	// Write the lines back with highlighted search results
-	for i, line := range lines {
-		if i == focusedLineIndex {
-			// For the focused line, highlight matches with a different color
-			highlightedLine := re.ReplaceAllStringFunc(line, func(match string) string {
-				return fmt.Sprintf("[black:green]%s[-:-]", match)
-			})
-			fmt.Fprintln(r.UI.TextArea, highlightedLine)
-		} else {
-			// For other lines, use the standard highlight color
-			highlightedLine := re.ReplaceAllStringFunc(line, func(match string) string {
-				return fmt.Sprintf("[black:yellow]%s[-:-]", match)
-			})
-			fmt.Fprintln(r.UI.TextArea, highlightedLine)
-		}
-	}
+	fmt.Fprintln(r.UI.TextArea, text)
 }
 
 // clearSearchHighlights clears all search highlights from the text
 func (r *Reader) clearSearchHighlights() {
-	// Get the current text without color codes
-	text := r.UI.TextArea.GetText(true)
-	lines := strings.Split(text, "\n")
-
-	// Clear the text area
+	// Write the styled text back
 	r.UI.TextArea.Clear()
-
-	// Write the lines back without highlights
-	for _, line := range lines {
-		fmt.Fprintln(r.UI.TextArea, line)
-	}
+	fmt.Fprintln(r.UI.TextArea, r.Text)
 
 	r.UI.SetStatus("Search cleared")
 }
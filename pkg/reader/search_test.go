@@ -0,0 +1,27 @@
+package reader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchContext(t *testing.T) {
+	long := strings.Repeat("word ", 40)
+	tests := []struct {
+		text       string
+		start, end int
+		want       string
+	}{
+		{text: "  the final answer", start: 6, end: 11, want: "the [::r]final[::-] answer"},
+		{text: long + "match", start: len(long), end: len(long) + 5,
+			want: "…" + strings.Repeat("word ", 6) + "[::r]match[::-]"},
+		{text: "match " + long, start: 0, end: 5,
+			want: "[::r]match[::-] " + strings.TrimRight(strings.Repeat("word ", 24), " ") + "…"},
+		{text: "a [b] c", start: 2, end: 5, want: "a [::r][b[][::-] c"}, // The text is escaped
+	}
+	for _, tt := range tests {
+		if got := matchContext(tt.text, tt.start, tt.end); got != tt.want {
+			t.Errorf("matchContext(%q, %d, %d) = %q, want %q", tt.text, tt.start, tt.end, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package reader
 
 import (
+	"bytes"
 	"fmt"
+	"image"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/ray-d-song/goread/pkg/epub"
@@ -18,36 +21,122 @@ func (r *Reader) showMetadata() {
 		return
 	}
 
-	var metadataItems [][]string
-	if metadata.Title != "" {
-		metadataItems = append(metadataItems, []string{"Title", metadata.Title})
+	titles := ui.MetadataGroup{Name: "Title"}
+	for _, title := range metadata.Titles {
+		name := "Title"
+		if title.Type != "" && title.Type != "main" {
+			name = strings.ToUpper(title.Type[:1]) + title.Type[1:]
+		}
+		titles.Items = append(titles.Items, []string{name, title.Value})
+	}
+	for _, series := range metadata.Series {
+		name := "Series"
+		if series.Type == "set" {
+			name = "Set"
+		}
+		value := series.Name
+		if series.Position != "" {
+			value = fmt.Sprintf("%s #%s", series.Name, series.Position)
+		}
+		titles.Items = append(titles.Items, []string{name, value})
 	}
-	if metadata.Creator != "" {
-		metadataItems = append(metadataItems, []string{"Creator", metadata.Creator})
+
+	creators := ui.MetadataGroup{Name: "Creators"}
+	for _, contributor := range append(metadata.Creators, metadata.Contributors...) {
+		var roles []string
+		for _, role := range contributor.Roles {
+			roles = append(roles, epub.RoleName(role))
+		}
+		name := "Contributor"
+		if len(roles) > 0 {
+			name = strings.Join(roles, ", ")
+		}
+		creators.Items = append(creators.Items, []string{name, contributor.Name})
 	}
+
+	publication := ui.MetadataGroup{Name: "Publication"}
 	if metadata.Publisher != "" {
-		metadataItems = append(metadataItems, []string{"Publisher", metadata.Publisher})
+		publication.Items = append(publication.Items, []string{"Publisher", metadata.Publisher})
+	}
+	if metadata.Date != "" {
+		publication.Items = append(publication.Items, []string{"Date", metadata.Date})
+	}
+	if metadata.Modified != "" {
+		publication.Items = append(publication.Items, []string{"Modified", metadata.Modified})
 	}
 	if metadata.Language != "" {
-		metadataItems = append(metadataItems, []string{"Language", metadata.Language})
+		publication.Items = append(publication.Items, []string{"Language", metadata.Language})
 	}
-	if metadata.Identifier != "" {
-		metadataItems = append(metadataItems, []string{"Identifier", metadata.Identifier})
+	if metadata.Rights != "" {
+		publication.Items = append(publication.Items, []string{"Rights", metadata.Rights})
 	}
-	if metadata.Date != "" {
-		metadataItems = append(metadataItems, []string{"Date", metadata.Date})
+
+	identifiers := ui.MetadataGroup{Name: "Identifiers"}
+	for _, identifier := range metadata.Identifiers {
+		name := identifier.Scheme
+		if name == "" {
+			name = "Identifier"
+		}
+		identifiers.Items = append(identifiers.Items, []string{name, identifier.Value})
 	}
+
+	subjects := ui.MetadataGroup{Name: "Subjects"}
+	for _, subject := range metadata.Subjects {
+		subjects.Items = append(subjects.Items, []string{"Subject", subject})
+	}
+
+	description := ui.MetadataGroup{Name: "Description"}
 	if metadata.Description != "" {
-		metadataItems = append(metadataItems, []string{"Description", metadata.Description})
+		description.Items = append(description.Items, []string{"Description", metadata.Description})
 	}
-	if metadata.Rights != "" {
-		metadataItems = append(metadataItems, []string{"Rights", metadata.Rights})
+
+	other := ui.MetadataGroup{Name: "Other", Items: metadata.OtherMeta}
+
+	r.UI.ShowMetadata([]ui.MetadataGroup{titles, creators, publication, identifiers, subjects, description, other})
+}
+
+// showCover shows the cover image of the book
+func (r *Reader) showCover() {
+	if !r.Book.HasCover() {
+		r.UI.SetStatus("This book has no cover")
+		return
+	}
+
+	openCover := func() {
+		tempFile, err := extractImage(r.Book, r.Book.Cover, r.TempDir)
+		if err != nil {
+			r.UI.SetStatus(fmt.Sprintf("Error extracting image: %v", err))
+			return
+		}
+		if err := r.UI.OpenImage(tempFile); err != nil {
+			utils.DebugLog("[ERROR:showCover] Error opening image: %v", err)
+			r.UI.SetStatus(fmt.Sprintf("Error opening image: %v", err))
+		}
+	}
+
+	data, err := r.Book.GetCover()
+	if err != nil {
+		utils.DebugLog("[ERROR:showCover] Error reading cover: %v", err)
+		r.UI.SetStatus(fmt.Sprintf("Error reading cover: %v", err))
+		return
+	}
+
+	// SVG and other formats can't be decoded, they are left to the external viewer
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		utils.DebugLog("[ERROR:showCover] Error decoding cover %s (%s): %v", r.Book.Cover, r.Book.CoverMediaType, err)
+		img = nil
 	}
-	for _, item := range metadata.OtherMeta {
-		metadataItems = append(metadataItems, item)
+
+	caption := ""
+	if metadata, err := r.Book.GetMetadata(); err == nil {
+		caption = metadata.MainTitle()
+		if len(metadata.Creators) > 0 {
+			caption += "\n" + metadata.Creators[0].Name
+		}
 	}
 
-	r.UI.ShowMetadata(metadataItems)
+	r.UI.ShowCover(img, caption, openCover)
 }
 
 // showTOC shows the table of contents
@@ -347,3 +436,168 @@ func (r *Reader) showTOC(index int) {
 		return event
 	})
 }
+
+// showLandmarks shows the landmarks of the book (cover, start of content, bibliography, ...)
+func (r *Reader) showLandmarks() {
+	if len(r.Book.Landmarks) == 0 {
+		r.UI.SetStatus("This book has no landmarks")
+		return
+	}
+
+	list := tview.NewList().
+		ShowSecondaryText(true).
+		SetHighlightFullLine(true)
+	switch r.UI.ColorScheme {
+	case ui.DefaultColorScheme:
+		list.SetBackgroundColor(tcell.ColorDefault)
+		list.SetMainTextColor(tcell.ColorDefault)
+		list.SetSecondaryTextColor(tcell.ColorDarkCyan)
+		list.SetSelectedBackgroundColor(tcell.ColorDarkCyan)
+	case ui.DarkColorScheme:
+		list.SetBackgroundColor(tcell.ColorDarkSlateGray)
+		list.SetMainTextColor(tcell.ColorWhite)
+		list.SetSecondaryTextColor(tcell.ColorLightGray)
+		list.SetSelectedBackgroundColor(tcell.ColorDarkBlue)
+	case ui.LightColorScheme:
+		list.SetBackgroundColor(tcell.ColorWhite)
+		list.SetMainTextColor(tcell.ColorBlack)
+		list.SetSecondaryTextColor(tcell.ColorDarkBlue)
+		list.SetSelectedBackgroundColor(tcell.ColorLightBlue)
+	}
+
+	for _, landmark := range r.Book.Landmarks {
+		title := landmark.Title
+		if title == "" {
+			title = landmark.Type
+		}
+		list.AddItem(title, landmark.Type, 0, nil)
+	}
+
+	var resetCapture func()
+	resetContent := r.UI.SetTempContent(list)
+	r.UI.App.SetFocus(list)
+
+	list.SetSelectedFunc(func(i int, _ string, _ string, _ rune) {
+		resetCapture()
+		resetContent()
+		landmark := r.Book.Landmarks[i]
+		if err := r.jumpToTarget(landmark.Path, landmark.Fragment); err != nil {
+			utils.DebugLog("[ERROR:showLandmarks] Error jumping to landmark: %v", err)
+			r.UI.SetStatus(fmt.Sprintf("Error jumping to landmark: %v", err))
+		}
+	})
+
+	resetCapture = r.UI.SetCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			resetCapture()
+			resetContent()
+			return nil
+		case tcell.KeyEnter, tcell.KeyUp, tcell.KeyDown, tcell.KeyHome, tcell.KeyEnd, tcell.KeyPgUp, tcell.KeyPgDn:
+			return event
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'q':
+				resetCapture()
+				resetContent()
+				return nil
+			case 'j':
+				return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+			case 'k':
+				return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+			}
+		}
+		return nil
+	})
+}
+
+// showRenditions shows the renditions of a multiple-rendition book and switches to the selected one
+func (r *Reader) showRenditions() {
+	if len(r.Book.Renditions) < 2 {
+		r.UI.SetStatus("This book has only one rendition")
+		return
+	}
+
+	list := tview.NewList().
+		ShowSecondaryText(false).
+		SetHighlightFullLine(true)
+	switch r.UI.ColorScheme {
+	case ui.DefaultColorScheme:
+		list.SetBackgroundColor(tcell.ColorDefault)
+		list.SetMainTextColor(tcell.ColorDefault)
+		list.SetSelectedBackgroundColor(tcell.ColorDarkCyan)
+	case ui.DarkColorScheme:
+		list.SetBackgroundColor(tcell.ColorDarkSlateGray)
+		list.SetMainTextColor(tcell.ColorWhite)
+		list.SetSelectedBackgroundColor(tcell.ColorDarkBlue)
+	case ui.LightColorScheme:
+		list.SetBackgroundColor(tcell.ColorWhite)
+		list.SetMainTextColor(tcell.ColorBlack)
+		list.SetSelectedBackgroundColor(tcell.ColorLightBlue)
+	}
+
+	for i, rendition := range r.Book.Renditions {
+		text := rendition.Description()
+		if i == r.Book.Rendition {
+			text = "* " + text
+		} else {
+			text = "  " + text
+		}
+		list.AddItem(text, "", 0, nil)
+	}
+	list.SetCurrentItem(r.Book.Rendition)
+
+	var resetCapture func()
+	resetContent := r.UI.SetTempContent(list)
+	r.UI.App.SetFocus(list)
+
+	list.SetSelectedFunc(func(i int, _ string, _ string, _ rune) {
+		resetCapture()
+		resetContent()
+		if i == r.Book.Rendition {
+			return
+		}
+
+		// Positions can't be carried over, the new rendition starts from the beginning
+		if err := r.Book.SelectRendition(i); err != nil {
+			utils.DebugLog("[ERROR:showRenditions] Error switching rendition: %v", err)
+			r.UI.SetStatus(fmt.Sprintf("Error switching rendition: %v", err))
+			return
+		}
+		// The jumps and the search results point to the chapters of the other rendition,
+		// the book is searched again for the next match
+		r.BackHistory = nil
+		r.ForwardHistory = nil
+		r.SearchResults = nil
+		r.SearchCurrent = -1
+		if err := r.readChapter(0, 0); err != nil {
+			r.UI.SetStatus(fmt.Sprintf("Error reading chapter: %v", err))
+			return
+		}
+		r.saveState(r.CurrentChapter, r.UI.Width, 0, 0)
+		r.UI.SetStatus(fmt.Sprintf("Rendition: %s", r.Book.Renditions[i].Description()))
+	})
+
+	resetCapture = r.UI.SetCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			resetCapture()
+			resetContent()
+			return nil
+		case tcell.KeyEnter, tcell.KeyUp, tcell.KeyDown, tcell.KeyHome, tcell.KeyEnd, tcell.KeyPgUp, tcell.KeyPgDn:
+			return event
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'q':
+				resetCapture()
+				resetContent()
+				return nil
+			case 'j':
+				return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+			case 'k':
+				return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+			}
+		}
+		return nil
+	})
+}
@@ -1,11 +1,56 @@
 package reader
 
+import (
+	"fmt"
+
+	"github.com/ray-d-song/goread/pkg/parser"
+	"github.com/ray-d-song/goread/pkg/utils"
+)
+
 // increaseWidth increases the width
 func (r *Reader) increaseWidth() {
 	r.UI.SetWidth(r.UI.Width + 5)
+	r.relayout()
 }
 
 // decreaseWidth decreases the width
 func (r *Reader) decreaseWidth() {
 	r.UI.SetWidth(r.UI.Width - 5)
+	r.relayout()
+}
+
+// fitWidth lays out the current chapter again when the terminal is resized to another
+// width of the text area, a window wider than the terminal is cut to it
+func (r *Reader) fitWidth() {
+	r.UI.SetWidth(r.UI.Width)
+	if r.UI.TextWidth() != r.Book.Width {
+		utils.DebugLog("[INFO:fitWidth] Laying out for width %d", r.UI.TextWidth())
+		r.relayout()
+	}
+}
+
+// relayout reads the current chapter again to lay it out for the new width,
+// the text at the top of the screen stays there
+func (r *Reader) relayout() {
+	row, _ := r.UI.TextArea.GetScrollOffset()
+	pos := -1
+	if row < len(r.Positions) {
+		pos = r.Positions[row]
+	}
+	if err := r.readChapter(r.CurrentChapter, 0); err != nil {
+		r.UI.SetStatus(fmt.Sprintf("Error reading chapter: %v", err))
+		return
+	}
+	if pos >= 0 {
+		row = parser.PositionLine(r.Positions, pos)
+	}
+	r.UI.TextArea.ScrollTo(row, 0)
+}
+
+// onOff names a setting being on or off
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
 }
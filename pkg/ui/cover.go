@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/ray-d-song/goread/pkg/utils"
+	"github.com/rivo/tview"
+)
+
+// renderHalfBlocks renders an image with "▀" cells, the foreground color paints
+// the upper pixel and the background color the lower one, so every cell shows two pixels
+// The image is scaled to fit in width x height cells, keeping its aspect ratio
+func renderHalfBlocks(img image.Image, width int, height int) string {
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 || width <= 0 || height <= 0 {
+		return ""
+	}
+
+	scale := float64(width) / float64(bounds.Dx())
+	if s := float64(height*2) / float64(bounds.Dy()); s < scale {
+		scale = s
+	}
+	cols := max(int(float64(bounds.Dx())*scale), 1)
+	rows := max(int(float64(bounds.Dy())*scale)/2, 1)
+
+	// pixel returns the average color of the area of the image covered by the scaled pixel
+	pixel := func(x int, y int) string {
+		c := averageColor(img, x, y, cols, rows*2)
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+
+	var builder strings.Builder
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			fmt.Fprintf(&builder, "[%s:%s]▀", pixel(x, y*2), pixel(x, y*2+1))
+		}
+		builder.WriteString("[-:-]\n")
+	}
+	return builder.String()
+}
+
+// ShowCover shows the cover image of the book with a caption (title, author) below it
+// img is nil if the image can't be decoded (SVG, WebP, ...)
+// open is called when the user asks to open the image in the external viewer
+func (ui *UI) ShowCover(img image.Image, caption string, open func()) error {
+	// The content area is not drawn yet when the book is opened, use the terminal size
+	termWidth, termHeight := utils.GetTermSize()
+	width := ui.Width
+	if width <= 0 || (termWidth > 0 && width > termWidth) {
+		width = termWidth
+	}
+	// Leave room for the caption and the status bar
+	height := termHeight - 3
+	if height <= 0 {
+		height = width / 2
+	}
+
+	coverView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWrap(false).
+		SetTextAlign(tview.AlignCenter)
+	if img != nil {
+		coverView.SetText(renderHalfBlocks(img, width, height) + "\n" + tview.Escape(caption))
+	} else {
+		coverView.SetText(fmt.Sprintf("\n%s\n\nThe cover can't be displayed here, press o to open it",
+			tview.Escape(caption)))
+	}
+
+	switch ui.ColorScheme {
+	case DefaultColorScheme:
+		coverView.SetBackgroundColor(tcell.ColorDefault)
+		coverView.SetTextColor(tcell.ColorDefault)
+	case DarkColorScheme:
+		coverView.SetBackgroundColor(tcell.ColorDarkSlateGray)
+		coverView.SetTextColor(tcell.ColorWhite)
+	case LightColorScheme:
+		coverView.SetBackgroundColor(tcell.ColorWhite)
+		coverView.SetTextColor(tcell.ColorBlack)
+	}
+
+	resetContent := ui.SetTempContent(coverView)
+	ui.App.SetFocus(coverView)
+
+	var resetCapture func()
+	resetCapture = ui.SetCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape, tcell.KeyEnter:
+			resetCapture()
+			resetContent()
+			return nil
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'q', 'v', ' ':
+				resetCapture()
+				resetContent()
+				return nil
+			case 'o':
+				if open != nil {
+					open()
+				}
+				return nil
+			}
+		}
+		// Block all other keys
+		return nil
+	})
+
+	return nil
+}
@@ -8,12 +8,14 @@ import (
 	"strings"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/ray-d-song/goread/pkg/parser"
 	"github.com/ray-d-song/goread/pkg/utils"
 	"github.com/rivo/tview"
 )
 
 // ShowImageSelect shows an input dialog for selecting an image by number
-func (ui *UI) ShowImageSelect(images []string, callback func(string)) error {
+// callback is called with the index of the image, -1 when the selection is canceled
+func (ui *UI) ShowImageSelect(images []parser.Image, callback func(int)) error {
 
 	// Create an input field for image selection
 	imageInput := tview.NewInputField().
@@ -50,6 +52,11 @@ func (ui *UI) ShowImageSelect(images []string, callback func(string)) error {
 
 	// Set the completion function for the image input
 	imageInput.SetDoneFunc(func(key tcell.Key) {
+		// Restore the original input capture function before the callback, which may set its own
+		resetCapture()
+
+		resetStatus()
+
 		if key == tcell.KeyEnter {
 			// Get the selected image number
 			numStr := imageInput.GetText()
@@ -60,20 +67,15 @@ func (ui *UI) ShowImageSelect(images []string, callback func(string)) error {
 				// Check if the number is valid
 				if num >= 0 && num < len(images) {
 					// Call the callback with the selected image
-					callback(images[num])
+					callback(num)
 				} else {
 					ui.SetStatus(fmt.Sprintf("Invalid image number: %d (valid range: 0-%d)", num, len(images)-1))
 				}
 			}
 		} else if key == tcell.KeyEscape {
 			// Cancel image selection
-			callback("") // Call callback with empty string to indicate cancellation
+			callback(-1) // Call callback with -1 to indicate cancellation
 		}
-
-		// Restore the original input capture function
-		resetCapture()
-
-		resetStatus()
 	})
 
 	return nil
@@ -200,18 +202,20 @@ func (ui *UI) OpenImage(imagePath string) error {
 }
 
 // SelectImage shows a dialog to select an image
-func (ui *UI) SelectImage(images []string, startLine int, endLine int) (string, error) {
+func (ui *UI) SelectImage(images []parser.Image, startLine int, endLine int) (string, error) {
 	// Find images in the visible area
 	var visibleImages []string
 	var visibleIndices []int
 	var visibleDescriptions []string
 
-	text := ui.TextArea.GetText(false)
+	// Without the color tags, which may split the markers
+	text := ui.TextArea.GetText(true)
 	lines := strings.Split(text, "\n")
 
 	for i := startLine; i <= endLine && i < len(lines); i++ {
 		line := lines[i]
-		re := regexp.MustCompile(`\[IMG:(\d+)(?:\s*-\s*([^\]]+))?\]`)
+		// The label after the number may be wrapped on the next lines
+		re := regexp.MustCompile(`\[IMG:(\d+)`)
 		matches := re.FindAllStringSubmatch(line, -1)
 		for _, match := range matches {
 			if len(match) > 1 {
@@ -219,15 +223,11 @@ func (ui *UI) SelectImage(images []string, startLine int, endLine int) (string,
 				idx := 0
 				fmt.Sscanf(index, "%d", &idx)
 				if idx < len(images) {
-					visibleImages = append(visibleImages, images[idx])
+					visibleImages = append(visibleImages, images[idx].Src)
 					visibleIndices = append(visibleIndices, idx)
 
-					// Get description if available
-					description := ""
-					if len(match) > 2 && match[2] != "" {
-						description = match[2]
-					}
-					visibleDescriptions = append(visibleDescriptions, description)
+					// Get description if available: the caption, alternative text or title
+					visibleDescriptions = append(visibleDescriptions, images[idx].Label())
 				}
 			}
 		}
@@ -237,9 +237,9 @@ func (ui *UI) SelectImage(images []string, startLine int, endLine int) (string,
 		// If no images in visible area, show all images
 		if len(images) > 0 {
 			for idx, img := range images {
-				visibleImages = append(visibleImages, img)
+				visibleImages = append(visibleImages, img.Src)
 				visibleIndices = append(visibleIndices, idx)
-				visibleDescriptions = append(visibleDescriptions, "")
+				visibleDescriptions = append(visibleDescriptions, img.Label())
 			}
 		} else {
 			return "", fmt.Errorf("no images found in the chapter")
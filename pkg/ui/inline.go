@@ -0,0 +1,480 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/png"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/ray-d-song/goread/pkg/parser"
+	"github.com/ray-d-song/goread/pkg/utils"
+)
+
+// ImageProtocol is how the images are drawn in the text
+type ImageProtocol int
+
+const (
+	// ImageHalfBlocks draws the images with colored "▀" cells, in any terminal
+	ImageHalfBlocks ImageProtocol = iota
+	// ImageKitty draws the images with the Kitty graphics protocol (kitty, Ghostty)
+	ImageKitty
+	// ImageSixel draws the images as Sixel graphics (foot, mlterm, Windows Terminal...)
+	ImageSixel
+	// ImageITerm2 draws the images with the inline images protocol of iTerm2 (iTerm2, WezTerm)
+	ImageITerm2
+)
+
+// Cell size assumed when the terminal doesn't tell it, in pixels
+const (
+	defaultCellWidth  = 8
+	defaultCellHeight = 16
+)
+
+// Numbers of scaled and encoded images kept for drawing them again
+const (
+	maxScaledImages   = 8
+	maxImageSequences = 32
+)
+
+// String returns the name of the image protocol
+func (p ImageProtocol) String() string {
+	switch p {
+	case ImageKitty:
+		return "kitty"
+	case ImageSixel:
+		return "sixel"
+	case ImageITerm2:
+		return "iterm2"
+	}
+	return "blocks"
+}
+
+// DetectImageProtocol finds the image protocol of the terminal from the environment,
+// GOREAD_IMAGES (kitty, sixel, iterm2 or blocks) chooses it
+func DetectImageProtocol() ImageProtocol {
+	for _, p := range []ImageProtocol{ImageHalfBlocks, ImageKitty, ImageSixel, ImageITerm2} {
+		if strings.EqualFold(os.Getenv("GOREAD_IMAGES"), p.String()) {
+			return p
+		}
+	}
+
+	term := os.Getenv("TERM")
+	program := os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || term == "xterm-ghostty" || program == "ghostty":
+		return ImageKitty
+	case program == "iTerm.app" || program == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		// LC_TERMINAL goes through ssh
+		return ImageITerm2
+	case strings.Contains(term, "sixel") || term == "foot" || strings.HasPrefix(term, "foot-") ||
+		term == "mlterm" || program == "contour" || os.Getenv("WT_SESSION") != "":
+		return ImageSixel
+	}
+	return ImageHalfBlocks
+}
+
+// Longest side of the images sent to Kitty, in pixels, the bigger ones are scaled down
+const maxKittySize = 2048
+
+// imagePlacement is a part of an image shown on the screen
+type imagePlacement struct {
+	path       string
+	x, y       int             // Screen cell of its top left corner
+	cols, rows int             // Number of cells it covers
+	crop       image.Rectangle // Part of the image shown, in pixels of the image
+}
+
+// kittyImage is an image sent to Kitty
+type kittyImage struct {
+	id    int
+	scale float64 // Size of the image sent over the size of the image
+}
+
+// cellSize returns the size in pixels of a cell of the terminal
+func cellSize() (int, int) {
+	width, height := utils.GetCellSize()
+	if width <= 0 || height <= 0 {
+		return defaultCellWidth, defaultCellHeight
+	}
+	return width, height
+}
+
+// loadImage decodes an image of the book, nil when it can't be decoded (SVG, WebP...)
+// The images are decoded once
+func (ui *UI) loadImage(path string) image.Image {
+	if img, ok := ui.decoded[path]; ok {
+		return img
+	}
+	var img image.Image
+	if ui.ReadImage != nil {
+		data, err := ui.ReadImage(path)
+		if err == nil {
+			img, _, err = image.Decode(bytes.NewReader(data))
+		}
+		if err != nil {
+			utils.DebugLog("[WARN:loadImage] Can't decode image %s: %v", path, err)
+			img = nil
+		}
+	}
+	ui.decoded[path] = img
+	return img
+}
+
+// scaledImage returns a part of an image of the book scaled to width x height pixels,
+// nil when it can't be decoded
+// The last scaled images are kept
+func (ui *UI) scaledImage(path string, crop image.Rectangle, width int, height int) *image.RGBA {
+	key := scaledKey{path, crop, width, height}
+	if scaled, ok := ui.scaled[key]; ok {
+		return scaled
+	}
+	img := ui.loadImage(path)
+	if img == nil {
+		return nil
+	}
+	if len(ui.scaled) >= maxScaledImages {
+		clear(ui.scaled)
+	}
+	scaled := scaleImage(croppedImage{img, crop}, width, height)
+	ui.scaled[key] = scaled
+	return scaled
+}
+
+// ImageSize returns the size an image of the book is drawn at in the text: its size in cells,
+// no wider than the text area and no higher than the terminal, zero when it can't be decoded
+func (ui *UI) ImageSize(path string) parser.ImageSize {
+	img := ui.loadImage(path)
+	if img == nil || img.Bounds().Dx() == 0 || img.Bounds().Dy() == 0 {
+		return parser.ImageSize{}
+	}
+	bounds := img.Bounds()
+	cellWidth, cellHeight := cellSize()
+
+	cols := max(min((bounds.Dx()+cellWidth-1)/cellWidth, ui.TextWidth()), 1)
+	rows := max((cols*cellWidth*bounds.Dy()+bounds.Dx()*cellHeight-1)/(bounds.Dx()*cellHeight), 1)
+	// Room is left for the marker under the image and the status bar
+	if _, termHeight := utils.GetTermSize(); termHeight > 3 && rows > termHeight-2 {
+		cols = max(cols*(termHeight-2)/rows, 1)
+		rows = termHeight - 2
+	}
+	return parser.ImageSize{Cols: cols, Rows: rows}
+}
+
+// showingText checks if the text area is on the screen, not hidden by another view
+func (ui *UI) showingText() bool {
+	for i := range ui.Horizontal.GetItemCount() {
+		if ui.Horizontal.GetItem(i) == ui.Content {
+			return true
+		}
+	}
+	return false
+}
+
+// imagePlacements returns the images on the screen: the one of the image viewer,
+// or the ones of the text area
+func (ui *UI) imagePlacements() []imagePlacement {
+	if ui.viewer != nil {
+		if p, ok := ui.viewer.placement(); ok {
+			return []imagePlacement{p}
+		}
+		return nil
+	}
+	if !ui.showingText() {
+		return nil
+	}
+	x, y, _, height := ui.TextArea.GetInnerRect()
+	row, _ := ui.TextArea.GetScrollOffset()
+	var placements []imagePlacement
+	for _, box := range ui.ImageBoxes {
+		if box.Image < 0 || box.Image >= len(ui.ImagePaths) {
+			continue
+		}
+		top := box.Line - row
+		first := max(-top, 0)
+		last := min(box.Rows, height-top)
+		if first >= last {
+			continue
+		}
+		path := ui.ImagePaths[box.Image]
+		img := ui.loadImage(path)
+		if img == nil {
+			continue
+		}
+		// The rows out of the text area are cut
+		bounds := img.Bounds()
+		placements = append(placements, imagePlacement{
+			path: path,
+			x:    x + box.Column,
+			y:    y + top + first,
+			cols: box.Cols,
+			rows: last - first,
+			crop: image.Rect(bounds.Min.X, bounds.Min.Y+first*bounds.Dy()/box.Rows,
+				bounds.Max.X, bounds.Min.Y+last*bounds.Dy()/box.Rows),
+		})
+	}
+	return placements
+}
+
+// drawImages draws the images after the screen is drawn
+// The half blocks are cells of the screen, the graphics are written to the terminal
+// after the cells, again each time the images move
+func (ui *UI) drawImages(screen tcell.Screen) {
+	placements := ui.imagePlacements()
+	if ui.ImageProtocol == ImageHalfBlocks {
+		for _, p := range placements {
+			ui.drawHalfBlocks(screen, p)
+		}
+		return
+	}
+
+	width, height := screen.Size()
+	if slices.Equal(placements, ui.placed) && ui.placedScreen == [2]int{width, height} {
+		return
+	}
+	ui.placed = placements
+	ui.placedScreen = [2]int{width, height}
+	tty, ok := screen.Tty()
+	if !ok {
+		return
+	}
+
+	var out strings.Builder
+	if ui.ImageProtocol == ImageKitty {
+		// Kitty images are over the cells, the old ones are deleted
+		screen.Show()
+		out.WriteString("\x1b_Ga=d,d=a,q=2\x1b\\")
+	} else {
+		// Graphics replace the cells, the old ones are drawn over by writing all the cells again
+		screen.Sync()
+	}
+	// The cursor is saved for tcell to find it where it left it
+	out.WriteString("\x1b7")
+	for _, p := range placements {
+		fmt.Fprintf(&out, "\x1b[%d;%dH", p.y+1, p.x+1)
+		out.WriteString(ui.imageSequence(p))
+	}
+	out.WriteString("\x1b8")
+	if _, err := tty.Write([]byte(out.String())); err != nil {
+		utils.DebugLog("[ERROR:drawImages] Can't write the images: %v", err)
+	}
+}
+
+// drawHalfBlocks draws the part shown of an image with "▀" cells
+func (ui *UI) drawHalfBlocks(screen tcell.Screen, p imagePlacement) {
+	// Each cell shows two pixels
+	img := ui.scaledImage(p.path, p.crop, p.cols, p.rows*2)
+	if img == nil {
+		return
+	}
+	for row := range p.rows {
+		for col := range p.cols {
+			top := img.RGBAAt(col, row*2)
+			bottom := img.RGBAAt(col, row*2+1)
+			style := tcell.StyleDefault.
+				Foreground(tcell.NewRGBColor(int32(top.R), int32(top.G), int32(top.B))).
+				Background(tcell.NewRGBColor(int32(bottom.R), int32(bottom.G), int32(bottom.B)))
+			screen.SetContent(p.x+col, p.y+row, '▀', nil, style)
+		}
+	}
+}
+
+// imageSequence returns the escape sequence drawing the part shown of an image at the cursor
+func (ui *UI) imageSequence(p imagePlacement) string {
+	if ui.ImageProtocol == ImageKitty {
+		// The whole image is sent once, the placements show the parts on the screen
+		// Placements are cheap, they aren't kept
+		sent, ok := ui.kittyImages[p.path]
+		var sequence string
+		if !ok {
+			img := ui.loadImage(p.path)
+			if img == nil {
+				return ""
+			}
+			bounds := img.Bounds()
+			sent = kittyImage{id: len(ui.kittyImages) + 1, scale: 1}
+			if longest := max(bounds.Dx(), bounds.Dy()); longest > maxKittySize {
+				sent.scale = float64(maxKittySize) / float64(longest)
+				img = scaleImage(img, max(int(float64(bounds.Dx())*sent.scale), 1), max(int(float64(bounds.Dy())*sent.scale), 1))
+			}
+			ui.kittyImages[p.path] = sent
+			sequence = kittyTransmit(img, sent.id)
+		}
+		origin := ui.loadImage(p.path).Bounds().Min
+		crop := p.crop.Sub(origin)
+		return sequence + fmt.Sprintf("\x1b_Ga=p,i=%d,c=%d,r=%d,x=%d,y=%d,w=%d,h=%d,C=1,q=2\x1b\\",
+			sent.id, p.cols, p.rows, int(float64(crop.Min.X)*sent.scale), int(float64(crop.Min.Y)*sent.scale),
+			max(int(float64(crop.Dx())*sent.scale), 1), max(int(float64(crop.Dy())*sent.scale), 1))
+	}
+
+	key := p
+	key.x, key.y = 0, 0
+	if sequence, ok := ui.sequences[key]; ok {
+		return sequence
+	}
+	cellWidth, cellHeight := cellSize()
+	shown := ui.scaledImage(p.path, p.crop, p.cols*cellWidth, p.rows*cellHeight)
+	if shown == nil {
+		return ""
+	}
+
+	var sequence string
+	switch ui.ImageProtocol {
+	case ImageSixel:
+		sequence = encodeSixel(shown)
+	case ImageITerm2:
+		var data bytes.Buffer
+		if err := png.Encode(&data, shown); err != nil {
+			utils.DebugLog("[ERROR:imageSequence] Can't encode image %s: %v", p.path, err)
+			return ""
+		}
+		sequence = fmt.Sprintf("\x1b]1337;File=inline=1;size=%d;width=%d;height=%d;preserveAspectRatio=0:%s\a",
+			data.Len(), p.cols, p.rows, base64.StdEncoding.EncodeToString(data.Bytes()))
+	}
+
+	if len(ui.sequences) >= maxImageSequences {
+		clear(ui.sequences)
+	}
+	ui.sequences[key] = sequence
+	return sequence
+}
+
+// scaledKey is a part of an image of the book scaled to a size in pixels
+type scaledKey struct {
+	path          string
+	crop          image.Rectangle
+	width, height int
+}
+
+// croppedImage is a part of an image
+type croppedImage struct {
+	image.Image
+	bounds image.Rectangle
+}
+
+// Bounds returns the part of the image
+func (c croppedImage) Bounds() image.Rectangle {
+	return c.bounds
+}
+
+// kittyTransmit returns the escape sequences sending an image to Kitty as PNG, in chunks of 4096 bytes
+func kittyTransmit(img image.Image, id int) string {
+	var data bytes.Buffer
+	if err := png.Encode(&data, img); err != nil {
+		utils.DebugLog("[ERROR:kittyTransmit] Can't encode image: %v", err)
+		return ""
+	}
+	encoded := base64.StdEncoding.EncodeToString(data.Bytes())
+	var out strings.Builder
+	for i := 0; i < len(encoded); i += 4096 {
+		chunk := encoded[i:min(i+4096, len(encoded))]
+		more := 0
+		if i+4096 < len(encoded) {
+			more = 1
+		}
+		if i == 0 {
+			fmt.Fprintf(&out, "\x1b_Ga=t,f=100,i=%d,q=2,m=%d;%s\x1b\\", id, more, chunk)
+		} else {
+			fmt.Fprintf(&out, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	return out.String()
+}
+
+// encodeSixel writes an image as Sixel graphics with a palette of 256 colors, dithered
+func encodeSixel(img image.Image) string {
+	bounds := img.Bounds()
+	paletted := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette.Plan9)
+	draw.FloydSteinberg.Draw(paletted, paletted.Rect, img, bounds.Min)
+	width, height := paletted.Rect.Dx(), paletted.Rect.Dy()
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "\x1bPq\"1;1;%d;%d", width, height)
+	for i, c := range paletted.Palette {
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(&out, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, b*100/0xffff)
+	}
+
+	// Each band of 6 rows is drawn once per color, a character holds the 6 pixels of a column
+	sixels := make([]byte, width)
+	for band := 0; band < height; band += 6 {
+		used := make([]bool, len(paletted.Palette))
+		for y := band; y < min(band+6, height); y++ {
+			for x := range width {
+				used[paletted.ColorIndexAt(x, y)] = true
+			}
+		}
+		for index, ok := range used {
+			if !ok {
+				continue
+			}
+			for x := range width {
+				bits := byte(0)
+				for dy := range min(6, height-band) {
+					if int(paletted.ColorIndexAt(x, band+dy)) == index {
+						bits |= 1 << dy
+					}
+				}
+				sixels[x] = '?' + bits
+			}
+			fmt.Fprintf(&out, "#%d", index)
+			// Repeated characters are run-length encoded
+			for x := 0; x < width; {
+				n := 1
+				for x+n < width && sixels[x+n] == sixels[x] {
+					n++
+				}
+				if n > 3 {
+					fmt.Fprintf(&out, "!%d%c", n, sixels[x])
+				} else {
+					out.Write(bytes.Repeat([]byte{sixels[x]}, n))
+				}
+				x += n
+			}
+			out.WriteByte('$')
+		}
+		out.WriteByte('-')
+	}
+	out.WriteString("\x1b\\")
+	return out.String()
+}
+
+// scaleImage scales an image to width x height pixels, each pixel is the average of the area it covers
+func scaleImage(img image.Image, width int, height int) *image.RGBA {
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			scaled.SetRGBA(x, y, averageColor(img, x, y, width, height))
+		}
+	}
+	return scaled
+}
+
+// averageColor returns the average color of the area of an image covered by the pixel (x, y)
+// of a grid of cols x rows pixels, the transparent parts are white like a page
+func averageColor(img image.Image, x int, y int, cols int, rows int) color.RGBA {
+	bounds := img.Bounds()
+	x0 := bounds.Min.X + x*bounds.Dx()/cols
+	x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/cols, x0+1)
+	y0 := bounds.Min.Y + y*bounds.Dy()/rows
+	y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/rows, y0+1)
+
+	var r, g, b, n uint64
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			cr, cg, cb, ca := img.At(px, py).RGBA()
+			r += uint64(cr + 0xffff - ca)
+			g += uint64(cg + 0xffff - ca)
+			b += uint64(cb + 0xffff - ca)
+			n++
+		}
+	}
+	return color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: 0xff}
+}
@@ -0,0 +1,259 @@
+package ui
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SearchMode is how the search pattern matches the text, the case is chosen in the pattern:
+// \c ignores it, \C matches it, and without them it's ignored unless the pattern has capitals
+type SearchMode struct {
+	Literal       bool // The pattern is plain text, not a regular expression
+	Fuzzy         bool // The characters of the pattern are found in order with others of the same word between them: "xtrdnry" finds "extraordinary"
+	WholeWord     bool // The matches are whole words
+	IgnoreAccents bool // The letters without accents of the pattern match the accented ones: "cafe" finds "café"
+}
+
+// wordChar is a character of a word: a letter, a digit, an accent or _
+const wordChar = `\p{L}\p{N}\p{Mn}_`
+
+// SearchMatcher finds the matches of a search pattern in the lines of text
+type SearchMatcher struct {
+	re   *regexp.Regexp
+	word *regexp.Regexp // The pattern between word boundaries, the match is its first group
+}
+
+// String returns the regular expression the pattern is compiled to
+func (m *SearchMatcher) String() string {
+	return m.re.String()
+}
+
+// FindAllStringIndex returns the byte ranges of the first n matches of the pattern in a line, all of them if n < 0
+func (m *SearchMatcher) FindAllStringIndex(s string, n int) [][]int {
+	if m.word == nil {
+		return m.re.FindAllStringIndex(s, n)
+	}
+	var matches [][]int
+	// The boundaries are part of the matches, the search goes on at the end of a word
+	// for the character after it to be the boundary before the next one
+	for pos := 0; pos <= len(s) && (n < 0 || len(matches) < n); {
+		loc := m.word.FindStringSubmatchIndex(s[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[2], pos+loc[3]
+		if start == end {
+			// Empty matches can't be shown, the search goes on after the boundary
+			pos += max(loc[1], 1)
+			continue
+		}
+		matches = append(matches, []int{start, end})
+		pos = end
+	}
+	return matches
+}
+
+// MatchString checks if a line holds a match of the pattern
+func (m *SearchMatcher) MatchString(s string) bool {
+	return len(m.FindAllStringIndex(s, 1)) > 0
+}
+
+// searchCase returns a pattern without its \c and \C flags, if its case is ignored
+// (with \c, or without \C and capitals) and if a flag chose it
+func searchCase(pattern string, literal bool) (string, bool, bool) {
+	var b strings.Builder
+	ignore, flag := true, false
+	hasCapital := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '\\' || i+1 == len(pattern) {
+			b.WriteByte(c)
+			continue
+		}
+		switch pattern[i+1] {
+		case 'c':
+			ignore, flag = true, true
+		case 'C':
+			ignore, flag = false, true
+		default:
+			// The capitals of the escapes of regular expressions (\S, \W...) don't count
+			b.WriteString(pattern[i : i+2])
+			if literal && unicode.IsUpper(rune(pattern[i+1])) {
+				hasCapital = true
+			}
+		}
+		i++
+	}
+	pattern = b.String()
+	if flag {
+		return pattern, ignore, true
+	}
+	for i, r := range pattern {
+		if unicode.IsUpper(r) && (literal || i == 0 || pattern[i-1] != '\\') {
+			hasCapital = true
+		}
+	}
+	return pattern, !hasCapital, false
+}
+
+// SearchModeText describes how a search pattern matches the text: "regex, smart case"...
+func SearchModeText(pattern string, mode SearchMode) string {
+	parts := []string{"regex"}
+	if mode.Fuzzy {
+		parts[0] = "fuzzy"
+	} else if mode.Literal {
+		parts[0] = "literal"
+	}
+	switch _, ignoreCase, flag := searchCase(pattern, mode.Literal || mode.Fuzzy); {
+	case !flag:
+		parts = append(parts, "smart case")
+	case ignoreCase:
+		parts = append(parts, "ignore case")
+	default:
+		parts = append(parts, "match case")
+	}
+	if mode.WholeWord {
+		parts = append(parts, "whole word")
+	}
+	if mode.IgnoreAccents {
+		parts = append(parts, "ignore accents")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CompileSearch compiles a search pattern for a search mode, a fuzzy pattern is plain text
+func CompileSearch(pattern string, mode SearchMode) (*SearchMatcher, error) {
+	pattern, ignoreCase, _ := searchCase(pattern, mode.Literal || mode.Fuzzy)
+	flags := syntax.Perl
+	if mode.Literal || mode.Fuzzy {
+		flags |= syntax.Literal
+	}
+	if ignoreCase {
+		flags |= syntax.FoldCase
+	}
+	tree, err := syntax.Parse(pattern, flags)
+	if err != nil {
+		return nil, err
+	}
+	if mode.Fuzzy {
+		tree = fuzzyPattern(tree)
+	}
+	if mode.IgnoreAccents {
+		tree = ignoreAccents(tree)
+	}
+	re, err := regexp.Compile(tree.String())
+	if err != nil {
+		return nil, err
+	}
+	m := &SearchMatcher{re: re}
+	if mode.WholeWord {
+		// Regular expressions have no lookaround, the boundaries are matched with the pattern
+		m.word, err = regexp.Compile(`(?:^|[^` + wordChar + `])(` + tree.String() + `)(?:[^` + wordChar + `]|$)`)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// CompileSearch compiles the search pattern for the search mode
+func (ui *UI) CompileSearch() (*SearchMatcher, error) {
+	return CompileSearch(ui.SearchPattern, ui.SearchMode)
+}
+
+// fuzzyPattern lets characters other than spaces go between the characters of a literal pattern,
+// as few as possible
+func fuzzyPattern(re *syntax.Regexp) *syntax.Regexp {
+	if re.Op != syntax.OpLiteral || len(re.Rune) < 2 {
+		return re
+	}
+	var subs []*syntax.Regexp
+	for i, r := range re.Rune {
+		if i > 0 {
+			gap, err := syntax.Parse(`\S*?`, syntax.Perl)
+			if err != nil {
+				return re
+			}
+			subs = append(subs, gap)
+		}
+		subs = append(subs, &syntax.Regexp{Op: syntax.OpLiteral, Flags: re.Flags, Rune: []rune{r}})
+	}
+	return &syntax.Regexp{Op: syntax.OpConcat, Flags: re.Flags, Sub: subs}
+}
+
+// accentedLetters returns the accented forms of the letters without accents, made once they're needed:
+// the Latin letters decomposed into the letter and accents, and a few letters with strokes
+var accentedLetters = sync.OnceValue(func() map[rune][]rune {
+	letters := map[rune][]rune{
+		'd': {'đ', 'ð'}, 'D': {'Đ', 'Ð'}, 'h': {'ħ'}, 'H': {'Ħ'}, 'i': {'ı'},
+		'l': {'ł'}, 'L': {'Ł'}, 'o': {'ø'}, 'O': {'Ø'},
+	}
+	for _, block := range [][2]rune{{0xc0, 0x24f}, {0x1e00, 0x1eff}} {
+		for r := block[0]; r <= block[1]; r++ {
+			decomposed := norm.NFD.String(string(r))
+			base, size := utf8.DecodeRuneInString(decomposed)
+			if size < len(decomposed) && base < utf8.RuneSelf && unicode.IsLetter(base) {
+				letters[base] = append(letters[base], r)
+			}
+		}
+	}
+	return letters
+})
+
+// ignoreAccents makes the letters without accents of a parsed pattern match their accented forms,
+// written as one character or as the letter followed by combining accents (U+0300-U+036F)
+func ignoreAccents(re *syntax.Regexp) *syntax.Regexp {
+	for i, sub := range re.Sub {
+		re.Sub[i] = ignoreAccents(sub)
+	}
+	if re.Op != syntax.OpLiteral {
+		return re
+	}
+
+	var subs []*syntax.Regexp
+	var literal []rune // Runes without accented forms, kept as a literal
+	flush := func() {
+		if len(literal) > 0 {
+			subs = append(subs, &syntax.Regexp{Op: syntax.OpLiteral, Flags: re.Flags, Rune: literal})
+			literal = nil
+		}
+	}
+	for _, r := range re.Rune {
+		forms := []rune{r}
+		if re.Flags&syntax.FoldCase != 0 {
+			forms = []rune{unicode.ToLower(r), unicode.ToUpper(r)}
+		}
+		class, accented := "", false
+		for _, form := range forms {
+			if !strings.ContainsRune(class, form) {
+				class += string(form)
+			}
+			for _, a := range accentedLetters()[form] {
+				class += string(a)
+				accented = true
+			}
+		}
+		if !accented {
+			literal = append(literal, r)
+			continue
+		}
+		flush()
+		letter, err := syntax.Parse("["+class+`][\x{300}-\x{36f}]*`, syntax.Perl)
+		if err != nil {
+			literal = append(literal, r)
+			continue
+		}
+		subs = append(subs, letter)
+	}
+	flush()
+	if len(subs) == 1 {
+		return subs[0]
+	}
+	return &syntax.Regexp{Op: syntax.OpConcat, Flags: re.Flags, Sub: subs}
+}
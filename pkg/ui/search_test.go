@@ -0,0 +1,78 @@
+package ui
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompileSearch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		mode    SearchMode
+		text    string
+		want    []string // Matches found
+	}{
+		{pattern: "cafe", text: "cafe Cafe café", want: []string{"cafe", "Cafe"}},
+		{pattern: "Cafe", text: "cafe Cafe", want: []string{"Cafe"}},           // Smart case
+		{pattern: `\Ccafe`, text: "cafe Cafe", want: []string{"cafe"}},         // Match case
+		{pattern: `Cafe\c`, text: "cafe Cafe", want: []string{"cafe", "Cafe"}}, // Ignore case
+		{pattern: "f(x)", text: "f(x) fx", want: []string{"fx"}},               // Regular expression
+		{pattern: "f(x)", mode: SearchMode{Literal: true}, text: "f(x) fx", want: []string{"f(x)"}},
+		{pattern: "C++", mode: SearchMode{Literal: true}, text: "C++ c++", want: []string{"C++"}},
+		{pattern: `\S+`, mode: SearchMode{Literal: true}, text: `a \S+ b`, want: []string{`\S+`}},
+		{pattern: "cafe", mode: SearchMode{IgnoreAccents: true}, text: "cafe café Café café", want: []string{"cafe", "café", "Café", "café"}},
+		{pattern: "cafe", mode: SearchMode{WholeWord: true}, text: "cafe cafeteria café", want: []string{"cafe"}},
+		{pattern: "cafe", mode: SearchMode{WholeWord: true}, text: "cafeteria, cafe", want: []string{"cafe"}},
+		{pattern: "foo", mode: SearchMode{WholeWord: true}, text: "foo foo,foo", want: []string{"foo", "foo", "foo"}},
+		{pattern: "foo|foobar", mode: SearchMode{WholeWord: true}, text: "foobar foo", want: []string{"foobar", "foo"}},
+		{pattern: "caf", mode: SearchMode{WholeWord: true, IgnoreAccents: true}, text: "café caf", want: []string{"caf"}},
+		{pattern: "été", mode: SearchMode{WholeWord: true}, text: "étés été", want: []string{"été"}},
+		{pattern: "xtrdnry", mode: SearchMode{Fuzzy: true}, text: "an extraordinary day", want: []string{"xtraordinary"}},
+		{pattern: "xtrdnry", mode: SearchMode{Fuzzy: true}, text: "extra ordinary", want: nil}, // The gaps don't go over spaces
+		{pattern: "fo br", mode: SearchMode{Fuzzy: true}, text: "foo bar", want: []string{"foo bar"}},
+		{pattern: "f(x", mode: SearchMode{Fuzzy: true}, text: "f(ax) f(x", want: []string{"f(ax", "f(x"}},
+		{pattern: "cf", mode: SearchMode{Fuzzy: true, WholeWord: true}, text: "cafe cf", want: []string{"cf"}},
+		{pattern: "cfe", mode: SearchMode{Fuzzy: true, IgnoreAccents: true}, text: "Café", want: []string{"Café"}},
+	}
+	for _, tt := range tests {
+		m, err := CompileSearch(tt.pattern, tt.mode)
+		if err != nil {
+			t.Errorf("CompileSearch(%q, %+v): %v", tt.pattern, tt.mode, err)
+			continue
+		}
+		var got []string
+		for _, match := range m.FindAllStringIndex(tt.text, -1) {
+			got = append(got, tt.text[match[0]:match[1]])
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q %+v in %q: matches %q, want %q", tt.pattern, tt.mode, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCompileSearchInvalid(t *testing.T) {
+	if _, err := CompileSearch("f(x", SearchMode{}); err == nil {
+		t.Error("CompileSearch(\"f(x\") compiled an invalid regular expression")
+	}
+	if _, err := CompileSearch("f(x", SearchMode{Literal: true}); err != nil {
+		t.Errorf("CompileSearch(\"f(x\", literal): %v", err)
+	}
+}
+
+func TestSearchModeText(t *testing.T) {
+	tests := []struct {
+		pattern string
+		mode    SearchMode
+		want    string
+	}{
+		{pattern: "abc", want: "regex, smart case"},
+		{pattern: `abc\C`, mode: SearchMode{Literal: true}, want: "literal, match case"},
+		{pattern: `\cABC`, mode: SearchMode{WholeWord: true, IgnoreAccents: true}, want: "regex, ignore case, whole word, ignore accents"},
+		{pattern: "Abc", mode: SearchMode{Literal: true, Fuzzy: true}, want: "fuzzy, smart case"},
+	}
+	for _, tt := range tests {
+		if got := SearchModeText(tt.pattern, tt.mode); got != tt.want {
+			t.Errorf("SearchModeText(%q, %+v) = %q, want %q", tt.pattern, tt.mode, got, tt.want)
+		}
+	}
+}
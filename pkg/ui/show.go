@@ -1,40 +1,69 @@
 package ui
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/ray-d-song/goread/pkg/utils"
 	"github.com/rivo/tview"
 )
 
-// ShowMetadata shows the metadata
-func (ui *UI) ShowMetadata(metadata [][]string) error {
+// MetadataGroup is a titled group of metadata entries, each entry is a [name, value] pair
+type MetadataGroup struct {
+	Name  string
+	Items [][]string
+}
+
+// ShowMetadata shows the metadata grouped by topic (titles, creators, identifiers, ...)
+func (ui *UI) ShowMetadata(groups []MetadataGroup) error {
 	table := tview.NewTable().
 		SetBorders(false).
 		SetSelectable(false, false)
 
-	if len(metadata) == 0 {
-		table.SetCell(0, 0, tview.NewTableCell("No metadata found").
-			SetTextColor(tcell.ColorRed).
-			SetAlign(tview.AlignCenter).
+	row := 0
+	for _, group := range groups {
+		if len(group.Items) == 0 {
+			continue
+		}
+
+		// Separate the groups with an empty row
+		if row > 0 {
+			table.SetCell(row, 0, tview.NewTableCell(""))
+			row++
+		}
+
+		table.SetCell(row, 0, tview.NewTableCell(group.Name).
+			SetTextColor(tcell.ColorDarkCyan).
+			SetAttributes(tcell.AttrBold).
+			SetAlign(tview.AlignLeft).
 			SetExpansion(1))
-		table.SetCell(0, 1, tview.NewTableCell("").
-			SetTextColor(tcell.ColorRed).
-			SetAlign(tview.AlignCenter).
-			SetExpansion(2))
-	} else {
+		row++
 
-		for i, item := range metadata {
-			table.SetCell(i, 0, tview.NewTableCell(item[0]).
+		for _, item := range group.Items {
+			table.SetCell(row, 0, tview.NewTableCell("  "+item[0]).
 				SetTextColor(tcell.ColorYellow).
 				SetAlign(tview.AlignLeft).
 				SetExpansion(1))
-			table.SetCell(i, 1, tview.NewTableCell(item[1]).
+			table.SetCell(row, 1, tview.NewTableCell(item[1]).
 				SetTextColor(tcell.ColorWhite).
 				SetAlign(tview.AlignLeft).
 				SetExpansion(2))
+			row++
 		}
 	}
 
+	if row == 0 {
+		table.SetCell(0, 0, tview.NewTableCell("No metadata found").
+			SetTextColor(tcell.ColorRed).
+			SetAlign(tview.AlignCenter).
+			SetExpansion(1))
+		table.SetCell(0, 1, tview.NewTableCell("").
+			SetTextColor(tcell.ColorRed).
+			SetAlign(tview.AlignCenter).
+			SetExpansion(2))
+	}
+
 	switch ui.ColorScheme {
 	case DefaultColorScheme:
 		table.SetBackgroundColor(tcell.ColorDefault)
@@ -89,6 +118,66 @@ func (ui *UI) ShowMetadata(metadata [][]string) error {
 	return nil
 }
 
+// ShowNote shows the text of a footnote or an endnote
+// goTo is called when the user asks to read the note in the book
+func (ui *UI) ShowNote(title string, lines []string, goTo func()) error {
+	noteView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWordWrap(true)
+	noteView.SetText(fmt.Sprintf("[::b]%s[::-]\n\n%s\n\n[::d]g: go to the note, Esc: close[::-]",
+		tview.Escape(title), strings.Join(lines, "\n")))
+
+	switch ui.ColorScheme {
+	case DefaultColorScheme:
+		noteView.SetBackgroundColor(tcell.ColorDefault)
+		noteView.SetTextColor(tcell.ColorDefault)
+	case DarkColorScheme:
+		noteView.SetBackgroundColor(tcell.ColorDarkSlateGray)
+		noteView.SetTextColor(tcell.ColorWhite)
+	case LightColorScheme:
+		noteView.SetBackgroundColor(tcell.ColorWhite)
+		noteView.SetTextColor(tcell.ColorBlack)
+	}
+
+	resetContent := ui.SetTempContent(noteView)
+	ui.App.SetFocus(noteView)
+
+	var resetCapture func()
+	resetCapture = ui.SetCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape, tcell.KeyEnter:
+			resetCapture()
+			resetContent()
+			return nil
+		case tcell.KeyUp, tcell.KeyDown, tcell.KeyPgUp, tcell.KeyPgDn:
+			// Allow scrolling in long notes
+			return event
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'q':
+				resetCapture()
+				resetContent()
+				return nil
+			case 'g':
+				resetCapture()
+				resetContent()
+				if goTo != nil {
+					goTo()
+				}
+				return nil
+			case 'j':
+				return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+			case 'k':
+				return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+			}
+		}
+		// Block all other keys
+		return nil
+	})
+
+	return nil
+}
+
 // ShowHelp shows the help screen
 func (ui *UI) ShowHelp() error {
 	helpText := `
@@ -98,6 +187,8 @@ Key Bindings:
     Help             : ?
     Quit             : q
     ToC              : t
+    Landmarks        : L
+    Go to print page : p
     Next chapter     : n
     Prev chapter     : N
     Search           : /
@@ -111,7 +202,26 @@ Key Bindings:
     Increase width   : +
     Decrease width   : -
     Metadata         : m
+    Footnotes        : F
+    Follow link      : f
+    Jump back        : C-o
+    Jump forward     : C-i
+    Renditions       : R
+    Cover            : v
     Switch colorsch  : c
+    Ruby display     : r
+    Justify          : J
+    Hyphenation      : H
+    Inline images    : i
+
+In the search prompt (/):
+    Literal text     : C-l
+    Fuzzy            : C-f
+    Whole word       : C-w
+    Ignore accents   : C-d
+    Ignore case      : \c in the pattern
+    Match case       : \C in the pattern
+    Without them the case is ignored unless the pattern has capitals
 		
 Press Esc or Enter to close
 `
@@ -193,11 +303,25 @@ Press Esc or Enter to close
 // ShowSearch shows the search dialog in VIM style
 func (ui *UI) ShowSearch(cb func()) error {
 	utils.DebugLog("[INFO:ShowSearch] Showing search dialog")
-	// Save the current search pattern
+	// Save the current search pattern and mode
 	originalSearchPattern := ui.SearchPattern
+	originalSearchMode := ui.SearchMode
+
+	// Show the search mode in the prompt, in red when the pattern is invalid
+	labelStyle := ui.SearchInput.GetLabelStyle()
+	showMode := func(text string) {
+		ui.SearchInput.SetLabel(fmt.Sprintf("(%s) /", SearchModeText(text, ui.SearchMode)))
+		if _, err := CompileSearch(text, ui.SearchMode); err != nil && text != "" {
+			ui.SearchInput.SetLabelColor(tcell.ColorRed)
+		} else {
+			ui.SearchInput.SetLabelStyle(labelStyle)
+		}
+	}
+	ui.SearchInput.SetChangedFunc(showMode)
 
 	// Set the initial search text
 	ui.SearchInput.SetText(ui.SearchPattern)
+	showMode(ui.SearchPattern)
 
 	resetStatus := ui.SetTempStatus(ui.SearchInput)
 
@@ -219,10 +343,21 @@ func (ui *UI) ShowSearch(cb func()) error {
 		case tcell.KeyRune:
 			// Allow text input
 			return event
+		case tcell.KeyCtrlL:
+			ui.SearchMode.Literal = !ui.SearchMode.Literal
+		case tcell.KeyCtrlF:
+			ui.SearchMode.Fuzzy = !ui.SearchMode.Fuzzy
+		case tcell.KeyCtrlW:
+			ui.SearchMode.WholeWord = !ui.SearchMode.WholeWord
+		case tcell.KeyCtrlD:
+			ui.SearchMode.IgnoreAccents = !ui.SearchMode.IgnoreAccents
 		default:
 			// Block all other keys
 			return nil
 		}
+		// The search mode was toggled
+		showMode(ui.SearchInput.GetText())
+		return nil
 	})
 
 	// Set the completion function for the search input
@@ -242,8 +377,9 @@ func (ui *UI) ShowSearch(cb func()) error {
 				cb()
 			}
 		} else if key == tcell.KeyEscape {
-			// Cancel search, restore the original search pattern
+			// Cancel search, restore the original search pattern and mode
 			ui.SearchPattern = originalSearchPattern
+			ui.SearchMode = originalSearchMode
 			ui.IsSearchMode = false
 
 			// Restore the original input capture function
@@ -255,3 +391,96 @@ func (ui *UI) ShowSearch(cb func()) error {
 
 	return nil
 }
+
+// ShowLinkSelect shows an input dialog for entering the number of a link on the screen
+// The callback gets 0 if the selection is cancelled
+func (ui *UI) ShowLinkSelect(first int, last int, callback func(int)) error {
+	linkInput := tview.NewInputField().
+		SetLabel(fmt.Sprintf("Follow link (%d-%d): ", first, last)).
+		SetFieldWidth(0).
+		SetFieldBackgroundColor(tcell.ColorDefault).
+		SetAcceptanceFunc(tview.InputFieldInteger)
+
+	resetStatus := ui.SetTempStatus(linkInput)
+
+	// Explicitly set focus to the link input
+	ui.App.SetFocus(linkInput)
+
+	resetCapture := ui.SetCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEnter, tcell.KeyEscape:
+			// Let these keys be handled by the input field's DoneFunc
+			return event
+		case tcell.KeyBackspace, tcell.KeyBackspace2, tcell.KeyDelete,
+			tcell.KeyLeft, tcell.KeyRight:
+			return event
+		case tcell.KeyRune:
+			if event.Rune() >= '0' && event.Rune() <= '9' {
+				return event
+			}
+			return nil
+		default:
+			// Block all other keys
+			return nil
+		}
+	})
+
+	linkInput.SetDoneFunc(func(key tcell.Key) {
+		// Restore the original input capture function and status bar first,
+		// the callback may set a new status
+		resetCapture()
+		resetStatus()
+
+		num := 0
+		if key == tcell.KeyEnter {
+			fmt.Sscanf(linkInput.GetText(), "%d", &num)
+		}
+		callback(num)
+	})
+
+	return nil
+}
+
+// ShowPageSelect shows an input dialog for entering a page number of the print edition
+// Page labels are not always numbers (e.g. roman numerals in the front matter)
+func (ui *UI) ShowPageSelect(first string, last string, callback func(string)) error {
+	pageInput := tview.NewInputField().
+		SetLabel(fmt.Sprintf("Go to page (%s-%s): ", first, last)).
+		SetFieldWidth(0).
+		SetFieldBackgroundColor(tcell.ColorDefault)
+
+	resetStatus := ui.SetTempStatus(pageInput)
+
+	// Explicitly set focus to the page input
+	ui.App.SetFocus(pageInput)
+
+	resetCapture := ui.SetCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEnter, tcell.KeyEscape:
+			// Let these keys be handled by the input field's DoneFunc
+			return event
+		case tcell.KeyBackspace, tcell.KeyBackspace2, tcell.KeyDelete,
+			tcell.KeyLeft, tcell.KeyRight, tcell.KeyRune:
+			return event
+		default:
+			// Block all other keys
+			return nil
+		}
+	})
+
+	pageInput.SetDoneFunc(func(key tcell.Key) {
+		// Restore the original input capture function and status bar first,
+		// the callback may set a new status
+		resetCapture()
+		resetStatus()
+
+		if key == tcell.KeyEnter {
+			callback(strings.TrimSpace(pageInput.GetText()))
+		} else if key == tcell.KeyEscape {
+			// Empty string indicates cancellation
+			callback("")
+		}
+	})
+
+	return nil
+}
@@ -1,12 +1,14 @@
 package ui
 
 import (
+	"image"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 	"os/exec"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/ray-d-song/goread/pkg/parser"
 	"github.com/ray-d-song/goread/pkg/utils"
 	"github.com/rivo/tview"
 )
@@ -38,10 +40,26 @@ type UI struct {
 	Width         int
 	JumpList      map[rune][4]interface{} // [index, width, pos, pctg]
 	SearchPattern string
-	Images        []string                            // Images in the current chapter
+	SearchMode    SearchMode                          // How the search pattern matches the text
+	Images        []parser.Image                      // Images in the current chapter
 	IsSearchMode  bool                                // Mark if the search mode is active
 	CountPrefix   int                                 // Numeric prefix for commands like [count]=
 	ReadChapter   func(index int, pctg float64) error // Chapter to jump to
+	Resized       func()                              // Called after the terminal is resized
+
+	ImageProtocol ImageProtocol                     // How the images are drawn in the text
+	ImageBoxes    []parser.ImageBox                 // Images drawn over the lines of the current chapter
+	ImagePaths    []string                          // Archive paths of Images
+	ReadImage     func(path string) ([]byte, error) // Reads an image of the book
+
+	decoded      map[string]image.Image    // Images decoded, nil when they can't be
+	scaled       map[scaledKey]*image.RGBA // Last images scaled for drawing
+	sequences    map[imagePlacement]string // Last escape sequences drawing the images
+	kittyImages  map[string]kittyImage     // Images sent to Kitty
+	placed       []imagePlacement          // Images written to the terminal
+	placedScreen [2]int                    // Size of the screen they were written to
+	viewer       *imageViewer              // Image viewer on the screen, nil without one
+	screenSize   [2]int                    // Size of the screen at the last draw
 }
 
 // NewUI creates a new UI instance
@@ -50,7 +68,8 @@ func NewUI() *UI {
 	textArea := tview.NewTextView().
 		SetDynamicColors(true).
 		SetRegions(true).
-		SetWordWrap(true).
+		// The chapters are wrapped when they're laid out, each line is a row
+		SetWrap(false).
 		SetChangedFunc(func() {
 			app.Draw()
 		})
@@ -76,6 +95,12 @@ func NewUI() *UI {
 		JumpList:     make(map[rune][4]interface{}),
 		IsSearchMode: false,
 		CountPrefix:  0,
+
+		ImageProtocol: DetectImageProtocol(),
+		decoded:       make(map[string]image.Image),
+		scaled:        make(map[scaledKey]*image.RGBA),
+		sequences:     make(map[imagePlacement]string),
+		kittyImages:   make(map[string]kittyImage),
 	}
 
 	// container, full screen
@@ -101,6 +126,8 @@ func NewUI() *UI {
 		AddItem(rightPanel, 0, 1, false)
 
 	app.SetRoot(container, true)
+	app.SetBeforeDrawFunc(ui.checkResize)
+	app.SetAfterDrawFunc(ui.drawImages)
 	ui.Container = container
 	ui.Horizontal = horizontal
 	ui.Content = content
@@ -116,9 +143,40 @@ func (ui *UI) ReRender() {
 // SetWidth this func actually sets the width of the goread window
 func (ui *UI) SetWidth(width int) {
 	if width > 0 {
-		ui.Horizontal.ResizeItem(ui.Content, width, 0)
 		ui.Width = width
+		ui.Horizontal.ResizeItem(ui.Content, ui.TextWidth(), 0)
+	}
+}
+
+// TextWidth returns the width the text is laid out for, the width of the window
+// without what the terminal cuts
+func (ui *UI) TextWidth() int {
+	if termWidth, _ := utils.GetTermSize(); termWidth > 0 {
+		return min(ui.Width, termWidth)
 	}
+	return ui.Width
+}
+
+// checkResize fits the window to the screen when the terminal is resized and calls Resized,
+// after the draw, for the text to be laid out again
+func (ui *UI) checkResize(screen tcell.Screen) bool {
+	width, height := screen.Size()
+	size := [2]int{width, height}
+	if size == ui.screenSize {
+		return false
+	}
+	first := ui.screenSize == [2]int{}
+	ui.screenSize = size
+	if first {
+		return false
+	}
+	utils.DebugLog("[INFO:checkResize] Screen resized to %dx%d", width, height)
+	ui.Container.ResizeItem(ui.Horizontal, height, 0)
+	if ui.Resized != nil {
+		// The draw holds the lock of the application
+		go ui.App.QueueUpdateDraw(ui.Resized)
+	}
+	return false
 }
 
 // SetCapture sets the input capture function
@@ -167,6 +225,46 @@ func (ui *UI) CycleColorScheme() {
 	ui.SetColorScheme((ui.ColorScheme + 1) % 3)
 }
 
+// CodeColors returns the colors of the highlighted code for the color scheme
+func (ui *UI) CodeColors() parser.CodeColors {
+	switch ui.ColorScheme {
+	case DarkColorScheme:
+		return parser.CodeColors{
+			parser.TokenKeyword:  "#ff79c6",
+			parser.TokenType:     "#8be9fd",
+			parser.TokenConstant: "#bd93f9",
+			parser.TokenString:   "#f1fa8c",
+			parser.TokenNumber:   "#ffb86c",
+			parser.TokenComment:  "#a3b8b8",
+			parser.TokenFunction: "#50fa7b",
+			parser.TokenName:     "#ffd7af",
+		}
+	case LightColorScheme:
+		return parser.CodeColors{
+			parser.TokenKeyword:  "#a626a4",
+			parser.TokenType:     "#0184bc",
+			parser.TokenConstant: "#986801",
+			parser.TokenString:   "#50a14f",
+			parser.TokenNumber:   "#986801",
+			parser.TokenComment:  "#7f848e",
+			parser.TokenFunction: "#4078f2",
+			parser.TokenName:     "#e45649",
+		}
+	default:
+		// The terminal's own palette stays readable on its background
+		return parser.CodeColors{
+			parser.TokenKeyword:  "purple",
+			parser.TokenType:     "teal",
+			parser.TokenConstant: "maroon",
+			parser.TokenString:   "green",
+			parser.TokenNumber:   "olive",
+			parser.TokenComment:  "gray",
+			parser.TokenFunction: "blue",
+			parser.TokenName:     "teal",
+		}
+	}
+}
+
 // SetStatus sets the status bar text
 func (ui *UI) SetStatus(text string) {
 	ui.StatusBar.Clear()
@@ -246,8 +344,8 @@ func (ui *UI) SetTempContent(view tview.Primitive) func() {
 
 		// restore the original width if it was set
 		if originalWidth > 0 {
-			ui.Horizontal.ResizeItem(originalContent, originalWidth, 0)
 			ui.Width = originalWidth
+			ui.Horizontal.ResizeItem(originalContent, ui.TextWidth(), 0)
 		}
 	}
 }
@@ -0,0 +1,395 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"math"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/ray-d-song/goread/pkg/parser"
+	"github.com/rivo/tview"
+)
+
+// Zoom of the image viewer, the zoom 1 fits the image in the view
+const (
+	zoomStep = 1.25
+	minZoom  = 0.25
+	maxZoom  = 16
+)
+
+// ViewerImage is an image shown by the image viewer
+type ViewerImage struct {
+	Path    string       // Archive path of the image
+	Chapter string       // Title of the chapter holding it
+	Image   parser.Image // Text describing the image
+}
+
+// imageViewer shows an image of the book, zoomed and moved around
+type imageViewer struct {
+	*tview.Box
+	ui        *UI
+	images    []ViewerImage
+	current   int
+	zoom      float64
+	centerX   float64 // Point of the image at the center of the view,
+	centerY   float64 // as fractions of its width and height
+	textColor tcell.Color
+	metadata  map[string][]string // Lines describing the images that can't be drawn
+}
+
+// viewerLayout is the part of the current image shown by the viewer and where it is
+type viewerLayout struct {
+	decoded          bool            // The image can be drawn
+	inView           bool            // The view has room for it
+	x, y             int             // Cell of the top left corner of the view
+	width, height    int             // Size of the view, in cells
+	cellW, cellH     int             // Size of a cell, in pixels
+	bounds           image.Rectangle // Pixels of the image
+	scale            float64         // Screen pixels per pixel of the image
+	shownW, shownH   float64         // Size of the part shown, in pixels of the image
+	shownX, shownY   float64         // Size of the part shown, as fractions of the size of the image
+	centerX, centerY float64         // Center of the part shown, kept in the image
+}
+
+// layout returns where the part shown of the current image is in the view
+func (v *imageViewer) layout() viewerLayout {
+	var l viewerLayout
+	l.x, l.y, l.width, l.height = v.GetInnerRect()
+	img := v.ui.loadImage(v.images[v.current].Path)
+	if img == nil || img.Bounds().Empty() {
+		return l
+	}
+	l.decoded = true
+	if l.width <= 0 || l.height <= 0 {
+		return l
+	}
+	l.inView = true
+	l.bounds = img.Bounds()
+	l.cellW, l.cellH = cellSize()
+	viewW, viewH := float64(l.width*l.cellW), float64(l.height*l.cellH)
+	l.scale = min(viewW/float64(l.bounds.Dx()), viewH/float64(l.bounds.Dy())) * v.zoom
+	l.shownW = min(float64(l.bounds.Dx()), viewW/l.scale)
+	l.shownH = min(float64(l.bounds.Dy()), viewH/l.scale)
+	l.shownX, l.shownY = l.shownW/float64(l.bounds.Dx()), l.shownH/float64(l.bounds.Dy())
+	l.centerX = min(max(v.centerX, l.shownX/2), 1-l.shownX/2)
+	l.centerY = min(max(v.centerY, l.shownY/2), 1-l.shownY/2)
+	return l
+}
+
+// placement returns the part of the current image drawn on the screen, ok is false
+// when it can't be drawn
+func (v *imageViewer) placement() (imagePlacement, bool) {
+	l := v.layout()
+	if !l.inView {
+		return imagePlacement{}, false
+	}
+	left := float64(l.bounds.Min.X) + l.centerX*float64(l.bounds.Dx()) - l.shownW/2
+	top := float64(l.bounds.Min.Y) + l.centerY*float64(l.bounds.Dy()) - l.shownH/2
+	crop := image.Rect(int(math.Round(left)), int(math.Round(top)),
+		int(math.Round(left+l.shownW)), int(math.Round(top+l.shownH))).Intersect(l.bounds)
+	if crop.Empty() {
+		return imagePlacement{}, false
+	}
+	cols := min(max(int(math.Round(l.shownW*l.scale/float64(l.cellW))), 1), l.width)
+	rows := min(max(int(math.Round(l.shownH*l.scale/float64(l.cellH))), 1), l.height)
+	return imagePlacement{
+		path: v.images[v.current].Path,
+		x:    l.x + (l.width-cols)/2,
+		y:    l.y + (l.height-rows)/2,
+		cols: cols,
+		rows: rows,
+		crop: crop,
+	}, true
+}
+
+// Draw draws the view, the image is drawn after the screen, the lines describing it
+// when it can't be decoded
+func (v *imageViewer) Draw(screen tcell.Screen) {
+	v.Box.DrawForSubclass(screen, v)
+	if v.layout().decoded {
+		return
+	}
+	x, y, width, height := v.GetInnerRect()
+	lines := v.describe(v.images[v.current].Path)
+	top := y + max((height-len(lines))/2, 0)
+	for i, line := range lines {
+		if top+i >= y+height {
+			break
+		}
+		tview.Print(screen, tview.Escape(line), x, top+i, width, tview.AlignCenter, v.textColor)
+	}
+}
+
+// describe returns lines telling what an image that can't be drawn is: its type, size in bytes and
+// dimensions, the title of SVG images
+// The lines are made once per image
+func (v *imageViewer) describe(imagePath string) []string {
+	if lines, ok := v.metadata[imagePath]; ok {
+		return lines
+	}
+	lines := []string{path.Base(imagePath), ""}
+	var data []byte
+	var err error
+	if v.ui.ReadImage != nil {
+		data, err = v.ui.ReadImage(imagePath)
+	}
+	if data == nil {
+		lines = append(lines, fmt.Sprintf("Can't read the image: %v", err))
+		v.metadata[imagePath] = lines
+		return lines
+	}
+
+	kind := mime.TypeByExtension(path.Ext(imagePath))
+	if kind == "" {
+		kind = http.DetectContentType(data)
+	}
+	lines = append(lines, "Type: "+kind, "Size: "+formatBytes(len(data)))
+	if config, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		lines = append(lines, fmt.Sprintf("Dimensions: %dx%d (%s)", config.Width, config.Height, format))
+	} else if strings.HasPrefix(kind, "image/svg") {
+		lines = append(lines, svgMetadata(data)...)
+	}
+	lines = append(lines, "", "This image can't be drawn here, press o to open it")
+	v.metadata[imagePath] = lines
+	return lines
+}
+
+// svgMetadata returns lines with the dimensions, the view box and the title of an SVG image
+func svgMetadata(data []byte) []string {
+	var lines []string
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	depth := 0
+	inTitle := false // In the title of the image, not the ones of its parts
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return lines
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 1 && t.Name.Local == "svg":
+				attrs := make(map[string]string)
+				for _, attr := range t.Attr {
+					attrs[attr.Name.Local] = attr.Value
+				}
+				if attrs["width"] != "" || attrs["height"] != "" {
+					lines = append(lines, fmt.Sprintf("Dimensions: %s x %s", attrs["width"], attrs["height"]))
+				}
+				if attrs["viewBox"] != "" {
+					lines = append(lines, "View box: "+attrs["viewBox"])
+				}
+			case depth == 2 && t.Name.Local == "title":
+				inTitle = true
+			}
+		case xml.CharData:
+			if inTitle {
+				if title := strings.Join(strings.Fields(string(t)), " "); title != "" {
+					return append(lines, "Title: "+title)
+				}
+			}
+		case xml.EndElement:
+			depth--
+			inTitle = false
+		}
+	}
+}
+
+// formatBytes writes a number of bytes in B, KB or MB
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// show shows an image of the list, fitted in the view
+func (v *imageViewer) show(index int) {
+	v.current = index
+	v.zoom = 1
+	v.centerX, v.centerY = 0.5, 0.5
+}
+
+// pan moves the part shown by a quarter of it
+func (v *imageViewer) pan(dx float64, dy float64) {
+	l := v.layout()
+	if !l.inView {
+		return
+	}
+	v.centerX = min(max(l.centerX+dx*l.shownX/4, l.shownX/2), 1-l.shownX/2)
+	v.centerY = min(max(l.centerY+dy*l.shownY/4, l.shownY/2), 1-l.shownY/2)
+}
+
+// nextChapter returns the first image of the next (or previous, step -1) chapter holding images,
+// -1 without one
+func (v *imageViewer) nextChapter(step int) int {
+	chapter := v.images[v.current].Chapter
+	for i := v.current + step; i >= 0 && i < len(v.images); i += step {
+		if v.images[i].Chapter == chapter {
+			continue
+		}
+		// The first image of the chapter
+		for step < 0 && i > 0 && v.images[i-1].Chapter == v.images[i].Chapter {
+			i--
+		}
+		return i
+	}
+	return -1
+}
+
+// info returns the text under the image: its number, chapter, zoom, caption and alternative text
+func (v *imageViewer) info() string {
+	shown := v.images[v.current]
+	var b strings.Builder
+	fmt.Fprintf(&b, "[::b]Image %d/%d[::-]", v.current+1, len(v.images))
+	if shown.Chapter != "" {
+		b.WriteString(" · " + tview.Escape(shown.Chapter))
+	}
+	if v.layout().decoded {
+		fmt.Fprintf(&b, " · %d%%", int(math.Round(v.zoom*100)))
+	}
+	b.WriteString("\n")
+	// The label with the other texts in parentheses
+	label := shown.Image.Label()
+	if label == "" {
+		b.WriteString("[::d]No caption[::-]")
+	} else {
+		b.WriteString(tview.Escape(label))
+	}
+	var others []string
+	for _, text := range []string{shown.Image.Alt, shown.Image.Title, shown.Image.Description} {
+		if text != "" && text != label && !slices.Contains(others, text) {
+			others = append(others, text)
+		}
+	}
+	if len(others) > 0 {
+		b.WriteString(" [::d](" + tview.Escape(strings.Join(others, " · ")) + ")[::-]")
+	}
+	b.WriteString("\n[::d]n/N: image, ]/[: chapter, hjkl: move, +/-: zoom, 0: fit, o: open, q: close[::-]")
+	return b.String()
+}
+
+// ShowImageViewer shows the images of the book one at a time, starting with images[current]
+// open is called with the path of an image when the user asks to open it in the external viewer
+func (ui *UI) ShowImageViewer(images []ViewerImage, current int, open func(path string)) error {
+	if len(images) == 0 {
+		return fmt.Errorf("no images")
+	}
+	viewer := &imageViewer{
+		Box:      tview.NewBox(),
+		ui:       ui,
+		images:   images,
+		metadata: make(map[string][]string),
+	}
+	viewer.show(min(max(current, 0), len(images)-1))
+	infoView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWordWrap(true)
+	infoView.SetText(viewer.info())
+
+	switch ui.ColorScheme {
+	case DefaultColorScheme:
+		viewer.SetBackgroundColor(tcell.ColorDefault)
+		viewer.textColor = tcell.ColorDefault
+	case DarkColorScheme:
+		viewer.SetBackgroundColor(tcell.ColorDarkSlateGray)
+		viewer.textColor = tcell.ColorWhite
+	case LightColorScheme:
+		viewer.SetBackgroundColor(tcell.ColorWhite)
+		viewer.textColor = tcell.ColorBlack
+	}
+	infoView.SetBackgroundColor(viewer.GetBackgroundColor())
+	infoView.SetTextColor(viewer.textColor)
+
+	view := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(viewer, 0, 1, true).
+		AddItem(infoView, 3, 0, false)
+	resetContent := ui.SetTempContent(view)
+	// The viewer is as wide as the text
+	ui.Horizontal.ResizeItem(view, ui.TextWidth(), 0)
+	ui.viewer = viewer
+	ui.App.SetFocus(viewer)
+
+	var resetCapture func()
+	resetCapture = ui.SetCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		key := event.Key()
+		if key == tcell.KeyRune {
+			switch event.Rune() {
+			case 'h':
+				key = tcell.KeyLeft
+			case 'j':
+				key = tcell.KeyDown
+			case 'k':
+				key = tcell.KeyUp
+			case 'l':
+				key = tcell.KeyRight
+			}
+		}
+		switch key {
+		case tcell.KeyEscape:
+			resetCapture()
+			ui.viewer = nil
+			resetContent()
+			return nil
+		case tcell.KeyLeft:
+			viewer.pan(-1, 0)
+		case tcell.KeyRight:
+			viewer.pan(1, 0)
+		case tcell.KeyUp:
+			viewer.pan(0, -1)
+		case tcell.KeyDown:
+			viewer.pan(0, 1)
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'q':
+				resetCapture()
+				ui.viewer = nil
+				resetContent()
+				return nil
+			case '+', '=':
+				viewer.zoom = min(viewer.zoom*zoomStep, maxZoom)
+			case '-':
+				viewer.zoom = max(viewer.zoom/zoomStep, minZoom)
+			case '0':
+				viewer.show(viewer.current)
+			case 'n', ' ':
+				if viewer.current+1 < len(images) {
+					viewer.show(viewer.current + 1)
+				}
+			case 'N', 'p':
+				if viewer.current > 0 {
+					viewer.show(viewer.current - 1)
+				}
+			case ']':
+				if next := viewer.nextChapter(1); next >= 0 {
+					viewer.show(next)
+				}
+			case '[':
+				if previous := viewer.nextChapter(-1); previous >= 0 {
+					viewer.show(previous)
+				}
+			case 'o':
+				if open != nil {
+					open(images[viewer.current].Path)
+				}
+			}
+		}
+		infoView.SetText(viewer.info())
+		// Block all other keys
+		return nil
+	})
+
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package utils
+
+// GetCellSize returns the size in pixels of a cell of the terminal, zero when the terminal doesn't tell
+func GetCellSize() (int, int) {
+	return 0, 0
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"os"
+	"strings"
 
 	"golang.org/x/term"
 )
@@ -14,3 +15,23 @@ func GetTermSize() (int, int) {
 	}
 	return width, height
 }
+
+// GetUserLanguage returns the primary language subtag of the user's locale (e.g. "en"),
+// or an empty string if the locale is not set
+func GetUserLanguage() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG", "LANGUAGE"} {
+		locale := os.Getenv(env)
+		if locale == "" || locale == "C" || locale == "POSIX" {
+			continue
+		}
+		// en_US.UTF-8, en-US, en_US:en
+		fields := strings.FieldsFunc(locale, func(r rune) bool {
+			return r == '_' || r == '-' || r == '.' || r == ':' || r == '@'
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		return strings.ToLower(fields[0])
+	}
+	return ""
+}